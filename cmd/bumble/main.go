@@ -73,20 +73,29 @@ func main() {
 	var portFlag = flag.Int("p", DEFAULT_PORT, "port number")
 	var promptFlag = flag.Bool("c", true, "use prompt?")
 	var projectFlag = flag.String("project", "", "choose project: [go,pager,db,query,concurrency,recovery] (required)")
+	var configFlag = flag.String("config", "", "JSON file of database options")
 	flag.Parse()
+	// Load the options, if given.
+	opts := config.DefaultOptions()
+	var err error
+	if *configFlag != "" {
+		if opts, err = config.LoadOptions(*configFlag); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 	// Open the db; if recovery, prime the database.
 	var database *db.Database
-	var err error
 	if *projectFlag == "recovery" {
-		database, err = recovery.Prime(*dbFlag)
+		database, err = recovery.Prime(*dbFlag, opts)
 	} else {
-		database, err = db.Open(*dbFlag)
+		database, err = db.Open(*dbFlag, opts)
 	}
 	if err != nil {
 		panic(err)
 	}
 	// Set up the log file.
-	err = database.CreateLogFile(config.LogFileName)
+	err = database.CreateLogFile(database.GetLogPath())
 	if err != nil {
 		panic(err)
 	}
@@ -125,7 +134,7 @@ func main() {
 		server = true
 		lm := concurrency.NewLockManager()
 		tm = concurrency.NewTransactionManager(lm)
-		rm, err = recovery.NewRecoveryManager(database, tm, config.LogFileName)
+		rm, err = recovery.NewRecoveryManager(database, tm, database.GetLogPath())
 		if err != nil {
 			fmt.Println(err)
 			return
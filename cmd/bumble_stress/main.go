@@ -2,11 +2,14 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,9 +17,6 @@ import (
 	btree "github.com/brown-csci1270/db/pkg/btree"
 	db "github.com/brown-csci1270/db/pkg/db"
 	hash "github.com/brown-csci1270/db/pkg/hash"
-	config "github.com/brown-csci1270/db/pkg/config"
-
-	uuid "github.com/google/uuid"
 )
 
 var STARTUP = 100 * time.Millisecond
@@ -56,20 +56,62 @@ func parseWorkload(path string) ([]string, error) {
 	return workload, scanner.Err()
 }
 
+// Run a line of the workload against table t.
+func runOperation(database *db.Database, line string) (err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	// Parse the integer fields at the given positions.
+	ints := func(idx ...int) ([]int64, error) {
+		vals := make([]int64, len(idx))
+		for i, j := range idx {
+			if vals[i], err = strconv.ParseInt(fields[j], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	}
+	var vals []int64
+	switch {
+	case fields[0] == "insert" && len(fields) == 5:
+		if vals, err = ints(1, 2); err == nil {
+			err = database.Insert(fields[4], vals[0], vals[1])
+		}
+	case fields[0] == "update" && len(fields) == 4:
+		if vals, err = ints(2, 3); err == nil {
+			err = database.Update(fields[1], vals[0], vals[1])
+		}
+	case fields[0] == "find" && len(fields) == 4:
+		if vals, err = ints(1); err == nil {
+			_, err = database.Find(fields[3], vals[0])
+		}
+	case fields[0] == "delete" && len(fields) == 4:
+		if vals, err = ints(1); err == nil {
+			err = database.Delete(fields[3], vals[0])
+		}
+	default:
+		err = errors.New("unsupported operation")
+	}
+	return err
+}
+
 // Handle workload
-func handleWorkload(c chan string, wg *sync.WaitGroup, workload []string, idx int, n int) {
+func handleWorkload(database *db.Database, wg *sync.WaitGroup, workload []string, idx int, n int) {
 	// Iterate!
 	defer wg.Done()
 	for i := idx; i < len(workload); i += n {
 		time.Sleep(jitter())
-		c <- workload[i]
+		if err := runOperation(database, workload[i]); err != nil {
+			fmt.Printf("%s: %v\n", workload[i], err)
+		}
 	}
 }
 
 // Start the database.
 func main() {
 	// Set up flags.
-	var indexFlag = flag.String("index", "", "choose index: [btree,hash] (required)")
+	var indexFlag = flag.String("index", "", "choose index: [btree,hash,linear] (required)")
 	var workloadFlag = flag.String("workload", "", "workload file (required)")
 	var nFlag = flag.Int("n", 1, "number of threads to run (default: 1)")
 	var verifyFlag = flag.Bool("verify", false, "enable to verify database state at the end of the workload")
@@ -79,32 +121,25 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	// Clean up old db resources.
+	database.DropTable("t")
 	// Set up the log file.
-	os.Remove("./data/db.log")
-	err = database.CreateLogFile(config.LogFileName)
+	os.Remove(database.GetLogPath())
+	err = database.CreateLogFile(database.GetLogPath())
 	if err != nil {
 		panic(err)
 	}
 	// Setup close conditions.
 	defer database.Close()
 	setupCloseHandler(database)
-	// Clean up old db resources.
-	os.Remove("./data/t")
-	os.Remove("./data/t.meta")
-	// Run REPL.
-	r := db.DatabaseRepl(database)
-	c := make(chan string)
-	go r.RunChan(c, uuid.New(), "")
-	// Some time to wake up...
-	time.Sleep(STARTUP)
 	// Initialize the db.
-	switch *indexFlag {
-	case "btree":
-		c <- "create btree table t"
-	case "hash":
-		c <- "create hash table t"
-	default:
-		fmt.Println("must specify -index [btree,hash]")
+	indexType, err := db.ParseIndexType(*indexFlag)
+	if err != nil {
+		fmt.Println("must specify -index [btree,hash,linear]")
+		return
+	}
+	if _, err = database.CreateTable("t", indexType, nil, true); err != nil {
+		fmt.Println(err)
 		return
 	}
 	// Parse and run workload.
@@ -122,7 +157,7 @@ func main() {
 	var wg sync.WaitGroup
 	for i := 0; i < *nFlag; i++ {
 		wg.Add(1)
-		go handleWorkload(c, &wg, workload, i, *nFlag)
+		go handleWorkload(database, &wg, workload, i, *nFlag)
 	}
 	wg.Wait()
 	// Verify the structure of the index.
@@ -139,6 +174,9 @@ func main() {
 		case "hash":
 			index := index.(*hash.HashIndex)
 			hash.IsHash(index)
+		case "linear":
+			index := index.(*hash.LinearHashIndex)
+			hash.IsLinearHash(index)
 		}
 	}
 }
@@ -2,6 +2,7 @@ package btree
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	pager "github.com/brown-csci1270/db/pkg/pager"
@@ -16,13 +17,33 @@ type BTreeIndex struct {
 
 // OpenTable returns a table associated with the given database filename.
 func OpenTable(filename string) (table *BTreeIndex, err error) {
+	return OpenTableWithPageSize(filename, pager.PAGESIZE)
+}
+
+// OpenTableWithPageSize returns a table associated with the given database
+// filename, whose nodes are pages of the given size.
+func OpenTableWithPageSize(filename string, pageSize int64) (table *BTreeIndex, err error) {
 	// Create a pager for the table
-	pager := pager.NewPager()
+	pager, err := pager.NewPagerWithPageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
 	err = pager.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	// Initialize the pager if it's new.
+	return newBTreeIndex(pager)
+}
+
+// OpenMemoryTable returns a table that lives only in memory under the given name.
+func OpenMemoryTable(name string) (*BTreeIndex, error) {
+	pager := pager.NewPager()
+	pager.OpenAnonymous(name)
+	return newBTreeIndex(pager)
+}
+
+// Wraps an open pager into a table, initializing the pager if it's new.
+func newBTreeIndex(pager *pager.Pager) (*BTreeIndex, error) {
 	if pager.GetNumPages() == 0 {
 		rootPage, err := pager.GetPage(ROOT_PN)
 		if err != nil {
@@ -70,11 +91,11 @@ func (table *BTreeIndex) Find(key int64) (utils.Entry, error) {
 	if found {
 		return BTreeEntry{key: key, value: value}, nil
 	}
-	return nil, errors.New("entry could not be found")
+	return nil, utils.ErrKeyNotFound
 }
 
-// Inserts an entry to the table.
-func (table *BTreeIndex) Insert(key int64, value int64) error {
+// Inserts an entry into the table as directed by op, splitting the root if needed.
+func (table *BTreeIndex) insert(key int64, value int64, op insertOp) error {
 	// Get the root node.
 	rootPage, err := table.pager.GetPage(table.rootPN)
 	if err != nil {
@@ -87,7 +108,7 @@ func (table *BTreeIndex) Insert(key int64, value int64) error {
 	defer unsafeUnlockRoot(rootNode)
 	defer rootPage.Put()
 	// Insert the entry into the root node.
-	result := rootNode.insert(key, value, false)
+	result := rootNode.insert(key, value, op)
 	// Check if we need to split the root node.
 	// Remember to preserve the invariant that the root node occupies page 0.
 	if result.isSplit {
@@ -95,7 +116,7 @@ func (table *BTreeIndex) Insert(key int64, value int64) error {
 		defer SUPER_NODE.unlock()
 		// Ensure that our left PN hasn't changed.
 		if result.leftPN != 0 {
-			return errors.New("splitting was corrupted")
+			return fmt.Errorf("splitting was corrupted: %w", utils.ErrCorrupt)
 		}
 		// Create a new node to transfer our data.
 		var newNodePN int64
@@ -135,22 +156,95 @@ func (table *BTreeIndex) Insert(key int64, value int64) error {
 	return result.err
 }
 
+// Inserts an entry to the table.
+func (table *BTreeIndex) Insert(key int64, value int64) error {
+	return table.insert(key, value, insertOp{mode: INSERT_MODE})
+}
+
 // Update modifies an existing entry.
 func (table *BTreeIndex) Update(key int64, value int64) error {
-	// Get the root node.
+	return table.insert(key, value, insertOp{mode: UPDATE_MODE})
+}
+
+// Upsert inserts an entry, or modifies it if the key already exists.
+func (table *BTreeIndex) Upsert(key int64, value int64) error {
+	return table.insert(key, value, insertOp{mode: UPSERT_MODE})
+}
+
+// CompareAndSwap sets the key's value if it currently holds expected.
+// Returns whether the swap happened.
+func (table *BTreeIndex) CompareAndSwap(key int64, expected int64, value int64) (bool, error) {
+	err := table.insert(key, value, insertOp{mode: SWAP_MODE, expected: expected})
+	if err == errSwapFailed {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ApplyBatch applies a batch of writes in key order. Writes that land in the same
+// leaf are applied under a single descent from the root, holding that leaf's latch.
+func (table *BTreeIndex) ApplyBatch(batch *utils.WriteBatch) error {
+	ops := batch.Ops()
+	for len(ops) > 0 {
+		n, err := table.applyToLeaf(ops)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// The leaf is full, so insert through the root to let it split.
+			if err = table.Upsert(ops[0].Key, ops[0].Value); err != nil {
+				return err
+			}
+			n = 1
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// Descends to the leaf holding the first op's key, then applies the leading ops
+// that belong to that leaf and don't split it. Returns how many were applied.
+func (table *BTreeIndex) applyToLeaf(ops []utils.BatchOp) (int, error) {
 	rootPage, err := table.pager.GetPage(table.rootPN)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	// [CONCURRENCY] Lock and eventually unlock the root node.
+	// [CONCURRENCY] Lock the root, then crab down. Since the leaf never splits,
+	// each node is released as soon as its child is locked.
 	lockRoot(rootPage)
-	rootNode := pageToNode(rootPage)
-	initRootNode(rootNode)
-	defer unsafeUnlockRoot(rootNode)
-	defer rootPage.Put()
-	// Update the entry.
-	result := rootNode.insert(key, value, true)
-	return result.err
+	node := pageToNode(rootPage)
+	initRootNode(node)
+	var parentPage *pager.Page
+	// Keys in the leaf are below the upper bound, if any.
+	upper, bounded := int64(0), false
+	for node.getNodeType() == INTERNAL_NODE {
+		internal := node.(*InternalNode)
+		internal.unlockParent(true)
+		if parentPage != nil {
+			parentPage.Put()
+		}
+		idx := internal.search(ops[0].Key)
+		if idx < internal.numKeys {
+			upper, bounded = internal.getKeyAt(idx), true
+		}
+		child, err := internal.getChildAt(idx, true)
+		if err != nil {
+			internal.unlock()
+			internal.page.Put()
+			return 0, err
+		}
+		internal.initChild(child)
+		parentPage = internal.page
+		node = child
+	}
+	leaf := node.(*LeafNode)
+	leaf.unlockParent(true)
+	if parentPage != nil {
+		parentPage.Put()
+	}
+	defer leaf.page.Put()
+	defer leaf.unlock()
+	return leaf.applyBatch(ops, upper, bounded), nil
 }
 
 // Delete removes a key from the table.
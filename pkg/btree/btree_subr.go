@@ -24,17 +24,27 @@ var NODE_HEADER_SIZE int64 = NODETYPE_SIZE + NUM_KEYS_SIZE
 var RIGHT_SIBLING_PN_OFFSET int64 = NODE_HEADER_SIZE
 var RIGHT_SIBLING_PN_SIZE int64 = binary.MaxVarintLen64
 var LEAF_NODE_HEADER_SIZE int64 = NODE_HEADER_SIZE + RIGHT_SIBLING_PN_SIZE
-var ENTRIES_PER_LEAF_NODE int64 = ((pager.PAGESIZE - LEAF_NODE_HEADER_SIZE) / ENTRYSIZE) - 1
 
 // Internal node header constants.
 var KEY_SIZE int64 = binary.MaxVarintLen64
 var PN_SIZE int64 = binary.MaxVarintLen64
 var INTERNAL_NODE_HEADER_SIZE int64 = NODE_HEADER_SIZE
-var ptrSpace int64 = pager.PAGESIZE - INTERNAL_NODE_HEADER_SIZE - KEY_SIZE
-var KEYS_PER_INTERNAL_NODE int64 = (ptrSpace / (KEY_SIZE + PN_SIZE)) - 1
 var KEYS_OFFSET int64 = INTERNAL_NODE_HEADER_SIZE
-var KEYS_SIZE int64 = KEY_SIZE * (KEYS_PER_INTERNAL_NODE + 1)
-var PNS_OFFSET int64 = KEYS_OFFSET + KEYS_SIZE
+
+// The number of entries in a leaf node and keys in an internal node depend on
+// the size of the node's page. Internal nodes store their keys, then their
+// page numbers, each in an array with room for one more than fits.
+
+// Number of entries that fit in a leaf node on a page of the given size.
+func entriesPerLeafNode(pageSize int64) int64 {
+	return ((pageSize - LEAF_NODE_HEADER_SIZE) / ENTRYSIZE) - 1
+}
+
+// Number of keys that fit in an internal node on a page of the given size.
+func keysPerInternalNode(pageSize int64) int64 {
+	ptrSpace := pageSize - INTERNAL_NODE_HEADER_SIZE - KEY_SIZE
+	return (ptrSpace / (KEY_SIZE + PN_SIZE)) - 1
+}
 
 // [CONCURRENCY]
 var SUPER_NODE *InternalNode = &InternalNode{NodeHeader{INTERNAL_NODE, 0, &pager.Page{}}, nil}
@@ -74,7 +84,7 @@ type InternalNode struct {
 // initPage resets the page then sets the nodeType variable.
 func initPage(page *pager.Page, nodeType NodeType) {
 	page.SetDirty(true)
-	copy(*page.GetData(), make([]byte, pager.PAGESIZE))
+	copy(*page.GetData(), make([]byte, len(*page.GetData())))
 	if nodeType == LEAF_NODE {
 		(*page.GetData())[int(NODETYPE_OFFSET)] = 1 // Set the nodeType bit
 	}
@@ -118,8 +128,19 @@ func keyPos(index int64) int64 {
 }
 
 // pnPos returns the page offset to the internal node's ith child's pagenumber
-func pnPos(index int64) int64 {
-	return PNS_OFFSET + index*PN_SIZE
+func (node *InternalNode) pnPos(index int64) int64 {
+	pnsOffset := KEYS_OFFSET + KEY_SIZE*(node.maxKeys()+1)
+	return pnsOffset + index*PN_SIZE
+}
+
+// maxKeys returns the number of keys that fit in the internal node.
+func (node *InternalNode) maxKeys() int64 {
+	return keysPerInternalNode(node.page.GetPager().GetPageSize())
+}
+
+// maxEntries returns the number of entries that fit in the leaf node.
+func (node *LeafNode) maxEntries() int64 {
+	return entriesPerLeafNode(node.page.GetPager().GetPageSize())
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -304,7 +325,7 @@ func (node *InternalNode) updateKeyAt(index int64, key int64) {
 
 // getPNAt returns the pagenumber stored at the given index of the internal node.
 func (node *InternalNode) getPNAt(index int64) int64 {
-	startPos := pnPos(index)
+	startPos := node.pnPos(index)
 	pagenum, _ := binary.Varint((*node.page.GetData())[startPos : startPos+PN_SIZE])
 	return pagenum
 }
@@ -314,7 +335,7 @@ func (node *InternalNode) updatePNAt(index int64, pagenum int64) {
 	// Serialize the pagenum data
 	data := make([]byte, PN_SIZE)
 	binary.PutVarint(data, pagenum)
-	startPos := pnPos(int64(index))
+	startPos := node.pnPos(int64(index))
 	node.page.Update(data, startPos, PN_SIZE)
 }
 
@@ -401,7 +422,7 @@ func (node *InternalNode) initChild(child Node) {
 // only checks if force == false
 func (node *InternalNode) unlockParent(force bool) error {
 	// If we could split and if we're not writing, don't unlock the parents.
-	if !force && node.numKeys == KEYS_PER_INTERNAL_NODE {
+	if !force && node.numKeys == node.maxKeys() {
 		return nil
 	}
 	// Else, unlock the parents recursively, and remove parent pointers.
@@ -430,7 +451,7 @@ func (node *InternalNode) unlock() {
 // only checks if force == false
 func (node *LeafNode) unlockParent(force bool) error {
 	// If we could split and if we're not writing, don't unlock the parents.
-	if !force && node.numKeys == ENTRIES_PER_LEAF_NODE {
+	if !force && node.numKeys == node.maxEntries() {
 		return nil
 	}
 	// Unlock the parents recursively, and remove parent pointers.
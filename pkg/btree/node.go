@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	pager "github.com/brown-csci1270/db/pkg/pager"
+	utils "github.com/brown-csci1270/db/pkg/utils"
 )
 
 // Split is a supporting data structure to propagate keys up our B+ tree.
@@ -19,11 +20,30 @@ type Split struct {
 	err     error // Used to propagate errors upwards.
 }
 
+// insertMode decides how insert treats a key that is or isn't already in the tree.
+type insertMode int
+
+const (
+	INSERT_MODE insertMode = iota // Add a new key; fail if it exists.
+	UPDATE_MODE                   // Overwrite an existing key; fail if it doesn't exist.
+	UPSERT_MODE                   // Add the key, or overwrite it if it exists.
+	SWAP_MODE                     // Overwrite an existing key only if it holds the expected value.
+)
+
+// insertOp is passed down the tree to tell the leaf how to insert.
+type insertOp struct {
+	mode     insertMode
+	expected int64 // The value a SWAP_MODE insert expects to overwrite.
+}
+
+// errSwapFailed is returned by a SWAP_MODE insert if the key held an unexpected value.
+var errSwapFailed = errors.New("compare and swap failed")
+
 // Node defines a common interface for leaf and internal nodes.
 type Node interface {
 	// Interface for main node functions.
 	search(int64) int64
-	insert(int64, int64, bool) Split
+	insert(int64, int64, insertOp) Split
 	delete(int64)
 	get(int64) (int64, bool)
 
@@ -54,8 +74,8 @@ func (node *LeafNode) search(key int64) int64 {
 }
 
 // insert finds the appropriate place in a leaf node to insert a new tuple.
-// if update is true, allow overwriting existing keys. else, error.
-func (node *LeafNode) insert(key int64, value int64, update bool) Split {
+// op decides whether existing keys may be overwritten and whether new keys may be added.
+func (node *LeafNode) insert(key int64, value int64, op insertOp) Split {
 	/* SOLUTION {{{ */
 	/* CONCURRENCY {{{ */
 	node.unlockParent(false)
@@ -68,19 +88,21 @@ func (node *LeafNode) insert(key int64, value int64, update bool) Split {
 		/* CONCURRENCY {{{ */
 		defer node.unlockParent(true)
 		/* CONCURRENCY }}} */
-		if update {
-			node.updateValueAt(insertPos, value)
-			return Split{}
-		} else {
-			return Split{err: errors.New("cannot insert duplicate key")}
+		switch {
+		case op.mode == INSERT_MODE:
+			return Split{err: fmt.Errorf("cannot insert duplicate key: %w", utils.ErrKeyExists)}
+		case op.mode == SWAP_MODE && node.getValueAt(insertPos) != op.expected:
+			return Split{err: errSwapFailed}
 		}
+		node.updateValueAt(insertPos, value)
+		return Split{}
 	}
 	// Return an error if we're updating a non-existent entry.
-	if update {
+	if op.mode == UPDATE_MODE || op.mode == SWAP_MODE {
 		/* CONCURRENCY {{{ */
 		node.unlockParent(true)
 		/* CONCURRENCY }}} */
-		return Split{err: errors.New("cannot update non-existent entry")}
+		return Split{err: fmt.Errorf("cannot update non-existent entry: %w", utils.ErrKeyNotFound)}
 	}
 	// Shift entries to the right if needed.
 	for i := node.numKeys - 1; i >= insertPos; i-- {
@@ -91,7 +113,7 @@ func (node *LeafNode) insert(key int64, value int64, update bool) Split {
 	// Modify the cell at this position.
 	node.modifyCell(insertPos, BTreeEntry{key: key, value: value})
 	// Check if we need to split the node.
-	if node.numKeys > ENTRIES_PER_LEAF_NODE {
+	if node.numKeys > node.maxEntries() {
 		return node.split()
 	}
 	/* CONCURRENCY {{{ */
@@ -124,6 +146,38 @@ func (node *LeafNode) delete(key int64) {
 	/* SOLUTION }}} */
 }
 
+// applyBatch applies ops to the leaf in order, stopping at the first op whose key is
+// at or past the upper bound, or that would split the leaf. Deleting a missing key does nothing.
+// Returns how many ops were applied. Expects the leaf to be locked.
+func (node *LeafNode) applyBatch(ops []utils.BatchOp, upper int64, bounded bool) int {
+	for i, op := range ops {
+		if bounded && op.Key >= upper {
+			return i
+		}
+		pos := node.search(op.Key)
+		found := pos < node.numKeys && node.getKeyAt(pos) == op.Key
+		switch {
+		case op.Delete && found:
+			for j := pos; j < node.numKeys-1; j++ {
+				node.modifyCell(j, node.getCell(j+1))
+			}
+			node.updateNumKeys(node.numKeys - 1)
+		case op.Delete:
+		case found:
+			node.updateValueAt(pos, op.Value)
+		case node.numKeys >= node.maxEntries():
+			return i
+		default:
+			for j := node.numKeys - 1; j >= pos; j-- {
+				node.modifyCell(j+1, node.getCell(j))
+			}
+			node.updateNumKeys(node.numKeys + 1)
+			node.modifyCell(pos, BTreeEntry{key: op.Key, value: op.Value})
+		}
+	}
+	return len(ops)
+}
+
 // split is a helper function to split a leaf node, then propagate the split upwards.
 func (node *LeafNode) split() Split {
 	/* SOLUTION {{{ */
@@ -219,7 +273,7 @@ func (node *InternalNode) search(key int64) int64 {
 }
 
 // insert finds the appropriate place in a leaf node to insert a new tuple.
-func (node *InternalNode) insert(key int64, value int64, update bool) Split {
+func (node *InternalNode) insert(key int64, value int64, op insertOp) Split {
 	/* SOLUTION {{{ */
 	/* CONCURRENCY {{{ */
 	node.unlockParent(false)
@@ -235,7 +289,7 @@ func (node *InternalNode) insert(key int64, value int64, update bool) Split {
 	/* CONCURRENCY }}} */
 	defer child.getPage().Put()
 	// Insert value into the child.
-	result := child.insert(key, value, update)
+	result := child.insert(key, value, op)
 	// Insert a new key into our node if necessary.
 	if result.isSplit {
 		split := node.insertSplit(result)
@@ -269,7 +323,7 @@ func (node *InternalNode) insertSplit(split Split) Split {
 	node.updatePNAt(insertPos+1, split.rightPN)
 	node.updateNumKeys(node.numKeys + 1)
 	// Check if we need to split.
-	if node.numKeys > KEYS_PER_INTERNAL_NODE {
+	if node.numKeys > node.maxKeys() {
 		return node.split()
 	}
 	return Split{}
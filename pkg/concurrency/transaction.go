@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
 	uuid "github.com/google/uuid"
 )
 
@@ -122,7 +123,7 @@ func (tm *TransactionManager) Lock(clientId uuid.UUID, table db.Index, resourceK
 	// If a deadlock, unlock and error.
 	if tm.pGraph.DetectCycle() {
 		tm.tmMtx.RUnlock()
-		return errors.New("deadlock detected")
+		return utils.ErrDeadlock
 	}
 	// Else, lock the resource.
 	tm.tmMtx.RUnlock()
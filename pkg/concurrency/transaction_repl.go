@@ -79,23 +79,17 @@ func HandleFind(d *db.Database, tm *TransactionManager, payload string, w io.Wri
 	numFields := len(fields)
 	// Usage: find <key> from <table>
 	var key int
-	var table db.Index
 	if numFields != 4 || fields[2] != "from" {
 		return fmt.Errorf("usage: find <key> from <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("find error: %v", err)
+		return fmt.Errorf("find error: %w", err)
 	}
-	if table, err = d.GetTable(fields[3]); err != nil {
-		return fmt.Errorf("find error: %v", err)
-	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), R_LOCK); err != nil {
-		return fmt.Errorf("find error: %v", err)
-	}
-	if err = db.HandleFind(d, payload, w); err != nil {
-		return fmt.Errorf("find error: %v", err)
+	entry, err := tm.Tx(d, clientId).Find(fields[3], int64(key))
+	if err != nil {
+		return fmt.Errorf("find error: %w", err)
 	}
+	io.WriteString(w, fmt.Sprintf("found entry: (%d, %d)\n", entry.GetKey(), entry.GetValue()))
 	return nil
 }
 
@@ -104,23 +98,18 @@ func HandleInsert(d *db.Database, tm *TransactionManager, payload string, client
 	fields := strings.Fields(payload)
 	numFields := len(fields)
 	// Usage: insert <key> <value> into <table>
-	var key int
-	var table db.Index
+	var key, value int
 	if numFields != 5 || fields[3] != "into" {
 		return fmt.Errorf("usage: insert <key> <value> into <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("insert error: %w", err)
 	}
-	if table, err = d.GetTable(fields[4]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	if value, err = strconv.Atoi(fields[2]); err != nil {
+		return fmt.Errorf("insert error: %w", err)
 	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	if err = db.HandleInsert(d, payload); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	if err = tm.Tx(d, clientId).Insert(fields[4], int64(key), int64(value)); err != nil {
+		return fmt.Errorf("insert error: %w", err)
 	}
 	return nil
 }
@@ -130,23 +119,18 @@ func HandleUpdate(d *db.Database, tm *TransactionManager, payload string, client
 	fields := strings.Fields(payload)
 	numFields := len(fields)
 	// Usage: update <table> <key> <value>
-	var key int
-	var table db.Index
+	var key, value int
 	if numFields != 4 {
 		return fmt.Errorf("usage: update <table> <key> <value>")
 	}
 	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("update error: %w", err)
 	}
-	if table, err = d.GetTable(fields[1]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+	if value, err = strconv.Atoi(fields[3]); err != nil {
+		return fmt.Errorf("update error: %w", err)
 	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	if err = db.HandleUpdate(d, payload); err != nil {
-		return fmt.Errorf("update error: %v", err)
+	if err = tm.Tx(d, clientId).Update(fields[1], int64(key), int64(value)); err != nil {
+		return fmt.Errorf("update error: %w", err)
 	}
 	return nil
 }
@@ -157,22 +141,14 @@ func HandleDelete(d *db.Database, tm *TransactionManager, payload string, client
 	numFields := len(fields)
 	// Usage: delete <key> from <table>
 	var key int
-	var table db.Index
 	if numFields != 4 || fields[2] != "from" {
 		return fmt.Errorf("usage: delete <key> from <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
-	}
-	if table, err = d.GetTable(fields[3]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("delete error: %w", err)
 	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("delete error: %v", err)
-	}
-	if err = db.HandleDelete(d, payload); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	if err = tm.Tx(d, clientId).Delete(fields[3], int64(key)); err != nil {
+		return fmt.Errorf("delete error: %w", err)
 	}
 	return nil
 }
@@ -187,7 +163,7 @@ func HandleSelect(d *db.Database, tm *TransactionManager, payload string, w io.W
 	}
 	// NOTE: Select is unsafe; not locking anything. May provide an inconsistent view of the database.
 	if err = db.HandleSelect(d, payload, w); err != nil {
-		return fmt.Errorf("select error: %v", err)
+		return fmt.Errorf("select error: %w", err)
 	}
 	return nil
 }
@@ -211,18 +187,14 @@ func HandleLock(d *db.Database, tm *TransactionManager, payload string, w io.Wri
 	numFields := len(fields)
 	// Usage: lock <table> <key>
 	var key int
-	var table db.Index
 	if numFields != 3 {
 		return fmt.Errorf("usage: lock <table> <key>")
 	}
-	if table, err = d.GetTable(fields[1]); err != nil {
-		return fmt.Errorf("lock error: %v", err)
-	}
 	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("lock error: %v", err)
+		return fmt.Errorf("lock error: %w", err)
 	}
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("lock error: %v", err)
+	if err = tm.Tx(d, clientId).lock(fields[1], int64(key), W_LOCK); err != nil {
+		return fmt.Errorf("lock error: %w", err)
 	}
 	return nil
 }
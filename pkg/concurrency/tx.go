@@ -0,0 +1,91 @@
+package concurrency
+
+import (
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+	uuid "github.com/google/uuid"
+)
+
+// A Tx runs operations on a database under a client's transaction, locking each
+// key it touches until the transaction commits.
+type Tx struct {
+	d        *db.Database
+	tm       *TransactionManager
+	clientId uuid.UUID
+}
+
+// Begin a transaction for the given client and get a handle on it.
+func (tm *TransactionManager) BeginTx(d *db.Database, clientId uuid.UUID) (*Tx, error) {
+	if err := tm.Begin(clientId); err != nil {
+		return nil, err
+	}
+	return tm.Tx(d, clientId), nil
+}
+
+// Get a handle on the given client's transaction, which must be begun before use.
+func (tm *TransactionManager) Tx(d *db.Database, clientId uuid.UUID) *Tx {
+	return &Tx{d: d, tm: tm, clientId: clientId}
+}
+
+// Get the id of the client running the transaction.
+func (tx *Tx) GetClientID() uuid.UUID {
+	return tx.clientId
+}
+
+// Lock a key in a table for the rest of the transaction.
+func (tx *Tx) lock(name string, key int64, lType LockType) error {
+	table, err := tx.d.GetTable(name)
+	if err != nil {
+		return err
+	}
+	return tx.tm.Lock(tx.clientId, table, key, lType)
+}
+
+// Write-lock a key in a table for the rest of the transaction, without touching
+// it, e.g. to read its value before writing it.
+func (tx *Tx) LockForWrite(name string, key int64) error {
+	return tx.lock(name, key, W_LOCK)
+}
+
+// Find the entry with the given key.
+func (tx *Tx) Find(name string, key int64) (utils.Entry, error) {
+	if err := tx.lock(name, key, R_LOCK); err != nil {
+		return nil, err
+	}
+	return tx.d.Find(name, key)
+}
+
+// Insert an entry.
+func (tx *Tx) Insert(name string, key int64, value int64) error {
+	if err := tx.lock(name, key, W_LOCK); err != nil {
+		return err
+	}
+	return tx.d.Insert(name, key, value)
+}
+
+// Update an existing entry.
+func (tx *Tx) Update(name string, key int64, value int64) error {
+	if err := tx.lock(name, key, W_LOCK); err != nil {
+		return err
+	}
+	return tx.d.Update(name, key, value)
+}
+
+// Delete an entry.
+func (tx *Tx) Delete(name string, key int64) error {
+	if err := tx.lock(name, key, W_LOCK); err != nil {
+		return err
+	}
+	return tx.d.Delete(name, key)
+}
+
+// Call fn on each entry of a table. Scans don't lock anything, so they may see
+// other transactions' uncommitted writes.
+func (tx *Tx) Scan(name string, fn func(utils.Entry) error) error {
+	return tx.d.Scan(name, fn)
+}
+
+// Commit the transaction, releasing its locks.
+func (tx *Tx) Commit() error {
+	return tx.tm.Commit(tx.clientId)
+}
@@ -7,11 +7,20 @@ const DBName = "bumble"
 // Prompt printed by REPL.
 const Prompt = DBName + "> "
 
-// Number of pages.
+// Default number of pages buffered for each file.
 const NumPages = 32
 
-// Name of log file.
-const LogFileName = "./data/db.log"
+// Default number of bytes a sort holds in memory before spilling to disk.
+const SortMemory = 4 << 20
+
+// Default target false positive rate of a hash join's Bloom filters.
+const BloomFalsePositiveRate = 0.01
+
+// Default number of bytes a hash join holds in memory across its workers.
+const JoinMemory = 16 << 20
+
+// Default number of workers probing a hash join's partitions in parallel.
+const JoinWorkers = 4
 
 // Return prompt if requested, else "".
 func GetPrompt(flag bool) string {
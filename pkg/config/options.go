@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	directio "github.com/ncw/directio"
+)
+
+// Sync policies control when writes are forced to disk.
+type SyncPolicy string
+
+const (
+	SyncAlways SyncPolicy = "always" // Sync the log after every record and the catalog after every change.
+	SyncNone   SyncPolicy = "none"   // Leave flushing to the operating system.
+)
+
+// Options configure a database.
+type Options struct {
+	NumPages         int        `json:"num_pages"`          // Number of pages buffered in memory for each table file.
+	PageSize         int64      `json:"page_size"`          // Size in bytes of the pages of tables created from now on.
+	LogFile          string     `json:"log_file"`           // Path of the log file, relative to the data folder.
+	Sync             SyncPolicy `json:"sync"`               // When to force writes to disk.
+	DefaultIndexType string     `json:"default_index_type"` // Index type of tables created without one.
+	SortMemory       int64      `json:"sort_memory"`        // Bytes each sort holds in memory before spilling runs to disk.
+	BloomFPRate      float64    `json:"bloom_fp_rate"`      // Target false positive rate of a hash join's Bloom filters.
+	JoinMemory       int64      `json:"join_memory"`        // Bytes a hash join holds in memory across its workers.
+	JoinWorkers      int        `json:"join_workers"`       // Number of workers probing a hash join's partitions in parallel.
+}
+
+// Get the default options.
+func DefaultOptions() Options {
+	return Options{
+		NumPages:         NumPages,
+		PageSize:         int64(directio.BlockSize),
+		LogFile:          "db.log",
+		Sync:             SyncAlways,
+		DefaultIndexType: "btree",
+		SortMemory:       SortMemory,
+		BloomFPRate:      BloomFalsePositiveRate,
+		JoinMemory:       JoinMemory,
+		JoinWorkers:      JoinWorkers,
+	}
+}
+
+// Load options from a JSON file. Fields missing from the file keep their defaults.
+func LoadOptions(path string) (Options, error) {
+	opts := DefaultOptions()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return opts, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&opts); err != nil {
+		return opts, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return opts, opts.Validate()
+}
+
+// Check that the options are usable.
+func (opts Options) Validate() error {
+	if opts.NumPages <= 0 {
+		return fmt.Errorf("num_pages must be positive, got %d", opts.NumPages)
+	}
+	// Pages are read and written with direct I/O, which works in whole blocks.
+	if opts.PageSize <= 0 || opts.PageSize%int64(directio.BlockSize) != 0 {
+		return fmt.Errorf("page_size must be a positive multiple of %d, got %d", directio.BlockSize, opts.PageSize)
+	}
+	if opts.SortMemory <= 0 {
+		return fmt.Errorf("sort_memory must be positive, got %d", opts.SortMemory)
+	}
+	if opts.BloomFPRate <= 0 || opts.BloomFPRate >= 1 {
+		return fmt.Errorf("bloom_fp_rate must be between 0 and 1, got %v", opts.BloomFPRate)
+	}
+	if opts.JoinMemory <= 0 {
+		return fmt.Errorf("join_memory must be positive, got %d", opts.JoinMemory)
+	}
+	if opts.JoinWorkers <= 0 {
+		return fmt.Errorf("join_workers must be positive, got %d", opts.JoinWorkers)
+	}
+	if opts.LogFile == "" {
+		return fmt.Errorf("log_file must be set")
+	}
+	if opts.Sync != SyncAlways && opts.Sync != SyncNone {
+		return fmt.Errorf("sync must be %q or %q, got %q", SyncAlways, SyncNone, opts.Sync)
+	}
+	return nil
+}
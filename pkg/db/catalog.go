@@ -0,0 +1,210 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	config "github.com/brown-csci1270/db/pkg/config"
+	hash "github.com/brown-csci1270/db/pkg/hash"
+	pager "github.com/brown-csci1270/db/pkg/pager"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Name of the catalog file within the data folder.
+const CatalogFileName = config.DBName + ".catalog"
+
+// Column describes a column in a table's schema.
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+}
+
+// TableInfo describes a table in the database, as recorded in the catalog.
+type TableInfo struct {
+	Name     string            `json:"name"`                // Name of the table.
+	Type     IndexType         `json:"type"`                // Type of index backing the table.
+	Schema   []Column          `json:"schema"`              // Columns stored in the table.
+	Created  time.Time         `json:"created"`             // When the table was created.
+	Indexes  []string          `json:"indexes,omitempty"`   // Columns with a secondary index.
+	Options  map[string]string `json:"options,omitempty"`   // Table-specific options.
+	PageSize int64             `json:"page_size,omitempty"` // Size of the pages in the table's files; unset means the default.
+	Durable  bool              `json:"-"`                   // Whether the table is backed by disk; memory tables are lost on close.
+}
+
+// Get the size of the pages in the table's files. Tables recorded before the
+// page size could be configured, and memory tables, use the default.
+func (info TableInfo) pageSize() int64 {
+	if info.PageSize == 0 {
+		return pager.PAGESIZE
+	}
+	return info.PageSize
+}
+
+// The schema of a plain key/value table.
+func keyValueSchema() []Column {
+	return []Column{{Name: "key", Type: "int"}, {Name: "value", Type: "int"}}
+}
+
+// Check if the table stores rows with a schema, rather than plain key/value pairs.
+// Row tables have a primary key column.
+func (info TableInfo) IsRowTable() bool {
+	for _, col := range info.Schema {
+		if col.PrimaryKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the name of an index type.
+func (indexType IndexType) String() string {
+	switch indexType {
+	case BTreeIndexType:
+		return "btree"
+	case HashIndexType:
+		return "hash"
+	case LinearHashIndexType:
+		return "linear"
+	default:
+		return fmt.Sprintf("IndexType(%d)", int64(indexType))
+	}
+}
+
+// Parse an index type from its name.
+func ParseIndexType(s string) (IndexType, error) {
+	switch s {
+	case "btree":
+		return BTreeIndexType, nil
+	case "hash":
+		return HashIndexType, nil
+	case "linear":
+		return LinearHashIndexType, nil
+	default:
+		return 0, fmt.Errorf("invalid index type %q", s)
+	}
+}
+
+// Index types are stored in the catalog by name.
+func (indexType IndexType) MarshalText() ([]byte, error) {
+	return []byte(indexType.String()), nil
+}
+
+// Index types are stored in the catalog by name.
+func (indexType *IndexType) UnmarshalText(text []byte) (err error) {
+	*indexType, err = ParseIndexType(string(text))
+	return err
+}
+
+// Get the path of the catalog file.
+func (db *Database) catalogPath() string {
+	return filepath.Join(db.basepath, CatalogFileName)
+}
+
+// Open every table listed in the catalog. If there is no catalog yet, one is
+// built from the table files already in the data folder.
+func (db *Database) loadCatalog() error {
+	data, err := ioutil.ReadFile(db.catalogPath())
+	if os.IsNotExist(err) {
+		return db.bootstrapCatalog()
+	}
+	if err != nil {
+		return err
+	}
+	var infos []TableInfo
+	if err = json.Unmarshal(data, &infos); err != nil {
+		return fmt.Errorf("catalog is corrupted: %v: %w", err, utils.ErrCorrupt)
+	}
+	dirty := false
+	for _, info := range infos {
+		// Forget tables whose files were removed out from under us.
+		path := filepath.Join(db.basepath, info.Name)
+		if _, err := os.Stat(path); err != nil {
+			dirty = true
+			continue
+		}
+		info.Durable = true
+		if err := db.openTable(info); err != nil {
+			return err
+		}
+		db.infos[info.Name] = info
+	}
+	if dirty {
+		return db.writeCatalog()
+	}
+	return nil
+}
+
+// Build a catalog from the table files in the data folder.
+// NOTE: This is janky; assumes that if a .lmeta file exists, then it is a linear
+// hash index, if a .meta file exists, then it is a hash index, else, it is a btree index.
+func (db *Database) bootstrapCatalog() error {
+	files, err := ioutil.ReadDir(db.basepath)
+	if err != nil {
+		return err
+	}
+	alphanumeric, _ := regexp.Compile(`^\w+$`)
+	for _, file := range files {
+		name := file.Name()
+		if !file.Mode().IsRegular() || !alphanumeric.MatchString(name) {
+			continue
+		}
+		path := filepath.Join(db.basepath, name)
+		indexType := BTreeIndexType
+		if _, err := os.Stat(path + hash.LINEAR_META_SUFFIX); err == nil {
+			indexType = LinearHashIndexType
+		} else if _, err := os.Stat(path + ".meta"); err == nil {
+			indexType = HashIndexType
+		}
+		info := TableInfo{
+			Name:    name,
+			Type:    indexType,
+			Schema:  keyValueSchema(),
+			Created: file.ModTime(),
+			Durable: true,
+		}
+		if err := db.openTable(info); err != nil {
+			return err
+		}
+		db.infos[name] = info
+	}
+	return db.writeCatalog()
+}
+
+// Write the durable tables out to the catalog file.
+func (db *Database) writeCatalog() error {
+	infos := make([]TableInfo, 0, len(db.infos))
+	for _, info := range db.infos {
+		if info.Durable {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	data, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a partial catalog.
+	tmpPath := db.catalogPath() + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if err == nil && db.opts.Sync == config.SyncAlways {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, db.catalogPath())
+}
@@ -2,22 +2,33 @@ package db
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	btree "github.com/brown-csci1270/db/pkg/btree"
+	config "github.com/brown-csci1270/db/pkg/config"
 	hash "github.com/brown-csci1270/db/pkg/hash"
+	heap "github.com/brown-csci1270/db/pkg/heap"
 	pager "github.com/brown-csci1270/db/pkg/pager"
 	utils "github.com/brown-csci1270/db/pkg/utils"
 )
 
 // Database interface.
 type Database struct {
-	basepath string
-	tables   map[string]Index
+	basepath    string
+	tables      map[string]Index
+	infos       map[string]TableInfo
+	heaps       map[string]*heap.HeapFile  // Heaps holding the rows of row tables.
+	secondaries map[string]*SecondaryIndex // Secondary indexes on values.
+	rebuilds    map[string]*rebuild        // Tables whose indexes are being rebuilt.
+	opts        config.Options             // Options the database was opened with.
+	mtx         sync.RWMutex               // Guards the tables and the catalog.
 }
 
 // Index interface.
@@ -28,6 +39,9 @@ type Index interface {
 	Find(int64) (utils.Entry, error)
 	Insert(int64, int64) error
 	Update(int64, int64) error
+	Upsert(int64, int64) error
+	CompareAndSwap(int64, int64, int64) (bool, error)
+	ApplyBatch(*utils.WriteBatch) error
 	Delete(int64) error
 	Select() ([]utils.Entry, error)
 	Print(io.Writer)
@@ -35,16 +49,27 @@ type Index interface {
 	TableStart() (utils.Cursor, error)
 }
 
-// An index can either be a B+Tree or a Hash Table.
+// An index can either be a B+Tree, an extendible Hash Table, or a linear Hash Table.
 type IndexType int64
 
 const (
-	BTreeIndexType IndexType = 0
-	HashIndexType  IndexType = 1
+	BTreeIndexType      IndexType = 0
+	HashIndexType       IndexType = 1
+	LinearHashIndexType IndexType = 2
 )
 
-// Opens a database given a data folder.
-func Open(folder string) (*Database, error) {
+// Opens a database given a data folder. Options may be given; otherwise the defaults are used.
+func Open(folder string, options ...config.Options) (*Database, error) {
+	opts := config.DefaultOptions()
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := ParseIndexType(opts.DefaultIndexType); err != nil {
+		return nil, fmt.Errorf("invalid default_index_type: %w", err)
+	}
 	// Ensure folder is of the form */
 	if !strings.HasSuffix(folder, "/") {
 		folder += "/"
@@ -54,17 +79,29 @@ func Open(folder string) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Return an empty database.
-	return &Database{
-		basepath: folder,
-		tables:   make(map[string]Index),
-	}, nil
+	// Open the tables listed in the catalog.
+	db := &Database{
+		basepath:    folder,
+		tables:      make(map[string]Index),
+		infos:       make(map[string]TableInfo),
+		heaps:       make(map[string]*heap.HeapFile),
+		secondaries: make(map[string]*SecondaryIndex),
+		rebuilds:    make(map[string]*rebuild),
+		opts:        opts,
+	}
+	if err = db.loadCatalog(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // Close each table in the database, then close the database.
 func (db *Database) Close() (err error) {
-	for _, table := range db.tables {
-		curErr := table.Close()
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for name := range db.tables {
+		curErr := db.closeTable(name)
 		if err == nil {
 			err = curErr
 		}
@@ -84,64 +121,507 @@ func (db *Database) CreateLogFile(filename string) error {
 	return file.Close()
 }
 
-// Create a table with the given type.
-func (db *Database) createTable(name string, indexType IndexType) (index Index, err error) {
+// Create a table with the given type. A nil schema creates a key/value table; otherwise
+// the schema must have a primary key, and rows are stored in a heap keyed by it.
+// Tables that aren't durable are kept only in memory.
+func (db *Database) CreateTable(name string, indexType IndexType, schema []Column, durable bool) (index Index, err error) {
 	// Ensure the db name is alphanumeric.
 	alphanumeric, _ := regexp.Compile(`\W`)
 	if alphanumeric.MatchString(name) {
 		return nil, errors.New("table name must be alphanumeric")
 	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
 	// Create the file, if not exists.
 	path := filepath.Join(db.basepath, name)
 	if _, err := os.Stat(path); err == nil {
-		return nil, errors.New("table already exists")
+		return nil, utils.ErrTableExists
 	}
-	// Open the right type of index.
-	switch indexType {
-	case BTreeIndexType:
-		index, err = btree.OpenTable(path)
-		if err != nil {
+	if _, ok := db.tables[name]; ok {
+		return nil, utils.ErrTableExists
+	}
+	if schema == nil {
+		schema = keyValueSchema()
+	}
+	info := TableInfo{
+		Name:    name,
+		Type:    indexType,
+		Schema:  schema,
+		Created: time.Now(),
+		Durable: durable,
+	}
+	// Only files have pages worth sizing; memory tables keep the default.
+	if durable {
+		info.PageSize = db.opts.PageSize
+	}
+	if err = db.openTable(info); err != nil {
+		return nil, err
+	}
+	db.infos[name] = info
+	// Record durable tables in the catalog.
+	if durable {
+		if err = db.writeCatalog(); err != nil {
 			return nil, err
 		}
-	case HashIndexType:
-		index, err = hash.OpenTable(path)
+	}
+	return db.tables[name], nil
+}
+
+// Open the index and heap for the given table, and add them to the database.
+func (db *Database) openTable(info TableInfo) (err error) {
+	path := filepath.Join(db.basepath, info.Name)
+	var index Index
+	if info.Durable {
+		index, err = openIndex(path, info.Type, info.pageSize())
+	} else {
+		index, err = openMemoryIndex(info.Name, info.Type)
+	}
+	if err != nil {
+		return err
+	}
+	index.GetPager().SetBufferSize(db.opts.NumPages)
+	if info.IsRowTable() {
+		hf, err := openHeap(path, info)
 		if err != nil {
-			return nil, err
+			index.Close()
+			return err
+		}
+		hf.GetPager().SetBufferSize(db.opts.NumPages)
+		db.heaps[info.Name] = hf
+	}
+	if len(info.Indexes) > 0 {
+		var secondary *SecondaryIndex
+		if info.Durable {
+			secondary, err = OpenSecondaryIndex(path, info.pageSize())
+		} else {
+			secondary, err = OpenMemorySecondaryIndex(info.Name)
+		}
+		if err != nil {
+			index.Close()
+			return err
+		}
+		secondary.setBufferSize(db.opts.NumPages)
+		db.secondaries[info.Name] = secondary
+	}
+	db.tables[info.Name] = index
+	return nil
+}
+
+// Close the index and heap for the given table, and remove them from the database.
+func (db *Database) closeTable(name string) (err error) {
+	if index, ok := db.tables[name]; ok {
+		err = index.Close()
+		delete(db.tables, name)
+	}
+	if hf, ok := db.heaps[name]; ok {
+		if curErr := hf.Close(); err == nil {
+			err = curErr
+		}
+		delete(db.heaps, name)
+	}
+	if secondary, ok := db.secondaries[name]; ok {
+		if curErr := secondary.Close(); err == nil {
+			err = curErr
 		}
+		delete(db.secondaries, name)
+	}
+	return err
+}
+
+// Open an index of the given type backed by the given file, made of pages of the given size.
+func openIndex(path string, indexType IndexType, pageSize int64) (Index, error) {
+	switch indexType {
+	case BTreeIndexType:
+		return btree.OpenTableWithPageSize(path, pageSize)
+	case HashIndexType:
+		return hash.OpenTableWithPageSize(path, pageSize)
+	case LinearHashIndexType:
+		return hash.OpenLinearTableWithPageSize(path, pageSize)
 	default:
 		return nil, errors.New("invalid index type")
 	}
-	db.tables[name] = index
-	return index, nil
 }
 
-// Get a table by its name, either from existing tables, or by creating a new one.
+// Open an in-memory index of the given type.
+func openMemoryIndex(name string, indexType IndexType) (Index, error) {
+	switch indexType {
+	case BTreeIndexType:
+		return btree.OpenMemoryTable(name)
+	case HashIndexType:
+		return hash.OpenMemoryTable(name)
+	case LinearHashIndexType:
+		return hash.OpenMemoryLinearTable(name)
+	default:
+		return nil, errors.New("invalid index type")
+	}
+}
+
+// Get a table by its name.
 func (db *Database) GetTable(name string) (index Index, err error) {
-	// Check existing set of tables.
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
 	if idx, ok := db.tables[name]; ok {
 		return idx, nil
 	}
-	// Check if file exists; if not, error.
-	path := filepath.Join(db.basepath, name)
-	if _, err := os.Stat(path); err != nil {
-		return nil, errors.New("table not found")
-	}
-	// Else, open from disk.
-	// NOTE: This is janky; assumes that if a .meta file exists, then it is a hash index,
-	// else, it is a btree index.
-	if _, err := os.Stat(path + ".meta"); err == nil {
-		index, err = hash.OpenTable(path)
-		if err != nil {
-			return nil, err
+	return nil, utils.ErrTableNotFound
+}
+
+// Get information about a table.
+func (db *Database) GetTableInfo(name string) (TableInfo, bool) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	info, ok := db.infos[name]
+	return info, ok
+}
+
+// Find the entry with the given key in a key/value table.
+func (db *Database) Find(name string, key int64) (utils.Entry, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, _, err := db.getKeyValueTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return table.Find(key)
+}
+
+// Get every entry in a key/value table.
+func (db *Database) Select(name string) ([]utils.Entry, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, _, err := db.getKeyValueTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return table.Select()
+}
+
+// Call fn on each entry of a key/value table, in key order for btree tables,
+// stopping at the first error. fn must not write to the database.
+func (db *Database) Scan(name string, fn func(utils.Entry) error) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, _, err := db.getKeyValueTable(name)
+	if err != nil {
+		return err
+	}
+	return scanIndex(table, fn)
+}
+
+// Call fn on each entry of an index. Expects db.mtx to be locked.
+func scanIndex(table Index, fn func(utils.Entry) error) error {
+	cursor, err := table.TableStart()
+	if err != nil {
+		return err
+	}
+	for stepErr := error(nil); stepErr == nil; stepErr = cursor.StepForward() {
+		// A btree cursor may sit at the end of a leaf before moving to the next one.
+		if cursor.IsEnd() {
+			continue
 		}
-	} else {
-		index, err = btree.OpenTable(path)
+		entry, err := cursor.GetEntry()
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert an entry into a key/value table, keeping its secondary index in sync.
+func (db *Database) Insert(name string, key int64, value int64) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, secondary, err := db.getKeyValueTable(name)
+	if err != nil {
+		return err
+	}
+	defer db.markDirty(name, key)
+	if secondary != nil {
+		secondary.Lock()
+		defer secondary.Unlock()
+	}
+	// Each index rejects duplicate keys under its own lock.
+	if err = table.Insert(key, value); err != nil {
+		return err
+	}
+	if secondary != nil {
+		return secondary.Insert(key, value)
+	}
+	return nil
+}
+
+// Update an entry in a key/value table, keeping its secondary index in sync.
+func (db *Database) Update(name string, key int64, value int64) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, secondary, err := db.getKeyValueTable(name)
+	if err != nil {
+		return err
+	}
+	defer db.markDirty(name, key)
+	if secondary == nil {
+		return table.Update(key, value)
+	}
+	secondary.Lock()
+	defer secondary.Unlock()
+	old, err := table.Find(key)
+	if err != nil {
+		return err
+	}
+	if err = table.Update(key, value); err != nil {
+		return err
+	}
+	if err = secondary.Delete(key, old.GetValue()); err != nil {
+		return err
+	}
+	return secondary.Insert(key, value)
+}
+
+// Insert or update an entry in a key/value table, keeping its secondary index in sync.
+func (db *Database) Upsert(name string, key int64, value int64) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, secondary, err := db.getKeyValueTable(name)
+	if err != nil {
+		return err
+	}
+	defer db.markDirty(name, key)
+	if secondary == nil {
+		return table.Upsert(key, value)
+	}
+	secondary.Lock()
+	defer secondary.Unlock()
+	old, _ := table.Find(key)
+	if err = table.Upsert(key, value); err != nil {
+		return err
+	}
+	if old != nil {
+		if err = secondary.Delete(key, old.GetValue()); err != nil {
+			return err
 		}
 	}
-	db.tables[name] = index
-	return index, nil
+	return secondary.Insert(key, value)
+}
+
+// Set an entry in a key/value table to value if it holds expected, keeping its
+// secondary index in sync. Returns whether the entry was changed.
+func (db *Database) CompareAndSwap(name string, key int64, expected int64, value int64) (bool, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, secondary, err := db.getKeyValueTable(name)
+	if err != nil {
+		return false, err
+	}
+	defer db.markDirty(name, key)
+	if secondary == nil {
+		return table.CompareAndSwap(key, expected, value)
+	}
+	secondary.Lock()
+	defer secondary.Unlock()
+	swapped, err := table.CompareAndSwap(key, expected, value)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	if err = secondary.Delete(key, expected); err != nil {
+		return true, err
+	}
+	return true, secondary.Insert(key, value)
+}
+
+// Apply a batch of writes to a key/value table, keeping its secondary index in sync.
+func (db *Database) ApplyBatch(name string, batch *utils.WriteBatch) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, secondary, err := db.getKeyValueTable(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, op := range batch.Ops() {
+			db.markDirty(name, op.Key)
+		}
+	}()
+	if secondary == nil {
+		return table.ApplyBatch(batch)
+	}
+	secondary.Lock()
+	defer secondary.Unlock()
+	ops := batch.Ops()
+	olds := make([]utils.Entry, len(ops))
+	for i, op := range ops {
+		olds[i], _ = table.Find(op.Key)
+	}
+	if err = table.ApplyBatch(batch); err != nil {
+		return err
+	}
+	for i, op := range ops {
+		if olds[i] != nil {
+			if err = secondary.Delete(op.Key, olds[i].GetValue()); err != nil {
+				return err
+			}
+		}
+		if !op.Delete {
+			if err = secondary.Insert(op.Key, op.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete an entry from a table, keeping its secondary index in sync.
+// Deleting from a row table removes the row with the given primary key.
+func (db *Database) Delete(name string, key int64) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, ok := db.tables[name]
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	defer db.markDirty(name, key)
+	secondary := db.secondaries[name]
+	if secondary == nil {
+		return table.Delete(key)
+	}
+	secondary.Lock()
+	defer secondary.Unlock()
+	old, err := table.Find(key)
+	if err != nil {
+		return err
+	}
+	if err = table.Delete(key); err != nil {
+		return err
+	}
+	return secondary.Delete(key, old.GetValue())
+}
+
+// Get a key/value table and its secondary index, if any. Expects db.mtx to be locked.
+func (db *Database) getKeyValueTable(name string) (Index, *SecondaryIndex, error) {
+	table, ok := db.tables[name]
+	if !ok {
+		return nil, nil, utils.ErrTableNotFound
+	}
+	if db.infos[name].IsRowTable() {
+		return nil, nil, fmt.Errorf("%s has columns; insert and update rows instead", name)
+	}
+	return table, db.secondaries[name], nil
+}
+
+// Drop a table, deleting its files.
+func (db *Database) DropTable(name string) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	info, ok := db.infos[name]
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	if _, ok := db.rebuilds[name]; ok {
+		return fmt.Errorf("%s is being rebuilt", name)
+	}
+	err := db.closeTable(name)
+	delete(db.infos, name)
+	if !info.Durable {
+		return err
+	}
+	if rmErr := removeTableFiles(filepath.Join(db.basepath, name)); err == nil {
+		err = rmErr
+	}
+	if catErr := db.writeCatalog(); err == nil {
+		err = catErr
+	}
+	return err
+}
+
+// Rename a table, moving its files.
+func (db *Database) RenameTable(oldName string, newName string) error {
+	// Ensure the new name is alphanumeric.
+	alphanumeric, _ := regexp.Compile(`\W`)
+	if alphanumeric.MatchString(newName) {
+		return errors.New("table name must be alphanumeric")
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	info, ok := db.infos[oldName]
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	if _, ok := db.rebuilds[oldName]; ok {
+		return fmt.Errorf("%s is being rebuilt", oldName)
+	}
+	if !info.Durable {
+		return errors.New("memory tables cannot be renamed")
+	}
+	oldPath := filepath.Join(db.basepath, oldName)
+	newPath := filepath.Join(db.basepath, newName)
+	if _, ok := db.tables[newName]; ok {
+		return utils.ErrTableExists
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return utils.ErrTableExists
+	}
+	// Close the table so its files can be moved, then reopen it under the new name.
+	if err := db.closeTable(oldName); err != nil {
+		return err
+	}
+	delete(db.infos, oldName)
+	for _, suffix := range tableFileSuffixes {
+		if err := os.Rename(oldPath+suffix, newPath+suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	info.Name = newName
+	if err := db.openTable(info); err != nil {
+		return err
+	}
+	db.infos[newName] = info
+	return db.writeCatalog()
+}
+
+// Truncate a table, removing all of its entries.
+func (db *Database) TruncateTable(name string) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	info, ok := db.infos[name]
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	if _, ok := db.rebuilds[name]; ok {
+		return fmt.Errorf("%s is being rebuilt", name)
+	}
+	// Close the table and replace it with an empty one of the same type.
+	if err := db.closeTable(name); err != nil {
+		return err
+	}
+	if info.Durable {
+		if err := removeTableFiles(filepath.Join(db.basepath, name)); err != nil {
+			delete(db.infos, name)
+			return err
+		}
+	}
+	if err := db.openTable(info); err != nil {
+		delete(db.infos, name)
+		return err
+	}
+	return nil
+}
+
+// Suffixes of the files that may back a table.
+var tableFileSuffixes = []string{
+	"", ".meta", hash.LINEAR_META_SUFFIX, heap.HEAP_SUFFIX, SECONDARY_HEADS_SUFFIX, SECONDARY_NEXT_SUFFIX,
+	SECONDARY_PREV_SUFFIX,
+}
+
+// Remove the files backing a table, ignoring any that don't exist.
+func removeTableFiles(path string) error {
+	for _, suffix := range tableFileSuffixes {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
 }
 
 // Get a database's tables.
@@ -153,3 +633,22 @@ func (db *Database) GetTables() map[string]Index {
 func (db *Database) GetBasePath() string {
 	return db.basepath
 }
+
+// Returns the options the database was opened with.
+func (db *Database) GetOptions() config.Options {
+	return db.opts
+}
+
+// Returns the path of the database's log file.
+func (db *Database) GetLogPath() string {
+	if filepath.IsAbs(db.opts.LogFile) {
+		return db.opts.LogFile
+	}
+	return filepath.Join(db.basepath, db.opts.LogFile)
+}
+
+// Returns the index type of tables created without one.
+func (db *Database) GetDefaultIndexType() IndexType {
+	indexType, _ := ParseIndexType(db.opts.DefaultIndexType)
+	return indexType
+}
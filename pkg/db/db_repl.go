@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 
+	hash "github.com/brown-csci1270/db/pkg/hash"
 	repl "github.com/brown-csci1270/db/pkg/repl"
 	utils "github.com/brown-csci1270/db/pkg/utils"
 )
@@ -16,45 +18,185 @@ func DatabaseRepl(db *Database) *repl.REPL {
 	r := repl.NewRepl()
 	r.AddCommand("create", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleCreateTable(db, payload, replConfig.GetWriter())
-	}, "Create a table. usage: create table <table>")
+	}, "Create a table or index. usage: create [memory] [btree|hash|linear] table <table> | create [memory] table <table> (<column> <int|text> [primary key], ...) | create index on <table>(value)")
+	r.AddCommand("drop", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleDropTable(db, payload, replConfig.GetWriter())
+	}, "Drop a table. usage: drop table <table>")
+	r.AddCommand("rename", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleRenameTable(db, payload, replConfig.GetWriter())
+	}, "Rename a table. usage: rename table <table> to <table>")
+	r.AddCommand("truncate", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleTruncateTable(db, payload, replConfig.GetWriter())
+	}, "Remove all entries from a table. usage: truncate table <table>")
+	r.AddCommand("alter", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleAlterTable(db, payload, replConfig.GetWriter())
+	}, "Rebuild a table with another index type. usage: alter table <table> set index <btree|hash|linear>")
+	r.AddCommand("compact", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleCompactTable(db, payload, replConfig.GetWriter())
+	}, "Reclaim the space held by old versions of a table's rows. usage: compact table <table>")
 	r.AddCommand("find", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleFind(db, payload, replConfig.GetWriter())
-	}, "Find an element. usage: find <key> from <table>")
-	r.AddCommand("insert", func(payload string, replConfig *repl.REPLConfig) error { return HandleInsert(db, payload) }, "Insert an element. usage: insert <key> <value> into <table>")
-	r.AddCommand("update", func(payload string, replConfig *repl.REPLConfig) error { return HandleUpdate(db, payload) }, "Update en element. usage: update <table> <key> <value>")
+	}, "Find an element. usage: find <key> from <table> | find value <value> from <table>")
+	r.AddCommand("insert", func(payload string, replConfig *repl.REPLConfig) error { return HandleInsert(db, payload) }, "Insert an element. usage: insert <key> <value> into <table> | insert into <table> values (<value>, ...)")
+	r.AddCommand("update", func(payload string, replConfig *repl.REPLConfig) error { return HandleUpdate(db, payload) }, "Update en element. usage: update <table> <key> <value> | update <table> set <column> = <value>, ... where <key column> = <key>")
+	r.AddCommand("upsert", func(payload string, replConfig *repl.REPLConfig) error { return HandleUpsert(db, payload) }, "Insert an element, or update it if it exists. usage: upsert <key> <value> into <table>")
+	r.AddCommand("cas", func(payload string, replConfig *repl.REPLConfig) error { return HandleCompareAndSwap(db, payload) }, "Update an element if it holds the expected value. usage: cas <table> <key> <expected> <value>")
 	r.AddCommand("delete", func(payload string, replConfig *repl.REPLConfig) error { return HandleDelete(db, payload) }, "Delete an element. usage: delete <key> from <table>")
 	r.AddCommand("select", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleSelect(db, payload, replConfig.GetWriter())
-	}, "Select elements from a table. usage: select from <table>")
+	}, "Select elements from a table. usage: select [<column>, ...|*] from <table> [where <column> = <value>]")
+	r.AddCommand("export", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleExport(db, payload)
+	}, "Export a table to a .csv, .jsonl or .bin file. usage: export <table> to <file>")
+	r.AddCommand("import", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleImport(db, payload)
+	}, "Import a .csv, .jsonl or .bin file into a table. usage: import <file> into <table>")
 	r.AddCommand("pretty", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandlePretty(db, payload, replConfig.GetWriter())
 	}, "Print out the internal data representation. usage: pretty")
+	r.AddCommand("stats", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleStats(db, payload, replConfig.GetWriter())
+	}, "Print out statistics on a hash table's shape. usage: stats <table>")
 	return r
 }
 
 // Handle create table.
 func HandleCreateTable(d *Database, payload string, w io.Writer) (err error) {
 	fields := strings.Fields(payload)
+	// Usage: create index on <table>(<column>)
+	if len(fields) > 1 && fields[1] == "index" {
+		return HandleCreateIndex(d, payload, w)
+	}
+	// Usage: create [memory] <type> table <table>
+	durable := true
+	if len(fields) > 1 && fields[1] == "memory" {
+		durable = false
+		fields = append(fields[:1], fields[2:]...)
+	}
+	// Usage: create [memory] table <table> (<column> <type> [primary key], ...)
+	if len(fields) > 1 && fields[1] == "table" && strings.Contains(payload, "(") {
+		return handleCreateRowTable(d, payload, durable, w)
+	}
+	// Usage: create [memory] table <table>
+	if len(fields) == 3 && fields[1] == "table" {
+		fields = []string{fields[0], d.GetDefaultIndexType().String(), fields[1], fields[2]}
+	}
 	numFields := len(fields)
-	// Usage: create <type> table <table>
-	if numFields != 4 || fields[2] != "table" || (fields[1] != "btree" && fields[1] != "hash") {
-		return fmt.Errorf("usage: create <btree|hash> table <table>")
+	if numFields != 4 || fields[2] != "table" || (fields[1] != "btree" && fields[1] != "hash" && fields[1] != "linear") {
+		return fmt.Errorf("usage: create [memory] [btree|hash|linear] table <table>")
 	}
-	var tableType IndexType
-	switch fields[1] {
-	case "btree":
-		tableType = BTreeIndexType
-	case "hash":
-		tableType = HashIndexType
-	default:
-		return errors.New("create error: internal error")
+	tableType, err := ParseIndexType(fields[1])
+	if err != nil {
+		return fmt.Errorf("create error: %w", err)
 	}
 	tableName := fields[3]
-	_, err = d.createTable(tableName, tableType)
+	_, err = d.CreateTable(tableName, tableType, nil, durable)
 	if err != nil {
 		return err
 	}
-	io.WriteString(w, fmt.Sprintf("%s table %s created.\n", fields[1], tableName))
+	if durable {
+		io.WriteString(w, fmt.Sprintf("%s table %s created.\n", fields[1], tableName))
+	} else {
+		io.WriteString(w, fmt.Sprintf("memory %s table %s created.\n", fields[1], tableName))
+	}
+	return nil
+}
+
+// Handle create index.
+func HandleCreateIndex(d *Database, payload string, w io.Writer) (err error) {
+	usage := fmt.Errorf("usage: create index on <table>(value)")
+	lparen, rparen := strings.Index(payload, "("), strings.LastIndex(payload, ")")
+	if lparen == -1 || rparen < lparen || strings.TrimSpace(payload[rparen+1:]) != "" {
+		return usage
+	}
+	fields := strings.Fields(payload[:lparen])
+	if len(fields) != 4 || fields[1] != "index" || fields[2] != "on" {
+		return usage
+	}
+	tableName, column := fields[3], strings.TrimSpace(payload[lparen+1:rparen])
+	if err = d.CreateIndex(tableName, column); err != nil {
+		return fmt.Errorf("create index error: %w", err)
+	}
+	io.WriteString(w, fmt.Sprintf("index on %s(%s) created.\n", tableName, column))
+	return nil
+}
+
+// Handle drop table.
+func HandleDropTable(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: drop table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: drop table <table>")
+	}
+	if err = d.DropTable(fields[2]); err != nil {
+		return fmt.Errorf("drop error: %w", err)
+	}
+	io.WriteString(w, fmt.Sprintf("table %s dropped.\n", fields[2]))
+	return nil
+}
+
+// Handle rename table.
+func HandleRenameTable(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: rename table <table> to <table>
+	if numFields != 5 || fields[1] != "table" || fields[3] != "to" {
+		return fmt.Errorf("usage: rename table <table> to <table>")
+	}
+	if err = d.RenameTable(fields[2], fields[4]); err != nil {
+		return fmt.Errorf("rename error: %w", err)
+	}
+	io.WriteString(w, fmt.Sprintf("table %s renamed to %s.\n", fields[2], fields[4]))
+	return nil
+}
+
+// Handle truncate table.
+func HandleTruncateTable(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: truncate table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: truncate table <table>")
+	}
+	if err = d.TruncateTable(fields[2]); err != nil {
+		return fmt.Errorf("truncate error: %w", err)
+	}
+	io.WriteString(w, fmt.Sprintf("table %s truncated.\n", fields[2]))
+	return nil
+}
+
+// Handle alter table.
+func HandleAlterTable(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: alter table <table> set index <type>
+	if numFields != 6 || fields[1] != "table" || fields[3] != "set" || fields[4] != "index" {
+		return fmt.Errorf("usage: alter table <table> set index <btree|hash|linear>")
+	}
+	indexType, err := ParseIndexType(fields[5])
+	if err != nil {
+		return fmt.Errorf("alter error: %w", err)
+	}
+	if err = d.AlterIndexType(fields[2], indexType); err != nil {
+		return fmt.Errorf("alter error: %w", err)
+	}
+	io.WriteString(w, fmt.Sprintf("table %s now has a %v index.\n", fields[2], indexType))
+	return nil
+}
+
+// Handle compact table.
+func HandleCompactTable(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: compact table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: compact table <table>")
+	}
+	if err = d.CompactRows(fields[2]); err != nil {
+		return fmt.Errorf("compact error: %w", err)
+	}
+	io.WriteString(w, fmt.Sprintf("table %s compacted.\n", fields[2]))
 	return nil
 }
 
@@ -62,22 +204,44 @@ func HandleCreateTable(d *Database, payload string, w io.Writer) (err error) {
 func HandleFind(d *Database, payload string, w io.Writer) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
+	// Usage: find value <value> from <table>
+	if numFields == 5 && fields[1] == "value" && fields[3] == "from" {
+		value, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("find error: %w", err)
+		}
+		entries, err := d.FindByValue(fields[4], value)
+		if err != nil {
+			return fmt.Errorf("find error: %w", err)
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("find error: no entry has value %d: %w", value, utils.ErrKeyNotFound)
+		}
+		for _, entry := range entries {
+			io.WriteString(w, fmt.Sprintf("found entry: (%d, %d)\n", entry.GetKey(), entry.GetValue()))
+		}
+		return nil
+	}
 	// Usage: find <key> from <table>
 	var key int
 	if numFields != 4 || fields[2] != "from" {
 		return fmt.Errorf("usage: find <key> from <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("find error: %v", err)
+		return fmt.Errorf("find error: %w", err)
 	}
 	tableName := fields[3]
-	table, err := d.GetTable(tableName)
-	if err != nil {
-		return fmt.Errorf("find error: %v", err)
+	if info, ok := d.GetTableInfo(tableName); ok && info.IsRowTable() {
+		row, err := d.FindRow(tableName, int64(key))
+		if err != nil {
+			return fmt.Errorf("find error: %w", err)
+		}
+		io.WriteString(w, fmt.Sprintf("found row: %s\n", formatRow(row)))
+		return nil
 	}
-	entry, err := table.Find(int64(key))
-	if err != nil || entry == nil {
-		return fmt.Errorf("find error: %v", err)
+	entry, err := d.Find(tableName, int64(key))
+	if err != nil {
+		return fmt.Errorf("find error: %w", err)
 	}
 	io.WriteString(w, fmt.Sprintf("found entry: (%d, %d)\n",
 		entry.GetKey(), entry.GetValue()))
@@ -88,29 +252,28 @@ func HandleFind(d *Database, payload string, w io.Writer) (err error) {
 func HandleInsert(d *Database, payload string) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
+	// Usage: insert into <table> values (<value>, ...)
+	if numFields > 1 && fields[1] == "into" {
+		return handleInsertRow(d, payload)
+	}
 	// Usage: insert <key> <value> into <table>
 	var key, value int
 	if numFields != 5 || fields[3] != "into" {
 		return fmt.Errorf("usage: insert <key> <value> into <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("insert error: %w", err)
 	}
 	if value, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("insert error: %w", err)
 	}
 	tableName := fields[4]
-	table, err := d.GetTable(tableName)
-	if err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	if info, ok := d.GetTableInfo(tableName); ok && info.IsRowTable() {
+		return fmt.Errorf("insert error: %s has columns; use insert into %s values (...)", tableName, tableName)
 	}
-	val, _ := table.Find(int64(key))
-	if val != nil {
-		return fmt.Errorf("insert error: key already in table")
-	}
-	err = table.Insert(int64(key), int64(value))
+	err = d.Insert(tableName, int64(key), int64(value))
 	if err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("insert error: %w", err)
 	}
 	return nil
 }
@@ -119,25 +282,78 @@ func HandleInsert(d *Database, payload string) (err error) {
 func HandleUpdate(d *Database, payload string) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
+	// Usage: update <table> set <column> = <value>, ... where <key column> = <key>
+	if numFields > 2 && fields[2] == "set" {
+		return handleUpdateRow(d, payload)
+	}
 	// Usage: update <table> <key> <value>
 	var key, value int
 	if numFields != 4 {
 		return fmt.Errorf("usage: update <table> <key> <value>")
 	}
 	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("update error: %w", err)
 	}
 	if value, err = strconv.Atoi(fields[3]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("update error: %w", err)
 	}
 	tableName := fields[1]
-	table, err := d.GetTable(tableName)
+	if info, ok := d.GetTableInfo(tableName); ok && info.IsRowTable() {
+		return fmt.Errorf("update error: %s has columns; use update %s set <column> = <value> where ...", tableName, tableName)
+	}
+	err = d.Update(tableName, int64(key), int64(value))
 	if err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("update error: %w", err)
+	}
+	return nil
+}
+
+// Handle upsert.
+func HandleUpsert(d *Database, payload string) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: upsert <key> <value> into <table>
+	var key, value int
+	if numFields != 5 || fields[3] != "into" {
+		return fmt.Errorf("usage: upsert <key> <value> into <table>")
+	}
+	if key, err = strconv.Atoi(fields[1]); err != nil {
+		return fmt.Errorf("upsert error: %w", err)
+	}
+	if value, err = strconv.Atoi(fields[2]); err != nil {
+		return fmt.Errorf("upsert error: %w", err)
+	}
+	err = d.Upsert(fields[4], int64(key), int64(value))
+	if err != nil {
+		return fmt.Errorf("upsert error: %w", err)
+	}
+	return nil
+}
+
+// Handle compare and swap.
+func HandleCompareAndSwap(d *Database, payload string) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: cas <table> <key> <expected> <value>
+	var key, expected, value int
+	if numFields != 5 {
+		return fmt.Errorf("usage: cas <table> <key> <expected> <value>")
+	}
+	if key, err = strconv.Atoi(fields[2]); err != nil {
+		return fmt.Errorf("cas error: %w", err)
 	}
-	err = table.Update(int64(key), int64(value))
+	if expected, err = strconv.Atoi(fields[3]); err != nil {
+		return fmt.Errorf("cas error: %w", err)
+	}
+	if value, err = strconv.Atoi(fields[4]); err != nil {
+		return fmt.Errorf("cas error: %w", err)
+	}
+	swapped, err := d.CompareAndSwap(fields[1], int64(key), int64(expected), int64(value))
 	if err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("cas error: %w", err)
+	}
+	if !swapped {
+		return fmt.Errorf("cas error: key %d does not hold %d", key, expected)
 	}
 	return nil
 }
@@ -152,16 +368,60 @@ func HandleDelete(d *Database, payload string) (err error) {
 		return fmt.Errorf("usage: delete <key> from <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("delete error: %w", err)
 	}
 	tableName := fields[3]
-	table, err := d.GetTable(tableName)
+	err = d.Delete(tableName, int64(key))
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+	return nil
+}
+
+// Handle export.
+func HandleExport(d *Database, payload string) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: export <table> to <file>
+	if numFields != 4 || fields[2] != "to" {
+		return fmt.Errorf("usage: export <table> to <file>")
+	}
+	path := strings.Trim(fields[3], "'")
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return fmt.Errorf("export error: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("export error: %w", err)
+	}
+	defer file.Close()
+	if err = d.Export(fields[1], format, file); err != nil {
+		return fmt.Errorf("export error: %w", err)
+	}
+	return nil
+}
+
+// Handle import.
+func HandleImport(d *Database, payload string) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: import <file> into <table>
+	if numFields != 4 || fields[2] != "into" {
+		return fmt.Errorf("usage: import <file> into <table>")
+	}
+	path := strings.Trim(fields[1], "'")
+	format, err := FormatFromPath(path)
 	if err != nil {
-		return fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("import error: %w", err)
 	}
-	err = table.Delete(int64(key))
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("import error: %w", err)
+	}
+	defer file.Close()
+	if err = d.Import(fields[3], format, file); err != nil {
+		return fmt.Errorf("import error: %w", err)
 	}
 	return nil
 }
@@ -170,18 +430,58 @@ func HandleDelete(d *Database, payload string) (err error) {
 func HandleSelect(d *Database, payload string, w io.Writer) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
-	// Usage: select from <table>
-	if numFields != 3 || fields[1] != "from" {
-		return fmt.Errorf("usage: select from <table>")
+	// Usage: select [<column>, ...|*] from <table> [where <column> = <value>]
+	if numFields < 3 || fields[1] != "from" {
+		return handleSelectRows(d, payload, w)
 	}
 	tableName := fields[2]
-	table, err := d.GetTable(tableName)
+	if info, ok := d.GetTableInfo(tableName); !ok || info.IsRowTable() {
+		return handleSelectRows(d, payload, w)
+	}
+	// Usage: select from <table> where <key|value> = <value>
+	if numFields > 3 {
+		return handleSelectWhere(d, tableName, payload, w)
+	}
+	// Usage: select from <table>
+	results, err := d.Select(tableName)
+	if err != nil {
+		return fmt.Errorf("select error: %w", err)
+	}
+	printResults(results, w)
+	return nil
+}
+
+// Handle select with a condition on a key/value table.
+func handleSelectWhere(d *Database, tableName string, payload string, w io.Writer) (err error) {
+	usage := fmt.Errorf("usage: select from <table> where <key|value> = <value>")
+	where := indexOutsideQuotes(payload, " where ")
+	if where == -1 {
+		return usage
+	}
+	col, value, err := parseCondition(payload[where+len(" where "):])
 	if err != nil {
-		return fmt.Errorf("select error: %v", err)
+		return usage
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("select error: %w", err)
 	}
 	var results []utils.Entry
-	if results, err = table.Select(); err != nil {
-		return err
+	switch col {
+	case "key":
+		entry, err := d.Find(tableName, v)
+		if err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
+			return fmt.Errorf("select error: %w", err)
+		}
+		if err == nil {
+			results = append(results, entry)
+		}
+	case "value":
+		if results, err = d.FindByValue(tableName, v); err != nil {
+			return fmt.Errorf("select error: %w", err)
+		}
+	default:
+		return usage
 	}
 	printResults(results, w)
 	return nil
@@ -196,18 +496,18 @@ func HandlePretty(d *Database, payload string, w io.Writer) (err error) {
 		tableName := fields[2]
 		table, err := d.GetTable(tableName)
 		if err != nil {
-			return fmt.Errorf("pretty error: %v", err)
+			return fmt.Errorf("pretty error: %w", err)
 		}
 		table.Print(w)
 	} else if numFields == 4 && fields[2] == "from" {
 		var pn int
 		if pn, err = strconv.Atoi(fields[1]); err != nil {
-			return fmt.Errorf("pretty error: %v", err)
+			return fmt.Errorf("pretty error: %w", err)
 		}
 		tableName := fields[3]
 		table, err := d.GetTable(tableName)
 		if err != nil {
-			return fmt.Errorf("pretty error: %v", err)
+			return fmt.Errorf("pretty error: %w", err)
 		}
 		table.PrintPN(pn, w)
 	} else {
@@ -216,6 +516,30 @@ func HandlePretty(d *Database, payload string, w io.Writer) (err error) {
 	return nil
 }
 
+// Handle stats.
+func HandleStats(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: stats <table>
+	if numFields != 2 {
+		return fmt.Errorf("usage: stats <table>")
+	}
+	table, err := d.GetTable(fields[1])
+	if err != nil {
+		return fmt.Errorf("stats error: %w", err)
+	}
+	hashTable, ok := table.(*hash.HashIndex)
+	if !ok {
+		return fmt.Errorf("stats error: %s is not a hash table", fields[1])
+	}
+	stats, err := hashTable.Stats()
+	if err != nil {
+		return fmt.Errorf("stats error: %w", err)
+	}
+	stats.Print(w)
+	return nil
+}
+
 // printResults prints all given entries in a standard format.
 func printResults(entries []utils.Entry, w io.Writer) {
 	for _, entry := range entries {
@@ -223,3 +547,211 @@ func printResults(entries []utils.Entry, w io.Writer) {
 			entry.GetKey(), entry.GetValue()))
 	}
 }
+
+// Handle create table for tables with columns.
+func handleCreateRowTable(d *Database, payload string, durable bool, w io.Writer) (err error) {
+	usage := fmt.Errorf("usage: create [memory] table <table> (<column> <int|text> [primary key], ...)")
+	// Split the payload into the table name and the column list.
+	lparen, rparen := strings.Index(payload, "("), strings.LastIndex(payload, ")")
+	if lparen == -1 || rparen < lparen || strings.TrimSpace(payload[rparen+1:]) != "" {
+		return usage
+	}
+	fields := strings.Fields(payload[:lparen])
+	if len(fields) < 3 || fields[len(fields)-2] != "table" {
+		return usage
+	}
+	tableName := fields[len(fields)-1]
+	schema, err := parseSchema(payload[lparen+1 : rparen])
+	if err != nil {
+		return fmt.Errorf("create error: %w", err)
+	}
+	if _, err = d.CreateTable(tableName, d.GetDefaultIndexType(), schema, durable); err != nil {
+		return err
+	}
+	io.WriteString(w, fmt.Sprintf("table %s created.\n", tableName))
+	return nil
+}
+
+// Handle insert for tables with columns.
+func handleInsertRow(d *Database, payload string) (err error) {
+	usage := fmt.Errorf("usage: insert into <table> values (<value>, ...)")
+	fields := strings.Fields(payload)
+	if len(fields) < 4 || !strings.HasPrefix(fields[3], "values") {
+		return usage
+	}
+	lparen, rparen := strings.Index(payload, "("), strings.LastIndex(payload, ")")
+	if lparen == -1 || rparen < lparen {
+		return usage
+	}
+	tableName := fields[2]
+	info, ok := d.GetTableInfo(tableName)
+	if !ok {
+		return fmt.Errorf("insert error: %w", utils.ErrTableNotFound)
+	}
+	values, err := splitList(payload[lparen+1 : rparen])
+	if err != nil {
+		return fmt.Errorf("insert error: %w", err)
+	}
+	if len(values) != len(info.Schema) {
+		return fmt.Errorf("insert error: expected %d values, got %d", len(info.Schema), len(values))
+	}
+	row := make(Row, len(values))
+	for i, value := range values {
+		if row[i], err = parseValue(info.Schema[i], value); err != nil {
+			return fmt.Errorf("insert error: %w", err)
+		}
+	}
+	if err = d.InsertRow(tableName, row); err != nil {
+		return fmt.Errorf("insert error: %w", err)
+	}
+	return nil
+}
+
+// Handle update for tables with columns.
+func handleUpdateRow(d *Database, payload string) (err error) {
+	usage := fmt.Errorf("usage: update <table> set <column> = <value>, ... where <key column> = <key>")
+	fields := strings.Fields(payload)
+	tableName := fields[1]
+	info, ok := d.GetTableInfo(tableName)
+	if !ok {
+		return fmt.Errorf("update error: %w", utils.ErrTableNotFound)
+	}
+	set, where := indexOutsideQuotes(payload, " set "), indexOutsideQuotes(payload, " where ")
+	if set == -1 || where < set {
+		return usage
+	}
+	// Parse the key from the where clause.
+	col, value, err := parseCondition(payload[where+len(" where "):])
+	if err != nil {
+		return usage
+	}
+	if col != info.Schema[info.primaryKey()].Name {
+		return fmt.Errorf("update error: rows can only be updated by %s", info.Schema[info.primaryKey()].Name)
+	}
+	key, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+	// Parse the assignments.
+	assignments, err := splitList(payload[set+len(" set ") : where])
+	if err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+	values := make(map[string]interface{})
+	for _, assignment := range assignments {
+		col, value, err := parseCondition(assignment)
+		if err != nil {
+			return usage
+		}
+		i, err := info.columnIndex(col)
+		if err != nil {
+			return fmt.Errorf("update error: %w", err)
+		}
+		if values[col], err = parseValue(info.Schema[i], value); err != nil {
+			return fmt.Errorf("update error: %w", err)
+		}
+	}
+	if err = d.UpdateRow(tableName, key, values); err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+	return nil
+}
+
+// Handle select for tables with columns.
+func handleSelectRows(d *Database, payload string, w io.Writer) (err error) {
+	usage := fmt.Errorf("usage: select [<column>, ...|*] from <table> [where <column> = <value>]")
+	from := indexOutsideQuotes(payload, " from ")
+	if from == -1 {
+		return usage
+	}
+	rest := strings.Fields(payload[from+len(" from "):])
+	if len(rest) == 0 {
+		return usage
+	}
+	tableName := rest[0]
+	info, ok := d.GetTableInfo(tableName)
+	if !ok {
+		return fmt.Errorf("select error: %w", utils.ErrTableNotFound)
+	}
+	if !info.IsRowTable() {
+		return fmt.Errorf("select error: %s does not have columns", tableName)
+	}
+	// Work out which columns to print.
+	columns := make([]int, 0)
+	projection := strings.TrimSpace(payload[len("select"):from])
+	if projection == "" || projection == "*" {
+		for i := range info.Schema {
+			columns = append(columns, i)
+		}
+	} else {
+		names, err := splitList(projection)
+		if err != nil {
+			return fmt.Errorf("select error: %w", err)
+		}
+		for _, name := range names {
+			i, err := info.columnIndex(name)
+			if err != nil {
+				return fmt.Errorf("select error: %w", err)
+			}
+			columns = append(columns, i)
+		}
+	}
+	// Parse the where clause, if any.
+	filter := func(Row) bool { return true }
+	if len(rest) > 1 {
+		where := indexOutsideQuotes(payload, " where ")
+		if where == -1 {
+			return usage
+		}
+		col, value, err := parseCondition(payload[where+len(" where "):])
+		if err != nil {
+			return usage
+		}
+		i, err := info.columnIndex(col)
+		if err != nil {
+			return fmt.Errorf("select error: %w", err)
+		}
+		v, err := parseValue(info.Schema[i], value)
+		if err != nil {
+			return fmt.Errorf("select error: %w", err)
+		}
+		filter = func(row Row) bool { return row[i] == v }
+	}
+	rows, err := d.SelectRows(tableName)
+	if err != nil {
+		return fmt.Errorf("select error: %w", err)
+	}
+	for _, row := range rows {
+		if !filter(row) {
+			continue
+		}
+		projected := make(Row, len(columns))
+		for j, i := range columns {
+			projected[j] = row[i]
+		}
+		io.WriteString(w, formatRow(projected)+"\n")
+	}
+	return nil
+}
+
+// Parse a condition or assignment of the form "<column> = <value>".
+func parseCondition(s string) (string, string, error) {
+	eq := indexOutsideQuotes(s, "=")
+	if eq == -1 {
+		return "", "", fmt.Errorf("expected <column> = <value>")
+	}
+	col, value := strings.TrimSpace(s[:eq]), strings.TrimSpace(s[eq+1:])
+	if col == "" || value == "" {
+		return "", "", fmt.Errorf("expected <column> = <value>")
+	}
+	return col, value, nil
+}
+
+// formatRow formats a row as a tuple.
+func formatRow(row Row) string {
+	values := make([]string, len(row))
+	for i, v := range row {
+		values[i] = formatValue(v)
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	btree "github.com/brown-csci1270/db/pkg/btree"
+	hash "github.com/brown-csci1270/db/pkg/hash"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// A table's new index is built in files with this suffix, then moved into place.
+const REBUILD_SUFFIX = ".rebuild"
+
+// Entries are copied into a new index this many at a time, blocking writers only
+// while each chunk is read.
+const REBUILD_CHUNK_SIZE = 512
+
+// Catching up on concurrent writes stops after this many rounds; whatever is left
+// is applied with writers blocked.
+const REBUILD_MAX_ROUNDS = 8
+
+// Suffixes of the files that may back a table's index.
+var indexFileSuffixes = []string{"", ".meta", hash.LINEAR_META_SUFFIX}
+
+// A rebuild tracks the keys written to a table while its new index is built, so
+// that the new index can catch up on them.
+type rebuild struct {
+	dirty map[int64]bool
+	mtx   sync.Mutex // Guards dirty; writers only hold db.mtx for reading.
+}
+
+// Record that keys in a table were written. Expects db.mtx to be locked.
+func (db *Database) markDirty(name string, keys ...int64) {
+	rb, ok := db.rebuilds[name]
+	if !ok {
+		return
+	}
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	for _, key := range keys {
+		rb.dirty[key] = true
+	}
+}
+
+// Get the number of keys written since the last call to takeDirty.
+func (rb *rebuild) numDirty() int {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	return len(rb.dirty)
+}
+
+// Take the keys written since the last call.
+func (rb *rebuild) takeDirty() []int64 {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	keys := make([]int64, 0, len(rb.dirty))
+	for key := range rb.dirty {
+		keys = append(keys, key)
+	}
+	rb.dirty = make(map[int64]bool)
+	return keys
+}
+
+// Rebuild a table's index as the given type. The table stays usable throughout:
+// the new index is filled from a scan of the old one, catches up on any writes made
+// during the scan, and then replaces the old index with writers briefly blocked.
+func (db *Database) AlterIndexType(name string, indexType IndexType) error {
+	db.mtx.Lock()
+	old, ok := db.tables[name]
+	if !ok {
+		db.mtx.Unlock()
+		return utils.ErrTableNotFound
+	}
+	info := db.infos[name]
+	if info.Type == indexType {
+		db.mtx.Unlock()
+		return fmt.Errorf("%s already has a %v index", name, indexType)
+	}
+	if _, ok := db.rebuilds[name]; ok {
+		db.mtx.Unlock()
+		return fmt.Errorf("%s is already being rebuilt", name)
+	}
+	// Start recording writes before the scan so that none are missed.
+	path := filepath.Join(db.basepath, name)
+	var index Index
+	var err error
+	if info.Durable {
+		// Clear out anything left behind by a rebuild that didn't finish.
+		if err = removeIndexFiles(path + REBUILD_SUFFIX); err == nil {
+			index, err = openIndex(path+REBUILD_SUFFIX, indexType, info.pageSize())
+		}
+	} else {
+		index, err = openMemoryIndex(name, indexType)
+	}
+	if err != nil {
+		db.mtx.Unlock()
+		return err
+	}
+	rb := &rebuild{dirty: make(map[int64]bool)}
+	db.rebuilds[name] = rb
+	db.mtx.Unlock()
+	// Fill the new index, then catch up until few enough writes remain to apply
+	// them with writers blocked.
+	err = db.copyEntries(old, index)
+	for round := 0; err == nil && round < REBUILD_MAX_ROUNDS && rb.numDirty() > REBUILD_CHUNK_SIZE; round++ {
+		err = catchUp(old, index, rb.takeDirty())
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	delete(db.rebuilds, name)
+	if err == nil {
+		err = catchUp(old, index, rb.takeDirty())
+	}
+	if err != nil {
+		index.Close()
+		if info.Durable {
+			removeIndexFiles(path + REBUILD_SUFFIX)
+		}
+		return err
+	}
+	return db.swapIndex(name, old, index, indexType)
+}
+
+// Copy every entry of old into index. Btree cursors can't survive changes to the
+// tree, so a btree is read a chunk at a time with writers blocked, resuming after
+// the last key read; hash cursors read whole buckets and can be kept between chunks.
+func (db *Database) copyEntries(old Index, index Index) error {
+	tree, isBTree := old.(*btree.BTreeIndex)
+	var cursor utils.Cursor
+	var err, stepErr error
+	chunk := make([]utils.Entry, 0, REBUILD_CHUNK_SIZE)
+	for done := false; !done; {
+		db.mtx.Lock()
+		if cursor == nil {
+			cursor, err = old.TableStart()
+		} else if isBTree {
+			cursor, err = tree.TableFind(chunk[len(chunk)-1].GetKey() + 1)
+		}
+		if err != nil {
+			db.mtx.Unlock()
+			return err
+		}
+		chunk = chunk[:0]
+		for ; stepErr == nil && len(chunk) < REBUILD_CHUNK_SIZE; stepErr = cursor.StepForward() {
+			// A btree cursor may sit at the end of a leaf before moving to the next one.
+			if cursor.IsEnd() {
+				continue
+			}
+			entry, err := cursor.GetEntry()
+			if err != nil {
+				db.mtx.Unlock()
+				return err
+			}
+			chunk = append(chunk, entry)
+		}
+		db.mtx.Unlock()
+		done = stepErr != nil || chunk[len(chunk)-1].GetKey() == math.MaxInt64
+		for _, entry := range chunk {
+			if err = index.Upsert(entry.GetKey(), entry.GetValue()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Bring the given keys in index up to date with old.
+func catchUp(old Index, index Index, keys []int64) error {
+	for _, key := range keys {
+		entry, err := old.Find(key)
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			if err = index.Delete(key); err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = index.Upsert(key, entry.GetValue()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace a table's index with a rebuilt one. Expects db.mtx to be locked.
+func (db *Database) swapIndex(name string, old Index, index Index, indexType IndexType) error {
+	info := db.infos[name]
+	if info.Durable {
+		// Close both indexes so that their files are complete, then move the new
+		// files over the old ones. If that fails, the table can't be used.
+		path := filepath.Join(db.basepath, name)
+		old.Close()
+		delete(db.tables, name)
+		fail := func(err error) error {
+			db.closeTable(name)
+			delete(db.infos, name)
+			return err
+		}
+		if err := index.Close(); err != nil {
+			return fail(err)
+		}
+		for _, suffix := range indexFileSuffixes {
+			err := os.Rename(path+REBUILD_SUFFIX+suffix, path+suffix)
+			if os.IsNotExist(err) {
+				err = os.Remove(path + suffix)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return fail(err)
+			}
+		}
+		var err error
+		if index, err = openIndex(path, indexType, info.pageSize()); err != nil {
+			return fail(err)
+		}
+		index.GetPager().SetBufferSize(db.opts.NumPages)
+	} else {
+		old.Close()
+	}
+	info.Type = indexType
+	db.infos[name] = info
+	db.tables[name] = index
+	if info.Durable {
+		return db.writeCatalog()
+	}
+	return nil
+}
+
+// Remove the files backing an index, ignoring any that don't exist.
+func removeIndexFiles(path string) error {
+	for _, suffix := range indexFileSuffixes {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	heap "github.com/brown-csci1270/db/pkg/heap"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Column types.
+const (
+	INT_TYPE  = "int"
+	TEXT_TYPE = "text"
+)
+
+// A Row holds one value per column in a table's schema. Values are either int64 or string.
+type Row []interface{}
+
+// Parse a column list of the form "id int primary key, name text, ...".
+func parseSchema(def string) ([]Column, error) {
+	defs, err := splitList(def)
+	if err != nil {
+		return nil, err
+	}
+	alphanumeric, _ := regexp.Compile(`^\w+$`)
+	schema := make([]Column, 0, len(defs))
+	seen := make(map[string]bool)
+	numKeys := 0
+	for _, colDef := range defs {
+		fields := strings.Fields(colDef)
+		if len(fields) != 2 && !(len(fields) == 4 && fields[2] == "primary" && fields[3] == "key") {
+			return nil, fmt.Errorf("invalid column definition %q", colDef)
+		}
+		col := Column{Name: fields[0], Type: fields[1], PrimaryKey: len(fields) == 4}
+		if !alphanumeric.MatchString(col.Name) {
+			return nil, errors.New("column name must be alphanumeric")
+		}
+		if seen[col.Name] {
+			return nil, fmt.Errorf("duplicate column %s", col.Name)
+		}
+		seen[col.Name] = true
+		if col.Type != INT_TYPE && col.Type != TEXT_TYPE {
+			return nil, fmt.Errorf("invalid column type %s", col.Type)
+		}
+		if col.PrimaryKey {
+			if col.Type != INT_TYPE {
+				return nil, errors.New("primary key must be an int")
+			}
+			numKeys++
+		}
+		schema = append(schema, col)
+	}
+	if numKeys != 1 {
+		return nil, errors.New("table must have exactly one primary key")
+	}
+	return schema, nil
+}
+
+// Get the position of the primary key column.
+func (info TableInfo) primaryKey() int {
+	for i, col := range info.Schema {
+		if col.PrimaryKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get the position of the named column.
+func (info TableInfo) columnIndex(name string) (int, error) {
+	for i, col := range info.Schema {
+		if col.Name == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no column named %s", name)
+}
+
+// Parse a value for the given column. Text may be wrapped in single quotes.
+func parseValue(col Column, s string) (interface{}, error) {
+	switch col.Type {
+	case INT_TYPE:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int for column %s: %s", col.Name, s)
+		}
+		return v, nil
+	case TEXT_TYPE:
+		if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+			return s[1 : len(s)-1], nil
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("invalid column type %s", col.Type)
+	}
+}
+
+// Format a value for printing.
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return "'" + s + "'"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Split a comma-separated list, ignoring commas inside single quotes.
+func splitList(s string) ([]string, error) {
+	items := make([]string, 0)
+	inQuote := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case c == ',' && !inQuote:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quote")
+	}
+	return append(items, strings.TrimSpace(s[start:])), nil
+}
+
+// Find the first occurrence of substr in s that isn't inside single quotes, or -1.
+func indexOutsideQuotes(s string, substr string) int {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' {
+			inQuote = !inQuote
+		} else if !inQuote && strings.HasPrefix(s[i:], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Encode a row into bytes. Ints are stored as varints; text is stored as a length followed by its bytes.
+func encodeRow(schema []Column, row Row) ([]byte, error) {
+	if len(row) != len(schema) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(schema), len(row))
+	}
+	data := make([]byte, 0)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i, col := range schema {
+		switch col.Type {
+		case INT_TYPE:
+			v, ok := row[i].(int64)
+			if !ok {
+				return nil, fmt.Errorf("column %s must be an int", col.Name)
+			}
+			n := binary.PutVarint(buf, v)
+			data = append(data, buf[:n]...)
+		case TEXT_TYPE:
+			v, ok := row[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("column %s must be text", col.Name)
+			}
+			n := binary.PutUvarint(buf, uint64(len(v)))
+			data = append(data, buf[:n]...)
+			data = append(data, v...)
+		}
+	}
+	return data, nil
+}
+
+// Decode a row from bytes.
+func decodeRow(schema []Column, data []byte) (Row, error) {
+	row := make(Row, len(schema))
+	for i, col := range schema {
+		switch col.Type {
+		case INT_TYPE:
+			v, n := binary.Varint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("row is corrupted: %w", utils.ErrCorrupt)
+			}
+			row[i] = v
+			data = data[n:]
+		case TEXT_TYPE:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("row is corrupted: %w", utils.ErrCorrupt)
+			}
+			row[i] = string(data[n : n+int(length)])
+			data = data[n+int(length):]
+		}
+	}
+	return row, nil
+}
+
+// Get a row table's index, heap and catalog entry. Expects db.mtx to be locked.
+func (db *Database) getRowTable(name string) (Index, *heap.HeapFile, TableInfo, error) {
+	index, ok := db.tables[name]
+	if !ok {
+		return nil, nil, TableInfo{}, utils.ErrTableNotFound
+	}
+	info := db.infos[name]
+	if !info.IsRowTable() {
+		return nil, nil, TableInfo{}, fmt.Errorf("%s is not a row table", name)
+	}
+	return index, db.heaps[name], info, nil
+}
+
+// Open the heap backing a row table.
+func openHeap(path string, info TableInfo) (*heap.HeapFile, error) {
+	if !info.Durable {
+		return heap.OpenMemoryHeapFile(info.Name + heap.HEAP_SUFFIX), nil
+	}
+	return heap.OpenHeapFileWithPageSize(path+heap.HEAP_SUFFIX, info.pageSize())
+}
+
+// Read the row that an index entry points to.
+func readRow(hf *heap.HeapFile, info TableInfo, rid int64) (Row, error) {
+	data, err := hf.Read(rid)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRow(info.Schema, data)
+}
+
+// Insert a row into a row table.
+func (db *Database) InsertRow(name string, row Row) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	index, hf, info, err := db.getRowTable(name)
+	if err != nil {
+		return err
+	}
+	data, err := encodeRow(info.Schema, row)
+	if err != nil {
+		return err
+	}
+	key := row[info.primaryKey()].(int64)
+	defer db.markDirty(name, key)
+	// Skip writing the row if the key is clearly taken; the index has the final
+	// say, since another insert may race us between here and index.Insert.
+	if entry, _ := index.Find(key); entry != nil {
+		return utils.ErrKeyExists
+	}
+	rid, err := hf.Append(data)
+	if err != nil {
+		return err
+	}
+	return index.Insert(key, rid)
+}
+
+// Find the row with the given primary key.
+func (db *Database) FindRow(name string, key int64) (Row, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	index, hf, info, err := db.getRowTable(name)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := index.Find(key)
+	if err != nil {
+		return nil, err
+	}
+	return readRow(hf, info, entry.GetValue())
+}
+
+// Update the named columns of the row with the given primary key.
+func (db *Database) UpdateRow(name string, key int64, values map[string]interface{}) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	index, hf, info, err := db.getRowTable(name)
+	if err != nil {
+		return err
+	}
+	defer db.markDirty(name, key)
+	columns := make(map[int]interface{}, len(values))
+	for colName, v := range values {
+		i, err := info.columnIndex(colName)
+		if err != nil {
+			return err
+		}
+		if i == info.primaryKey() {
+			return errors.New("cannot update the primary key")
+		}
+		columns[i] = v
+	}
+	// Rows are never updated in place; write a new version and point the index
+	// at it, unless another update replaced the row first, in which case apply
+	// ours on top of theirs.
+	for {
+		entry, err := index.Find(key)
+		if err != nil {
+			return err
+		}
+		row, err := readRow(hf, info, entry.GetValue())
+		if err != nil {
+			return err
+		}
+		for i, v := range columns {
+			row[i] = v
+		}
+		data, err := encodeRow(info.Schema, row)
+		if err != nil {
+			return err
+		}
+		rid, err := hf.Append(data)
+		if err != nil {
+			return err
+		}
+		if swapped, err := index.CompareAndSwap(key, entry.GetValue(), rid); err != nil || swapped {
+			return err
+		}
+	}
+}
+
+// Select all rows from a row table, in primary key order for btree tables.
+func (db *Database) SelectRows(name string) ([]Row, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	index, hf, info, err := db.getRowTable(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := index.Select()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]Row, 0, len(entries))
+	for _, entry := range entries {
+		row, err := readRow(hf, info, entry.GetValue())
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Rewrite a row table's heap with only the rows its index points to. Updates
+// append new versions of rows and never reclaim the old ones, so the heap keeps
+// growing until it is compacted. Writers are blocked while the table is rewritten.
+func (db *Database) CompactRows(name string) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	old, oldHeap, info, err := db.getRowTable(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := db.rebuilds[name]; ok {
+		return fmt.Errorf("%s is being rebuilt", name)
+	}
+	// Copy the live rows into a new heap and index, since every row moves.
+	path := filepath.Join(db.basepath, name)
+	var index Index
+	var hf *heap.HeapFile
+	if info.Durable {
+		// Clear out anything left behind by a compaction that didn't finish.
+		if err = removeIndexFiles(path + REBUILD_SUFFIX); err != nil {
+			return err
+		}
+		if err = os.Remove(path + REBUILD_SUFFIX + heap.HEAP_SUFFIX); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if index, err = openIndex(path+REBUILD_SUFFIX, info.Type, info.pageSize()); err != nil {
+			return err
+		}
+		hf, err = heap.OpenHeapFileWithPageSize(path+REBUILD_SUFFIX+heap.HEAP_SUFFIX, info.pageSize())
+	} else {
+		if index, err = openMemoryIndex(name, info.Type); err != nil {
+			return err
+		}
+		hf = heap.OpenMemoryHeapFile(name + heap.HEAP_SUFFIX)
+	}
+	if err == nil {
+		err = scanIndex(old, func(entry utils.Entry) error {
+			data, err := oldHeap.Read(entry.GetValue())
+			if err != nil {
+				return err
+			}
+			rid, err := hf.Append(data)
+			if err != nil {
+				return err
+			}
+			return index.Insert(entry.GetKey(), rid)
+		})
+	}
+	if err != nil {
+		index.Close()
+		if hf != nil {
+			hf.Close()
+		}
+		if info.Durable {
+			removeIndexFiles(path + REBUILD_SUFFIX)
+			os.Remove(path + REBUILD_SUFFIX + heap.HEAP_SUFFIX)
+		}
+		return err
+	}
+	if !info.Durable {
+		old.Close()
+		oldHeap.Close()
+		index.GetPager().SetBufferSize(db.opts.NumPages)
+		hf.GetPager().SetBufferSize(db.opts.NumPages)
+		db.tables[name] = index
+		db.heaps[name] = hf
+		return nil
+	}
+	// Close everything so that the files are complete, then move the new files
+	// over the old ones. If that fails, the table can't be used.
+	fail := func(err error) error {
+		delete(db.infos, name)
+		return err
+	}
+	db.closeTable(name)
+	if err = index.Close(); err != nil {
+		return fail(err)
+	}
+	if err = hf.Close(); err != nil {
+		return fail(err)
+	}
+	for _, suffix := range append([]string{heap.HEAP_SUFFIX}, indexFileSuffixes...) {
+		err := os.Rename(path+REBUILD_SUFFIX+suffix, path+suffix)
+		if os.IsNotExist(err) {
+			err = os.Remove(path + suffix)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fail(err)
+		}
+	}
+	if err = db.openTable(info); err != nil {
+		return fail(err)
+	}
+	return nil
+}
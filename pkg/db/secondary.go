@@ -0,0 +1,269 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	btree "github.com/brown-csci1270/db/pkg/btree"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Suffixes of the files storing a table's secondary index on values.
+const SECONDARY_HEADS_SUFFIX = ".vidx"
+const SECONDARY_NEXT_SUFFIX = ".vnext"
+const SECONDARY_PREV_SUFFIX = ".vprev"
+
+// SecondaryIndex maps values to the keys holding them. Since many keys may share a
+// value, the keys for each value form a doubly linked list: heads maps each value
+// to the first key in its list, and next and prev map each key to the keys after
+// and before it, if any.
+type SecondaryIndex struct {
+	heads *btree.BTreeIndex
+	next  *btree.BTreeIndex
+	prev  *btree.BTreeIndex
+	mtx   sync.Mutex // Serializes changes to the lists.
+}
+
+// Opens the secondary index stored alongside the table at the given path, made
+// of pages of the given size.
+func OpenSecondaryIndex(path string, pageSize int64) (*SecondaryIndex, error) {
+	return openSecondaryIndex(path, func(filename string) (*btree.BTreeIndex, error) {
+		return btree.OpenTableWithPageSize(filename, pageSize)
+	})
+}
+
+// Creates a secondary index that lives only in memory.
+func OpenMemorySecondaryIndex(name string) (*SecondaryIndex, error) {
+	return openSecondaryIndex(name, btree.OpenMemoryTable)
+}
+
+// Open the three btrees of a secondary index with the given opener, closing
+// any already opened if one fails.
+func openSecondaryIndex(name string, open func(string) (*btree.BTreeIndex, error)) (*SecondaryIndex, error) {
+	suffixes := []string{SECONDARY_HEADS_SUFFIX, SECONDARY_NEXT_SUFFIX, SECONDARY_PREV_SUFFIX}
+	tables := make([]*btree.BTreeIndex, 0, len(suffixes))
+	for _, suffix := range suffixes {
+		table, err := open(name + suffix)
+		if err != nil {
+			for _, opened := range tables {
+				opened.Close()
+			}
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return &SecondaryIndex{heads: tables[0], next: tables[1], prev: tables[2]}, nil
+}
+
+// Remove the files of the secondary index stored alongside the table at the given path.
+func removeSecondaryIndex(path string) error {
+	for _, suffix := range []string{SECONDARY_HEADS_SUFFIX, SECONDARY_NEXT_SUFFIX, SECONDARY_PREV_SUFFIX} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set the number of pages each of the index's files buffers.
+func (index *SecondaryIndex) setBufferSize(n int) {
+	index.heads.GetPager().SetBufferSize(n)
+	index.next.GetPager().SetBufferSize(n)
+	index.prev.GetPager().SetBufferSize(n)
+}
+
+// Closes the secondary index.
+func (index *SecondaryIndex) Close() error {
+	err := index.heads.Close()
+	if nextErr := index.next.Close(); err == nil {
+		err = nextErr
+	}
+	if prevErr := index.prev.Close(); err == nil {
+		err = prevErr
+	}
+	return err
+}
+
+// [CONCURRENCY] Lock the secondary index.
+func (index *SecondaryIndex) Lock() {
+	index.mtx.Lock()
+}
+
+// [CONCURRENCY] Unlock the secondary index.
+func (index *SecondaryIndex) Unlock() {
+	index.mtx.Unlock()
+}
+
+// Record that the given key holds the given value. Expects the index to be locked.
+func (index *SecondaryIndex) Insert(key int64, value int64) error {
+	head, err := index.heads.Find(value)
+	if err != nil {
+		// First key with this value.
+		return index.heads.Insert(value, key)
+	}
+	// Push the key onto the front of the list.
+	if err = index.next.Insert(key, head.GetValue()); err != nil {
+		return err
+	}
+	if err = index.prev.Insert(head.GetValue(), key); err != nil {
+		return err
+	}
+	return index.heads.Update(value, key)
+}
+
+// Remove the record that the given key holds the given value. Expects the index to be locked.
+func (index *SecondaryIndex) Delete(key int64, value int64) error {
+	if _, err := index.heads.Find(value); err != nil {
+		return fmt.Errorf("secondary index is missing a value: %w", utils.ErrCorrupt)
+	}
+	next, err := index.next.Find(key)
+	hasNext := err == nil
+	prev, err := index.prev.Find(key)
+	hasPrev := err == nil
+	// Point the key before ours, or the head of the list, past it.
+	switch {
+	case hasPrev && hasNext:
+		err = index.next.Update(prev.GetValue(), next.GetValue())
+	case hasPrev:
+		err = index.next.Delete(prev.GetValue())
+	case hasNext:
+		err = index.heads.Update(value, next.GetValue())
+	default:
+		err = index.heads.Delete(value)
+	}
+	if err != nil {
+		return err
+	}
+	// Point the key after ours back past it.
+	if hasNext {
+		if hasPrev {
+			err = index.prev.Update(next.GetValue(), prev.GetValue())
+		} else {
+			err = index.prev.Delete(next.GetValue())
+		}
+		if err != nil {
+			return err
+		}
+		if err = index.next.Delete(key); err != nil {
+			return err
+		}
+	}
+	if hasPrev {
+		return index.prev.Delete(key)
+	}
+	return nil
+}
+
+// Find all keys holding the given value. Expects the index to be locked.
+func (index *SecondaryIndex) Find(value int64) ([]int64, error) {
+	keys := make([]int64, 0)
+	head, err := index.heads.Find(value)
+	if err != nil {
+		return keys, nil
+	}
+	for key := head.GetValue(); ; {
+		keys = append(keys, key)
+		next, err := index.next.Find(key)
+		if err != nil {
+			break
+		}
+		key = next.GetValue()
+	}
+	return keys, nil
+}
+
+// Create a secondary index on the given column of a key/value table, and fill it
+// with the table's current entries.
+func (db *Database) CreateIndex(name string, column string) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	table, ok := db.tables[name]
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	info := db.infos[name]
+	if info.IsRowTable() {
+		return errors.New("secondary indexes are only supported on key/value tables")
+	}
+	if column != "value" {
+		return fmt.Errorf("can only index column value, not %s", column)
+	}
+	if _, ok := db.secondaries[name]; ok {
+		return fmt.Errorf("%s already has an index on %s", name, column)
+	}
+	var secondary *SecondaryIndex
+	var err error
+	path := filepath.Join(db.basepath, name)
+	if info.Durable {
+		// Clear out any files left by an index that failed to build.
+		if err = removeSecondaryIndex(path); err != nil {
+			return err
+		}
+		secondary, err = OpenSecondaryIndex(path, info.pageSize())
+	} else {
+		secondary, err = OpenMemorySecondaryIndex(name)
+	}
+	if err != nil {
+		return err
+	}
+	// Index every entry; writers are blocked until we're done.
+	err = scanIndex(table, func(entry utils.Entry) error {
+		return secondary.Insert(entry.GetKey(), entry.GetValue())
+	})
+	if err != nil {
+		secondary.Close()
+		if info.Durable {
+			removeSecondaryIndex(path)
+		}
+		return err
+	}
+	secondary.setBufferSize(db.opts.NumPages)
+	db.secondaries[name] = secondary
+	info.Indexes = append(info.Indexes, column)
+	db.infos[name] = info
+	if info.Durable {
+		return db.writeCatalog()
+	}
+	return nil
+}
+
+// Find all entries in a key/value table with the given value. Uses the table's
+// secondary index if it has one, else scans the whole table.
+func (db *Database) FindByValue(name string, value int64) ([]utils.Entry, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, secondary, err := db.getKeyValueTable(name)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]utils.Entry, 0)
+	if secondary == nil {
+		entries, err := table.Select()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.GetValue() == value {
+				results = append(results, entry)
+			}
+		}
+		return results, nil
+	}
+	secondary.Lock()
+	defer secondary.Unlock()
+	keys, err := secondary.Find(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		entry, err := table.Find(key)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, entry)
+	}
+	return results, nil
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	heap "github.com/brown-csci1270/db/pkg/heap"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Format is a file format that tables can be exported to and imported from.
+type Format int64
+
+const (
+	CSVFormat    Format = 0 // A header row of column names, then one row per entry.
+	JSONLFormat  Format = 1 // One JSON object per line, keyed by column name.
+	BinaryFormat Format = 2 // A header describing the columns, then length-prefixed encoded rows.
+)
+
+// Imports write key/value entries in batches of this size.
+const IMPORT_BATCH_SIZE = 1024
+
+// Binary dumps start with this.
+const dumpMagic = "BUMBLEDUMP1\n"
+
+// Get the name of a format.
+func (format Format) String() string {
+	switch format {
+	case CSVFormat:
+		return "csv"
+	case JSONLFormat:
+		return "jsonl"
+	case BinaryFormat:
+		return "bin"
+	default:
+		return fmt.Sprintf("Format(%d)", int64(format))
+	}
+}
+
+// Parse a format from its name.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "csv":
+		return CSVFormat, nil
+	case "jsonl", "json":
+		return JSONLFormat, nil
+	case "bin", "dump":
+		return BinaryFormat, nil
+	default:
+		return 0, fmt.Errorf("invalid format %q", s)
+	}
+}
+
+// Get the format of a file from its extension.
+func FormatFromPath(path string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// Get the columns of a table; key/value tables have a key and a value column.
+func (info TableInfo) columns() []Column {
+	if info.IsRowTable() {
+		return info.Schema
+	}
+	return keyValueSchema()
+}
+
+// Call fn on each row of a table, in key order for btree tables. Entries in
+// key/value tables are passed as rows of their key and value.
+func (db *Database) scanRows(name string, fn func(Row) error) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	table, ok := db.tables[name]
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	info := db.infos[name]
+	hf := db.heaps[name]
+	return scanIndex(table, func(entry utils.Entry) (err error) {
+		row := Row{entry.GetKey(), entry.GetValue()}
+		if info.IsRowTable() {
+			if row, err = readRow(hf, info, entry.GetValue()); err != nil {
+				return err
+			}
+		}
+		return fn(row)
+	})
+}
+
+// Write every row of a table to w in the given format, one row at a time.
+func (db *Database) Export(name string, format Format, w io.Writer) error {
+	info, ok := db.GetTableInfo(name)
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	schema := info.columns()
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case CSVFormat:
+		cw := csv.NewWriter(bw)
+		record := make([]string, len(schema))
+		for i, col := range schema {
+			record[i] = col.Name
+		}
+		if err = cw.Write(record); err != nil {
+			return err
+		}
+		err = db.scanRows(name, func(row Row) error {
+			for i, v := range row {
+				record[i] = fmt.Sprintf("%v", v)
+			}
+			return cw.Write(record)
+		})
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+	case JSONLFormat:
+		err = db.scanRows(name, func(row Row) error {
+			// Write the fields by hand to keep them in schema order.
+			bw.WriteByte('{')
+			for i, col := range schema {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				name, _ := json.Marshal(col.Name)
+				value, err := json.Marshal(row[i])
+				if err != nil {
+					return err
+				}
+				bw.Write(name)
+				bw.WriteByte(':')
+				bw.Write(value)
+			}
+			_, err := bw.WriteString("}\n")
+			return err
+		})
+	case BinaryFormat:
+		bw.WriteString(dumpMagic)
+		buf := make([]byte, binary.MaxVarintLen64)
+		writeBytes := func(data []byte) {
+			n := binary.PutUvarint(buf, uint64(len(data)))
+			bw.Write(buf[:n])
+			bw.Write(data)
+		}
+		n := binary.PutUvarint(buf, uint64(len(schema)))
+		bw.Write(buf[:n])
+		for _, col := range schema {
+			writeBytes([]byte(col.Name))
+			writeBytes([]byte(col.Type))
+		}
+		err = db.scanRows(name, func(row Row) error {
+			data, err := encodeRow(schema, row)
+			if err != nil {
+				return err
+			}
+			writeBytes(data)
+			return nil
+		})
+	default:
+		return fmt.Errorf("invalid format %v", format)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Read rows from r in the given format and write them to a table, one batch at a time.
+// Rows replace any existing rows with the same key.
+func (db *Database) Import(name string, format Format, r io.Reader) error {
+	info, ok := db.GetTableInfo(name)
+	if !ok {
+		return utils.ErrTableNotFound
+	}
+	var next func() (Row, error)
+	var err error
+	switch format {
+	case CSVFormat:
+		next, err = csvRowReader(info.columns(), r)
+	case JSONLFormat:
+		next, err = jsonlRowReader(info.columns(), r)
+	case BinaryFormat:
+		next, err = binaryRowReader(info.columns(), heap.MaxRecordSize(info.pageSize()), r)
+	default:
+		return fmt.Errorf("invalid format %v", format)
+	}
+	if err != nil {
+		return err
+	}
+	batch := utils.NewWriteBatch()
+	for i := 1; ; i++ {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+		if info.IsRowTable() {
+			if err = db.replaceRow(info, row); err != nil {
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+			continue
+		}
+		batch.Put(row[0].(int64), row[1].(int64))
+		if batch.Len() >= IMPORT_BATCH_SIZE {
+			if err = db.ApplyBatch(name, batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if batch.Len() > 0 {
+		return db.ApplyBatch(name, batch)
+	}
+	return nil
+}
+
+// Insert a row, or overwrite the row with the same primary key.
+func (db *Database) replaceRow(info TableInfo, row Row) error {
+	err := db.InsertRow(info.Name, row)
+	if !errors.Is(err, utils.ErrKeyExists) {
+		return err
+	}
+	key := info.primaryKey()
+	values := make(map[string]interface{})
+	for i, col := range info.Schema {
+		if i != key {
+			values[col.Name] = row[i]
+		}
+	}
+	return db.UpdateRow(info.Name, row[key].(int64), values)
+}
+
+// Parse a field from an imported file. Unlike parseValue, text is taken as is.
+func parseField(col Column, s string) (interface{}, error) {
+	if col.Type == TEXT_TYPE {
+		return s, nil
+	}
+	return parseValue(col, s)
+}
+
+// Returns a function that reads the next row from CSV with a header row.
+func csvRowReader(schema []Column, r io.Reader) (func() (Row, error), error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+	// Work out which field holds each column.
+	if len(header) != len(schema) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(schema), len(header))
+	}
+	positions := make([]int, len(schema))
+	for i, col := range schema {
+		positions[i] = -1
+		for j, name := range header {
+			if strings.TrimSpace(name) == col.Name {
+				positions[i] = j
+			}
+		}
+		if positions[i] == -1 {
+			return nil, fmt.Errorf("missing column %s", col.Name)
+		}
+	}
+	return func() (Row, error) {
+		record, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		row := make(Row, len(schema))
+		for i, col := range schema {
+			if row[i], err = parseField(col, record[positions[i]]); err != nil {
+				return nil, err
+			}
+		}
+		return row, nil
+	}, nil
+}
+
+// Returns a function that reads the next row from JSON objects keyed by column name.
+func jsonlRowReader(schema []Column, r io.Reader) (func() (Row, error), error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	return func() (Row, error) {
+		obj := make(map[string]interface{})
+		if err := dec.Decode(&obj); err != nil {
+			return nil, err
+		}
+		if len(obj) != len(schema) {
+			return nil, fmt.Errorf("expected %d columns, got %d", len(schema), len(obj))
+		}
+		row := make(Row, len(schema))
+		for i, col := range schema {
+			v, ok := obj[col.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing column %s", col.Name)
+			}
+			switch v := v.(type) {
+			case json.Number:
+				if col.Type != INT_TYPE {
+					return nil, fmt.Errorf("column %s must be text", col.Name)
+				}
+				n, err := strconv.ParseInt(string(v), 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid int for column %s: %s", col.Name, v)
+				}
+				row[i] = n
+			case string:
+				if col.Type != TEXT_TYPE {
+					return nil, fmt.Errorf("column %s must be an int", col.Name)
+				}
+				row[i] = v
+			default:
+				return nil, fmt.Errorf("invalid value for column %s", col.Name)
+			}
+		}
+		return row, nil
+	}, nil
+}
+
+// Returns a function that reads the next row from a binary dump.
+func binaryRowReader(schema []Column, maxRecordSize int64, r io.Reader) (func() (Row, error), error) {
+	br := bufio.NewReader(r)
+	readBytes := func() ([]byte, error) {
+		length, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		// Don't trust the length before allocating for it; no record can be bigger than a heap record.
+		if length > uint64(maxRecordSize) {
+			return nil, fmt.Errorf("dump has a %d-byte record: %w", length, utils.ErrCorrupt)
+		}
+		data := make([]byte, length)
+		if _, err = io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("dump is truncated: %w", utils.ErrCorrupt)
+		}
+		return data, nil
+	}
+	// Check that the dump's columns match the table's.
+	magic := make([]byte, len(dumpMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != dumpMagic {
+		return nil, errors.New("not a binary dump")
+	}
+	numCols, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("dump is truncated: %w", utils.ErrCorrupt)
+	}
+	if numCols != uint64(len(schema)) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(schema), numCols)
+	}
+	for _, col := range schema {
+		name, err := readBytes()
+		if err != nil {
+			return nil, fmt.Errorf("dump is truncated: %w", utils.ErrCorrupt)
+		}
+		colType, err := readBytes()
+		if err != nil {
+			return nil, fmt.Errorf("dump is truncated: %w", utils.ErrCorrupt)
+		}
+		if string(name) != col.Name || string(colType) != col.Type {
+			return nil, fmt.Errorf("expected column %s %s, got %s %s", col.Name, col.Type, name, colType)
+		}
+	}
+	return func() (Row, error) {
+		data, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return decodeRow(schema, data)
+	}, nil
+}
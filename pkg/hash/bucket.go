@@ -1,7 +1,6 @@
 package hash
 
 import (
-	"errors"
 	"fmt"
 	"io"
 
@@ -55,7 +54,7 @@ func (bucket *HashBucket) Insert(key int64, value int64) (bool, error) {
 	/* SOLUTION {{{ */
 	bucket.modifyCell(bucket.numKeys, HashEntry{key: key, value: value})
 	bucket.updateNumKeys(bucket.numKeys + 1)
-	return bucket.numKeys >= BUCKETSIZE, nil
+	return bucket.numKeys >= bucketSize(bucket.page.GetPager().GetPageSize()), nil
 	/* SOLUTION }}} */
 }
 
@@ -71,7 +70,7 @@ func (bucket *HashBucket) Update(key int64, value int64) error {
 		}
 	}
 	if index == -1 {
-		return errors.New("key not found, update aborted")
+		return fmt.Errorf("update aborted: %w", utils.ErrKeyNotFound)
 	}
 	// Update the value.
 	bucket.updateValueAt(index, value)
@@ -91,7 +90,7 @@ func (bucket *HashBucket) Delete(key int64) error {
 		}
 	}
 	if index == -1 {
-		return errors.New("key not found, delete aborted")
+		return fmt.Errorf("delete aborted: %w", utils.ErrKeyNotFound)
 	}
 	// Move all other keys left by one.
 	for i := index; i < bucket.numKeys; i++ {
@@ -123,6 +122,16 @@ func (bucket *HashBucket) Print(w io.Writer) {
 	io.WriteString(w, "\n")
 }
 
+// [CONCURRENCY] Release whichever lock was grabbed on the bucket
+func (bucket *HashBucket) unlock(lock BucketLockType) {
+	if lock == READ_LOCK {
+		bucket.RUnlock()
+	}
+	if lock == WRITE_LOCK {
+		bucket.WUnlock()
+	}
+}
+
 // [CONCURRENCY] Grab a write lock on the hash table index
 func (bucket *HashBucket) WLock() {
 	bucket.page.WLock()
@@ -1,64 +1,123 @@
 package hash
 
 import (
+	"encoding/base64"
+	"encoding/binary"
 	"errors"
+	"sort"
 
 	utils "github.com/brown-csci1270/db/pkg/utils"
 )
 
 // HashCursor points to a spot in the hash table.
+// The cursor visits directory indices in order, using the global depth at the time
+// the scan started. Each index is read in full when the cursor reaches it, so splits
+// and directory doublings during the scan cannot cause entries to be skipped or
+// returned twice.
 type HashCursor struct {
-	table     *HashIndex
-	cellnum   int64
-	isEnd     bool
-	curBucket *HashBucket
+	table   *HashIndex
+	depth   int64         // Global depth when the scan started.
+	slot    int64         // Directory index currently being visited.
+	cellnum int64         // Position within the current directory index.
+	isEnd   bool          // Indicates that the whole table has been visited.
+	entries []utils.Entry // Entries in the current directory index, sorted by key.
 }
 
 // TableStart returns a cursor to the first entry in the hash table.
 func (table *HashIndex) TableStart() (utils.Cursor, error) {
-	cursor := HashCursor{table: table, cellnum: 0}
+	cursor := HashCursor{table: table, depth: table.table.GetDepth()}
+	if err := cursor.seek(0, 0, false); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
 
-	curPage, err := table.pager.GetPage(ROOT_PN)
+// TableResume returns a cursor to the position described by a token from HashCursor.Position.
+// If the entry at that position has since been deleted, the cursor points to the entry after it.
+func (table *HashIndex) TableResume(token string) (utils.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
 	if err != nil {
+		return nil, errors.New("invalid cursor position")
+	}
+	fields := make([]int64, 3)
+	for i := range fields {
+		var n int
+		fields[i], n = binary.Varint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid cursor position")
+		}
+		data = data[n:]
+	}
+	depth, slot, key := fields[0], fields[1], fields[2]
+	// The directory only ever grows, so a real token's depth is no deeper than it.
+	if depth < 0 || depth > table.table.GetDepth() || slot < 0 || slot >= powInt(2, depth) {
+		return nil, errors.New("invalid cursor position")
+	}
+	cursor := HashCursor{table: table, depth: depth}
+	if err := cursor.seek(slot, key, true); err != nil {
 		return nil, err
 	}
-	defer curPage.Put()
-	cursor.curBucket = pageToBucket(curPage)
-	cursor.isEnd = (cursor.curBucket.numKeys == 0)
 	return &cursor, nil
 }
 
-// StepForward moves the cursor ahead by one entry.
-func (cursor *HashCursor) StepForward() error {
-	// If the cursor is at the end of the bucket, try visiting the next bucket.
-	if cursor.isEnd {
-		// Get the next page number.
-		nextPN := cursor.curBucket.page.GetPageNum() + 1
-		if nextPN >= cursor.curBucket.page.GetPager().GetNumPages() {
-			return errors.New("cannot advance the cursor further")
-		}
-		// Convert the page to a bucket.
-		nextPage, err := cursor.table.pager.GetPage(nextPN)
+// Position returns a token that TableResume can use to recreate this cursor.
+func (cursor *HashCursor) Position() string {
+	var key int64
+	if !cursor.isEnd {
+		key = cursor.entries[cursor.cellnum].GetKey()
+	}
+	data := make([]byte, 0, 3*binary.MaxVarintLen64)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, v := range []int64{cursor.depth, cursor.slot, key} {
+		n := binary.PutVarint(buf, v)
+		data = append(data, buf[:n]...)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// seek moves the cursor to the first entry at or after the given directory index.
+// If fromKey is set, entries in that first index with smaller keys are skipped.
+func (cursor *HashCursor) seek(slot int64, key int64, fromKey bool) error {
+	numSlots := powInt(2, cursor.depth)
+	for ; slot < numSlots; slot++ {
+		entries, err := cursor.table.table.selectHash(cursor.depth, slot)
 		if err != nil {
 			return err
 		}
-		defer nextPage.Put()
-		nextBucket := pageToBucket(nextPage)
-		// Reinitialize the cursor.
-		cursor.cellnum = 0
-		cursor.isEnd = (cursor.cellnum == nextBucket.numKeys)
-		cursor.curBucket = nextBucket
-		if cursor.isEnd {
-			return cursor.StepForward()
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].GetKey() < entries[j].GetKey()
+		})
+		if fromKey {
+			entries = entries[sort.Search(len(entries), func(i int) bool {
+				return entries[i].GetKey() >= key
+			}):]
+			fromKey = false
+		}
+		if len(entries) > 0 {
+			cursor.slot = slot
+			cursor.cellnum = 0
+			cursor.entries = entries
+			cursor.isEnd = false
+			return nil
 		}
-		return nil
 	}
-	// Else, just move the cursor forward.
+	cursor.slot = numSlots
+	cursor.entries = nil
+	cursor.isEnd = true
+	return nil
+}
+
+// StepForward moves the cursor ahead by one entry.
+func (cursor *HashCursor) StepForward() error {
+	if cursor.isEnd {
+		return errors.New("cannot advance the cursor further")
+	}
+	// Move within the current directory index if we can, else visit the next one.
 	cursor.cellnum++
-	if cursor.cellnum >= cursor.curBucket.numKeys {
-		cursor.isEnd = true
+	if cursor.cellnum < int64(len(cursor.entries)) {
+		return nil
 	}
-	return nil
+	return cursor.seek(cursor.slot+1, 0, false)
 }
 
 // IsEnd returns true if at end.
@@ -71,6 +130,5 @@ func (cursor *HashCursor) GetEntry() (utils.Entry, error) {
 	if cursor.isEnd {
 		return HashEntry{}, errors.New("getEntry: entry is non-existent")
 	}
-	entry := cursor.curBucket.getCell(cursor.cellnum)
-	return entry, nil
+	return cursor.entries[cursor.cellnum], nil
 }
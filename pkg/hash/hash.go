@@ -15,9 +15,17 @@ type HashIndex struct {
 
 // Opens the pager with the given table name.
 func OpenTable(filename string) (*HashIndex, error) {
+	return OpenTableWithPageSize(filename, pager.PAGESIZE)
+}
+
+// Opens the pager with the given table name, with buckets of the given page size.
+func OpenTableWithPageSize(filename string, pageSize int64) (*HashIndex, error) {
 	// Create a pager for the table.
-	pager := pager.NewPager()
-	err := pager.Open(filename)
+	pager, err := pager.NewPagerWithPageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+	err = pager.Open(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +42,17 @@ func OpenTable(filename string) (*HashIndex, error) {
 	return &HashIndex{table: table, pager: pager}, nil
 }
 
+// Creates a table that lives only in memory under the given name.
+func OpenMemoryTable(name string) (*HashIndex, error) {
+	pager := pager.NewPager()
+	pager.OpenAnonymous(name)
+	table, err := NewHashTable(pager)
+	if err != nil {
+		return nil, err
+	}
+	return &HashIndex{table: table, pager: pager}, nil
+}
+
 // Get name.
 func (table *HashIndex) GetName() string {
 	return table.pager.GetFileName()
@@ -69,6 +88,21 @@ func (index *HashIndex) Update(key int64, value int64) error {
 	return index.table.Update(key, value)
 }
 
+// Insert given element, or update it if it exists.
+func (index *HashIndex) Upsert(key int64, value int64) error {
+	return index.table.Upsert(key, value)
+}
+
+// Update given element if it holds the expected value.
+func (index *HashIndex) CompareAndSwap(key int64, expected int64, value int64) (bool, error) {
+	return index.table.CompareAndSwap(key, expected, value)
+}
+
+// Apply a batch of writes.
+func (index *HashIndex) ApplyBatch(batch *utils.WriteBatch) error {
+	return index.table.ApplyBatch(batch)
+}
+
 // Delete given element.
 func (index *HashIndex) Delete(key int64) error {
 	return index.table.Delete(key)
@@ -79,6 +113,11 @@ func (index *HashIndex) Select() ([]utils.Entry, error) {
 	return index.table.Select()
 }
 
+// Get statistics on the shape of the table.
+func (index *HashIndex) Stats() (HashStats, error) {
+	return index.table.Stats()
+}
+
 // Print all elements.
 func (index *HashIndex) Print(w io.Writer) {
 	index.table.Print(w)
@@ -10,15 +10,18 @@ import (
 
 // Hash table variables
 var ROOT_PN int64 = 0
-var PAGESIZE int64 = pager.PAGESIZE
 var DIRECTORY_HEADER_SIZE int64 = binary.MaxVarintLen64 * 2 // Must store global depth and next pointer
 var DEPTH_OFFSET int64 = 0
 var DEPTH_SIZE int64 = binary.MaxVarintLen64
 var NUM_KEYS_OFFSET int64 = DEPTH_OFFSET + DEPTH_SIZE
 var NUM_KEYS_SIZE int64 = binary.MaxVarintLen64
 var BUCKET_HEADER_SIZE int64 = DEPTH_SIZE + NUM_KEYS_SIZE
-var ENTRYSIZE int64 = binary.MaxVarintLen64 * 2                    // int64 key, int64 value
-var BUCKETSIZE int64 = (PAGESIZE - BUCKET_HEADER_SIZE) / ENTRYSIZE // num entries
+var ENTRYSIZE int64 = binary.MaxVarintLen64 * 2 // int64 key, int64 value
+
+// Number of entries that fit in a bucket on a page of the given size.
+func bucketSize(pageSize int64) int64 {
+	return (pageSize - BUCKET_HEADER_SIZE) / ENTRYSIZE
+}
 
 // Lock Types
 type BucketLockType int
@@ -146,7 +149,7 @@ func (table *HashTable) GetBucketByPN(pn int64, lock BucketLockType) (*HashBucke
 
 // Returns the bucket in the hash table, and increments the bucket ref count.
 func (table *HashTable) GetBucket(hash int64, lock BucketLockType) (*HashBucket, error) {
-	pagenum := table.buckets[hash]
+	pagenum := table.getDirectory().buckets[hash]
 	bucket, err := table.GetBucketByPN(pagenum, lock)
 	if err != nil {
 		return nil, err
@@ -156,8 +159,11 @@ func (table *HashTable) GetBucket(hash int64, lock BucketLockType) (*HashBucket,
 
 // Read hash table in from memory.
 func ReadHashTable(bucketPager *pager.Pager) (*HashTable, error) {
-	indexPager := pager.NewPager()
-	err := indexPager.Open(bucketPager.GetFileName() + ".meta")
+	indexPager, err := pager.NewPagerWithPageSize(bucketPager.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+	err = indexPager.Open(bucketPager.GetFilePath() + ".meta")
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +180,7 @@ func ReadHashTable(bucketPager *pager.Pager) (*HashTable, error) {
 	numHashes := powInt(2, depth)
 	buckets := make([]int64, numHashes)
 	for i := int64(0); i < numHashes; i++ {
-		if bytesRead+pnSize > PAGESIZE {
+		if bytesRead+pnSize > indexPager.GetPageSize() {
 			page.Put()
 			metaPN++
 			page, err = indexPager.GetPage(metaPN)
@@ -189,35 +195,40 @@ func ReadHashTable(bucketPager *pager.Pager) (*HashTable, error) {
 	}
 	page.Put()
 	indexPager.Close()
-	return &HashTable{depth: depth, buckets: buckets, pager: bucketPager}, nil
+	return newHashTable(bucketPager, depth, buckets), nil
 }
 
 // Write hash table out to memory.
 func WriteHashTable(bucketPager *pager.Pager, table *HashTable) error {
 	if bucketPager.HasFile() {
-		indexPager := pager.NewPager()
-		err := indexPager.Open(bucketPager.GetFileName() + ".meta")
+		indexPager, err := pager.NewPagerWithPageSize(bucketPager.GetPageSize())
+		if err != nil {
+			return err
+		}
+		err = indexPager.Open(bucketPager.GetFilePath() + ".meta")
 		if err != nil {
 			return err
 		}
-		metaPN := indexPager.GetFreePN()
+		// Always overwrite the meta file from the first page.
+		metaPN := int64(0)
 		page, err := indexPager.GetPage(metaPN)
 		if err != nil {
 			return err
 		}
 		page.SetDirty(true)
+		dir := table.getDirectory()
 		// Write global depth to meta file
 		depthData := make([]byte, DEPTH_SIZE)
-		binary.PutVarint(depthData, table.depth)
+		binary.PutVarint(depthData, dir.depth)
 		page.Update(depthData, DEPTH_OFFSET, DEPTH_SIZE)
 		bytesWritten := DEPTH_SIZE
 		// Write bucket index to meta file
 		pnSize := int64(binary.MaxVarintLen64)
 		pnData := make([]byte, pnSize)
-		for _, pn := range table.buckets {
-			if bytesWritten+pnSize > PAGESIZE {
+		for _, pn := range dir.buckets {
+			if bytesWritten+pnSize > indexPager.GetPageSize() {
 				page.Put()
-				metaPN = indexPager.GetFreePN()
+				metaPN++
 				page, err = indexPager.GetPage(metaPN)
 				if err != nil {
 					return err
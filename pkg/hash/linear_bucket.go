@@ -0,0 +1,142 @@
+package hash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	pager "github.com/brown-csci1270/db/pkg/pager"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Linear hash bucket variables. A linear bucket is a chain of pages; each
+// page stores its own key count and the page number of the next overflow page.
+var LINEAR_NUM_KEYS_OFFSET int64 = 0
+var LINEAR_NUM_KEYS_SIZE int64 = binary.MaxVarintLen64
+var LINEAR_NEXT_PN_OFFSET int64 = LINEAR_NUM_KEYS_OFFSET + LINEAR_NUM_KEYS_SIZE
+var LINEAR_NEXT_PN_SIZE int64 = binary.MaxVarintLen64
+var LINEAR_BUCKET_HEADER_SIZE int64 = LINEAR_NUM_KEYS_SIZE + LINEAR_NEXT_PN_SIZE
+
+// Number of entries that fit in each page of a linear bucket, given the page size.
+func linearBucketSize(pageSize int64) int64 {
+	return (pageSize - LINEAR_BUCKET_HEADER_SIZE) / ENTRYSIZE
+}
+
+// Page number marking the end of an overflow chain.
+var NO_OVERFLOW_PN int64 = -1
+
+// LinearBucket is a single page in a linear hash bucket's overflow chain.
+type LinearBucket struct {
+	numKeys int64
+	nextPN  int64
+	page    *pager.Page
+}
+
+// Construct a new, empty LinearBucket.
+func NewLinearBucket(pager *pager.Pager) (*LinearBucket, error) {
+	newPN := pager.GetFreePN()
+	newPage, err := pager.GetPage(newPN)
+	if err != nil {
+		return nil, err
+	}
+	bucket := &LinearBucket{page: newPage}
+	bucket.updateNumKeys(0)
+	bucket.updateNextPN(NO_OVERFLOW_PN)
+	return bucket, nil
+}
+
+// Get the number of keys in this page of the chain.
+func (bucket *LinearBucket) GetNumKeys() int64 {
+	return bucket.numKeys
+}
+
+// Get the page number of the next overflow page, or NO_OVERFLOW_PN.
+func (bucket *LinearBucket) GetNextPN() int64 {
+	return bucket.nextPN
+}
+
+// Get a bucket's page.
+func (bucket *LinearBucket) GetPage() *pager.Page {
+	return bucket.page
+}
+
+// Finds the entry with the given key in this page.
+func (bucket *LinearBucket) Find(key int64) (utils.Entry, bool) {
+	for i := int64(0); i < bucket.numKeys; i++ {
+		if bucket.getKeyAt(i) == key {
+			return bucket.getCell(i), true
+		}
+	}
+	return nil, false
+}
+
+// Select all entries in this page.
+func (bucket *LinearBucket) Select() ([]utils.Entry, error) {
+	ret := make([]utils.Entry, 0)
+	for i := int64(0); i < bucket.numKeys; i++ {
+		ret = append(ret, bucket.getCell(i))
+	}
+	return ret, nil
+}
+
+// Pretty-print this page of the chain.
+func (bucket *LinearBucket) Print(w io.Writer) {
+	io.WriteString(w, fmt.Sprintf("page %d, next: %d\n", bucket.page.GetPageNum(), bucket.nextPN))
+	io.WriteString(w, "entries:")
+	for i := int64(0); i < bucket.numKeys; i++ {
+		bucket.getCell(i).Print(w)
+	}
+	io.WriteString(w, "\n")
+}
+
+// Get the byte-position of the cell with the given index.
+func linearCellPos(index int64) int64 {
+	return LINEAR_BUCKET_HEADER_SIZE + index*ENTRYSIZE
+}
+
+// Write the given entry into the given index.
+func (bucket *LinearBucket) modifyCell(index int64, entry HashEntry) {
+	bucket.page.Update(entry.Marshal(), linearCellPos(index), ENTRYSIZE)
+}
+
+// Get the entry at the given index.
+func (bucket *LinearBucket) getCell(index int64) HashEntry {
+	startPos := linearCellPos(index)
+	return unmarshalEntry((*bucket.page.GetData())[startPos : startPos+ENTRYSIZE])
+}
+
+// Get the key at the given index.
+func (bucket *LinearBucket) getKeyAt(index int64) int64 {
+	return bucket.getCell(index).GetKey()
+}
+
+// Update the number of keys in this page.
+func (bucket *LinearBucket) updateNumKeys(nKeys int64) {
+	bucket.numKeys = nKeys
+	nKeysData := make([]byte, LINEAR_NUM_KEYS_SIZE)
+	binary.PutVarint(nKeysData, nKeys)
+	bucket.page.Update(nKeysData, LINEAR_NUM_KEYS_OFFSET, LINEAR_NUM_KEYS_SIZE)
+}
+
+// Update the next overflow page number.
+func (bucket *LinearBucket) updateNextPN(pn int64) {
+	bucket.nextPN = pn
+	pnData := make([]byte, LINEAR_NEXT_PN_SIZE)
+	binary.PutVarint(pnData, pn)
+	bucket.page.Update(pnData, LINEAR_NEXT_PN_OFFSET, LINEAR_NEXT_PN_SIZE)
+}
+
+// Convert a page into a linear bucket.
+func pageToLinearBucket(page *pager.Page) *LinearBucket {
+	numKeys, _ := binary.Varint(
+		(*page.GetData())[LINEAR_NUM_KEYS_OFFSET : LINEAR_NUM_KEYS_OFFSET+LINEAR_NUM_KEYS_SIZE],
+	)
+	nextPN, _ := binary.Varint(
+		(*page.GetData())[LINEAR_NEXT_PN_OFFSET : LINEAR_NEXT_PN_OFFSET+LINEAR_NEXT_PN_SIZE],
+	)
+	return &LinearBucket{
+		numKeys: numKeys,
+		nextPN:  nextPN,
+		page:    page,
+	}
+}
@@ -0,0 +1,70 @@
+package hash
+
+import (
+	"errors"
+
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// LinearHashCursor points to a spot in the linear hash table.
+// Each bucket's chain is read in full when the cursor reaches it.
+type LinearHashCursor struct {
+	table    *LinearHashIndex
+	bucketId int64
+	cellnum  int64
+	isEnd    bool
+	entries  []utils.Entry
+}
+
+// TableStart returns a cursor to the first entry in the linear hash table.
+func (index *LinearHashIndex) TableStart() (utils.Cursor, error) {
+	cursor := LinearHashCursor{table: index, bucketId: -1, isEnd: true}
+	// Move onto the first entry; an empty table leaves the cursor at the end.
+	cursor.StepForward()
+	return &cursor, nil
+}
+
+// StepForward moves the cursor ahead by one entry.
+func (cursor *LinearHashCursor) StepForward() error {
+	// Move forward within the current bucket if we can.
+	if !cursor.isEnd {
+		cursor.cellnum++
+		if cursor.cellnum < int64(len(cursor.entries)) {
+			return nil
+		}
+		cursor.isEnd = true
+	}
+	// Otherwise, try visiting the next non-empty bucket.
+	table := cursor.table.table
+	table.RLock()
+	defer table.RUnlock()
+	for {
+		if cursor.bucketId+1 >= int64(len(table.buckets)) {
+			return errors.New("cannot advance the cursor further")
+		}
+		cursor.bucketId++
+		entries, err := table.selectBucket(cursor.bucketId)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			cursor.entries = entries
+			cursor.cellnum = 0
+			cursor.isEnd = false
+			return nil
+		}
+	}
+}
+
+// IsEnd returns true if at end.
+func (cursor *LinearHashCursor) IsEnd() bool {
+	return cursor.isEnd
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (cursor *LinearHashCursor) GetEntry() (utils.Entry, error) {
+	if cursor.isEnd {
+		return HashEntry{}, errors.New("getEntry: entry is non-existent")
+	}
+	return cursor.entries[cursor.cellnum], nil
+}
@@ -0,0 +1,124 @@
+package hash
+
+import (
+	"io"
+
+	pager "github.com/brown-csci1270/db/pkg/pager"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// LinearHashIndex is an index that uses a LinearHashTable as its datastructure. Implements db.Index.
+type LinearHashIndex struct {
+	table *LinearHashTable
+	pager *pager.Pager
+}
+
+// Opens the pager with the given table name.
+func OpenLinearTable(filename string) (*LinearHashIndex, error) {
+	return OpenLinearTableWithPageSize(filename, pager.PAGESIZE)
+}
+
+// Opens the pager with the given table name, with buckets of the given page size.
+func OpenLinearTableWithPageSize(filename string, pageSize int64) (*LinearHashIndex, error) {
+	// Create a pager for the table.
+	pager, err := pager.NewPagerWithPageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+	err = pager.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// Return index.
+	var table *LinearHashTable
+	if pager.GetNumPages() == 0 {
+		table, err = NewLinearHashTable(pager)
+	} else {
+		table, err = ReadLinearHashTable(pager)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &LinearHashIndex{table: table, pager: pager}, nil
+}
+
+// Creates a table that lives only in memory under the given name.
+func OpenMemoryLinearTable(name string) (*LinearHashIndex, error) {
+	pager := pager.NewPager()
+	pager.OpenAnonymous(name)
+	table, err := NewLinearHashTable(pager)
+	if err != nil {
+		return nil, err
+	}
+	return &LinearHashIndex{table: table, pager: pager}, nil
+}
+
+// Get name.
+func (index *LinearHashIndex) GetName() string {
+	return index.pager.GetFileName()
+}
+
+// Get pager.
+func (index *LinearHashIndex) GetPager() *pager.Pager {
+	return index.pager
+}
+
+// Get table.
+func (index *LinearHashIndex) GetTable() *LinearHashTable {
+	return index.table
+}
+
+// Closes the table by closing the pager.
+func (index *LinearHashIndex) Close() error {
+	return WriteLinearHashTable(index.pager, index.table)
+}
+
+// Find element by key.
+func (index *LinearHashIndex) Find(key int64) (utils.Entry, error) {
+	return index.table.Find(key)
+}
+
+// Insert given element.
+func (index *LinearHashIndex) Insert(key int64, value int64) error {
+	return index.table.Insert(key, value)
+}
+
+// Update given element.
+func (index *LinearHashIndex) Update(key int64, value int64) error {
+	return index.table.Update(key, value)
+}
+
+// Insert given element, or update it if it exists.
+func (index *LinearHashIndex) Upsert(key int64, value int64) error {
+	return index.table.Upsert(key, value)
+}
+
+// Update given element if it holds the expected value.
+func (index *LinearHashIndex) CompareAndSwap(key int64, expected int64, value int64) (bool, error) {
+	return index.table.CompareAndSwap(key, expected, value)
+}
+
+// Apply a batch of writes.
+func (index *LinearHashIndex) ApplyBatch(batch *utils.WriteBatch) error {
+	return index.table.ApplyBatch(batch)
+}
+
+// Delete given element.
+func (index *LinearHashIndex) Delete(key int64) error {
+	return index.table.Delete(key)
+}
+
+// Select all elements.
+func (index *LinearHashIndex) Select() ([]utils.Entry, error) {
+	return index.table.Select()
+}
+
+// Print all elements.
+func (index *LinearHashIndex) Print(w io.Writer) {
+	index.table.Print(w)
+}
+
+// Print a page of elements.
+func (index *LinearHashIndex) PrintPN(pn int, w io.Writer) {
+	index.table.PrintPN(pn, w)
+}
@@ -0,0 +1,108 @@
+package hash
+
+import (
+	"encoding/binary"
+
+	pager "github.com/brown-csci1270/db/pkg/pager"
+)
+
+// Suffix of the file storing a linear hash table's bucket array.
+const LINEAR_META_SUFFIX = ".lmeta"
+
+// Read linear hash table in from memory.
+func ReadLinearHashTable(bucketPager *pager.Pager) (*LinearHashTable, error) {
+	indexPager, err := pager.NewPagerWithPageSize(bucketPager.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+	err = indexPager.Open(bucketPager.GetFilePath() + LINEAR_META_SUFFIX)
+	if err != nil {
+		return nil, err
+	}
+	defer indexPager.Close()
+	metaPN := int64(0)
+	page, err := indexPager.GetPage(metaPN)
+	if err != nil {
+		return nil, err
+	}
+	// Read the header: level, split pointer, number of keys and number of buckets.
+	pnSize := int64(binary.MaxVarintLen64)
+	header := make([]int64, 4)
+	for i := range header {
+		header[i], _ = binary.Varint((*page.GetData())[int64(i)*pnSize : int64(i+1)*pnSize])
+	}
+	bytesRead := int64(len(header)) * pnSize
+	// Read the bucket array.
+	buckets := make([]int64, header[3])
+	for i := range buckets {
+		if bytesRead+pnSize > indexPager.GetPageSize() {
+			page.Put()
+			metaPN++
+			page, err = indexPager.GetPage(metaPN)
+			if err != nil {
+				return nil, err
+			}
+			bytesRead = 0
+		}
+		buckets[i], _ = binary.Varint((*page.GetData())[bytesRead : bytesRead+pnSize])
+		bytesRead += pnSize
+	}
+	page.Put()
+	return &LinearHashTable{
+		level:   header[0],
+		next:    header[1],
+		numKeys: header[2],
+		buckets: buckets,
+		pager:   bucketPager,
+	}, nil
+}
+
+// Write linear hash table out to memory.
+func WriteLinearHashTable(bucketPager *pager.Pager, table *LinearHashTable) error {
+	if bucketPager.HasFile() {
+		indexPager, err := pager.NewPagerWithPageSize(bucketPager.GetPageSize())
+		if err != nil {
+			return err
+		}
+		err = indexPager.Open(bucketPager.GetFilePath() + LINEAR_META_SUFFIX)
+		if err != nil {
+			return err
+		}
+		// Always overwrite the meta file from the first page.
+		metaPN := int64(0)
+		page, err := indexPager.GetPage(metaPN)
+		if err != nil {
+			return err
+		}
+		page.SetDirty(true)
+		// Write the header.
+		pnSize := int64(binary.MaxVarintLen64)
+		pnData := make([]byte, pnSize)
+		bytesWritten := int64(0)
+		header := []int64{table.level, table.next, table.GetNumKeys(), int64(len(table.buckets))}
+		for _, v := range header {
+			binary.PutVarint(pnData, v)
+			page.Update(pnData, bytesWritten, pnSize)
+			bytesWritten += pnSize
+		}
+		// Write the bucket array.
+		for _, pn := range table.buckets {
+			if bytesWritten+pnSize > indexPager.GetPageSize() {
+				page.Put()
+				metaPN++
+				page, err = indexPager.GetPage(metaPN)
+				if err != nil {
+					return err
+				}
+				page.SetDirty(true)
+				bytesWritten = 0
+			}
+			binary.PutVarint(pnData, pn)
+			page.Update(pnData, bytesWritten, pnSize)
+			bytesWritten += pnSize
+		}
+		page.Put()
+		indexPager.Close()
+	}
+	return bucketPager.Close()
+}
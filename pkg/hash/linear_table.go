@@ -0,0 +1,612 @@
+package hash
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	pager "github.com/brown-csci1270/db/pkg/pager"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Linear hash table variables.
+var LINEAR_INITIAL_LEVEL int64 = 2
+var LINEAR_MAX_LOAD_FACTOR float64 = 0.75
+
+// LinearHashTable definitions.
+// Buckets are split one at a time, in round-robin order, whenever the load
+// factor exceeds LINEAR_MAX_LOAD_FACTOR. Bucket i lives at buckets[i]; the
+// bucket pointed to by `next` is the next one to be split.
+type LinearHashTable struct {
+	level    int64   // Number of completed doubling rounds, offset by the initial level
+	next     int64   // Index of the next bucket to split
+	numKeys  int64   // Number of entries in the table
+	buckets  []int64 // Array of primary bucket page numbers
+	pager    *pager.Pager
+	rwlock   sync.RWMutex // Lock on the bucket array
+	allocMtx sync.Mutex   // Lock on page allocation
+}
+
+// Returns a new LinearHashTable.
+func NewLinearHashTable(pager *pager.Pager) (*LinearHashTable, error) {
+	level := LINEAR_INITIAL_LEVEL
+	buckets := make([]int64, powInt(2, level))
+	for i := range buckets {
+		bucket, err := NewLinearBucket(pager)
+		if err != nil {
+			return nil, err
+		}
+		buckets[i] = bucket.page.GetPageNum()
+		bucket.page.Put()
+	}
+	return &LinearHashTable{level: level, buckets: buckets, pager: pager}, nil
+}
+
+// [CONCURRENCY] Grab a write lock on the bucket array
+func (table *LinearHashTable) WLock() {
+	table.rwlock.Lock()
+}
+
+// [CONCURRENCY] Release a write lock on the bucket array
+func (table *LinearHashTable) WUnlock() {
+	table.rwlock.Unlock()
+}
+
+// [CONCURRENCY] Grab a read lock on the bucket array
+func (table *LinearHashTable) RLock() {
+	table.rwlock.RLock()
+}
+
+// [CONCURRENCY] Release a read lock on the bucket array
+func (table *LinearHashTable) RUnlock() {
+	table.rwlock.RUnlock()
+}
+
+// Get level.
+func (table *LinearHashTable) GetLevel() int64 {
+	return table.level
+}
+
+// Get the index of the next bucket to split.
+func (table *LinearHashTable) GetNext() int64 {
+	return table.next
+}
+
+// Get the number of entries in the table.
+func (table *LinearHashTable) GetNumKeys() int64 {
+	return atomic.LoadInt64(&table.numKeys)
+}
+
+// Get the number of entries that fit in each page of a bucket.
+func (table *LinearHashTable) GetBucketSize() int64 {
+	return linearBucketSize(table.pager.GetPageSize())
+}
+
+// Get primary bucket page numbers.
+func (table *LinearHashTable) GetBuckets() []int64 {
+	return table.buckets
+}
+
+// Get pager.
+func (table *LinearHashTable) GetPager() *pager.Pager {
+	return table.pager
+}
+
+// Returns the index of the bucket the given key belongs to.
+func (table *LinearHashTable) address(key int64) int64 {
+	hash := Hasher(key, table.level)
+	if hash < table.next {
+		hash = Hasher(key, table.level+1)
+	}
+	return hash
+}
+
+// Returns the current load factor of the table. Expects the table to be locked.
+func (table *LinearHashTable) loadFactor() float64 {
+	capacity := int64(len(table.buckets)) * table.GetBucketSize()
+	return float64(table.GetNumKeys()) / float64(capacity)
+}
+
+// Returns the page in the chain with the given page number, and increments its ref count.
+func (table *LinearHashTable) getBucketByPN(pn int64) (*LinearBucket, error) {
+	page, err := table.pager.GetPage(pn)
+	if err != nil {
+		return nil, err
+	}
+	return pageToLinearBucket(page), nil
+}
+
+// Allocate a new page for the chain.
+func (table *LinearHashTable) newBucket() (*LinearBucket, error) {
+	table.allocMtx.Lock()
+	defer table.allocMtx.Unlock()
+	return NewLinearBucket(table.pager)
+}
+
+// Calls fn on each page of the chain starting at pn until fn returns true.
+// Each page is released after fn returns; the caller should hold a lock on the primary page.
+func (table *LinearHashTable) walkChain(pn int64, fn func(*LinearBucket) bool) error {
+	for pn != NO_OVERFLOW_PN {
+		bucket, err := table.getBucketByPN(pn)
+		if err != nil {
+			return err
+		}
+		stop := fn(bucket)
+		pn = bucket.nextPN
+		bucket.page.Put()
+		if stop {
+			break
+		}
+	}
+	return nil
+}
+
+// Returns the primary page of the bucket for the given key, locked accordingly.
+// The caller should hold a read lock on the table.
+func (table *LinearHashTable) getPrimary(key int64, lock BucketLockType) (*LinearBucket, error) {
+	page, err := table.pager.GetPage(table.buckets[table.address(key)])
+	if err != nil {
+		return nil, err
+	}
+	// Only read the page once it's locked, since other writers may be changing it.
+	if lock == READ_LOCK {
+		page.RLock()
+	}
+	if lock == WRITE_LOCK {
+		page.WLock()
+	}
+	return pageToLinearBucket(page), nil
+}
+
+// Finds the entry with the given key.
+func (table *LinearHashTable) Find(key int64) (utils.Entry, error) {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	defer table.RUnlock()
+	primary, err := table.getPrimary(key, READ_LOCK)
+	if err != nil {
+		return nil, err
+	}
+	defer primary.page.Put()
+	defer primary.page.RUnlock()
+	// Walk the chain looking for the key.
+	var entry utils.Entry
+	var found bool
+	err = table.walkChain(primary.page.GetPageNum(), func(bucket *LinearBucket) bool {
+		entry, found = bucket.Find(key)
+		return found
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, utils.ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+// Inserts the given key-value pair, splits the next bucket if necessary.
+func (table *LinearHashTable) Insert(key int64, value int64) error {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	primary, err := table.getPrimary(key, WRITE_LOCK)
+	if err != nil {
+		table.RUnlock()
+		return err
+	}
+	// [CONCURRENCY] Check for the key under the chain's write lock, so concurrent inserts can't both succeed.
+	found := false
+	err = table.walkChain(primary.page.GetPageNum(), func(bucket *LinearBucket) bool {
+		_, found = bucket.Find(key)
+		return found
+	})
+	if err == nil && found {
+		err = fmt.Errorf("cannot insert duplicate key: %w", utils.ErrKeyExists)
+	}
+	if err == nil {
+		err = table.insertIntoChain(primary, HashEntry{key: key, value: value})
+	}
+	primary.page.WUnlock()
+	primary.page.Put()
+	table.RUnlock()
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&table.numKeys, 1)
+	return table.splitIfFull()
+}
+
+// Split a single bucket if we've become too full.
+// Expects the table to be unlocked.
+func (table *LinearHashTable) splitIfFull() error {
+	table.RLock()
+	full := table.loadFactor() > LINEAR_MAX_LOAD_FACTOR
+	table.RUnlock()
+	if full {
+		table.WLock()
+		defer table.WUnlock()
+		// Another insert may have split while we were waiting.
+		if table.loadFactor() > LINEAR_MAX_LOAD_FACTOR {
+			return table.Split()
+		}
+	}
+	return nil
+}
+
+// Places the entry in the first page of the chain with space, extending the chain if needed.
+// Expects the primary page to be write-locked.
+func (table *LinearHashTable) insertIntoChain(primary *LinearBucket, entry HashEntry) error {
+	var last *LinearBucket
+	inserted := false
+	err := table.walkChain(primary.page.GetPageNum(), func(bucket *LinearBucket) bool {
+		if bucket.numKeys < table.GetBucketSize() {
+			bucket.modifyCell(bucket.numKeys, entry)
+			bucket.updateNumKeys(bucket.numKeys + 1)
+			inserted = true
+			return true
+		}
+		if bucket.nextPN == NO_OVERFLOW_PN {
+			// Hold on to the tail so that we can link a new overflow page.
+			bucket.page.Get()
+			last = bucket
+		}
+		return false
+	})
+	if err != nil || inserted {
+		return err
+	}
+	defer last.page.Put()
+	overflow, err := table.newBucket()
+	if err != nil {
+		return err
+	}
+	defer overflow.page.Put()
+	overflow.modifyCell(0, entry)
+	overflow.updateNumKeys(1)
+	last.updateNextPN(overflow.page.GetPageNum())
+	return nil
+}
+
+// Split the bucket pointed to by next, advancing the split pointer.
+// Expects the table to be write-locked.
+func (table *LinearHashTable) Split() error {
+	oldHash := table.next
+	newHash := table.next + powInt(2, table.level)
+	// Gather all entries in the chain being split.
+	chain := make([]*LinearBucket, 0)
+	entries := make([]HashEntry, 0)
+	err := table.walkChain(table.buckets[oldHash], func(bucket *LinearBucket) bool {
+		bucket.page.Get()
+		chain = append(chain, bucket)
+		for i := int64(0); i < bucket.numKeys; i++ {
+			entries = append(entries, bucket.getCell(i))
+		}
+		return false
+	})
+	defer func() {
+		for _, bucket := range chain {
+			bucket.page.Put()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	// Make the new bucket.
+	newBucket, err := table.newBucket()
+	if err != nil {
+		return err
+	}
+	newChain := []*LinearBucket{newBucket}
+	defer func() {
+		for _, bucket := range newChain {
+			bucket.page.Put()
+		}
+	}()
+	// Redistribute the entries, reusing the old chain's pages.
+	oldIdx, newIdx := 0, 0
+	for _, bucket := range chain {
+		bucket.updateNumKeys(0)
+	}
+	for _, entry := range entries {
+		if Hasher(entry.GetKey(), table.level+1) == newHash {
+			bucket := newChain[newIdx]
+			if bucket.numKeys >= table.GetBucketSize() {
+				overflow, err := table.newBucket()
+				if err != nil {
+					return err
+				}
+				bucket.updateNextPN(overflow.page.GetPageNum())
+				newChain = append(newChain, overflow)
+				newIdx++
+				bucket = overflow
+			}
+			bucket.modifyCell(bucket.numKeys, entry)
+			bucket.updateNumKeys(bucket.numKeys + 1)
+		} else {
+			// The old chain always has room, since entries only ever leave it.
+			bucket := chain[oldIdx]
+			if bucket.numKeys >= table.GetBucketSize() {
+				oldIdx++
+				bucket = chain[oldIdx]
+			}
+			bucket.modifyCell(bucket.numKeys, entry)
+			bucket.updateNumKeys(bucket.numKeys + 1)
+		}
+	}
+	// Publish the new bucket and advance the split pointer.
+	table.buckets = append(table.buckets, newBucket.page.GetPageNum())
+	table.next++
+	if table.next == powInt(2, table.level) {
+		table.level++
+		table.next = 0
+	}
+	return nil
+}
+
+// Update the given key-value pair.
+func (table *LinearHashTable) Update(key int64, value int64) error {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	defer table.RUnlock()
+	primary, err := table.getPrimary(key, WRITE_LOCK)
+	if err != nil {
+		return err
+	}
+	defer primary.page.Put()
+	defer primary.page.WUnlock()
+	found, err := table.updateInChain(primary, key, func(int64) (int64, bool) {
+		return value, true
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("update aborted: %w", utils.ErrKeyNotFound)
+	}
+	return nil
+}
+
+// Inserts the given key-value pair, or updates it if the key already exists.
+func (table *LinearHashTable) Upsert(key int64, value int64) error {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	primary, err := table.getPrimary(key, WRITE_LOCK)
+	if err != nil {
+		table.RUnlock()
+		return err
+	}
+	found, err := table.updateInChain(primary, key, func(int64) (int64, bool) {
+		return value, true
+	})
+	if err == nil && !found {
+		err = table.insertIntoChain(primary, HashEntry{key: key, value: value})
+	}
+	primary.page.WUnlock()
+	primary.page.Put()
+	table.RUnlock()
+	if err != nil || found {
+		return err
+	}
+	atomic.AddInt64(&table.numKeys, 1)
+	return table.splitIfFull()
+}
+
+// Updates the given key to value if it currently holds expected. Returns whether it did.
+func (table *LinearHashTable) CompareAndSwap(key int64, expected int64, value int64) (bool, error) {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	defer table.RUnlock()
+	primary, err := table.getPrimary(key, WRITE_LOCK)
+	if err != nil {
+		return false, err
+	}
+	defer primary.page.Put()
+	defer primary.page.WUnlock()
+	swapped := false
+	found, err := table.updateInChain(primary, key, func(old int64) (int64, bool) {
+		swapped = old == expected
+		return value, swapped
+	})
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, fmt.Errorf("swap aborted: %w", utils.ErrKeyNotFound)
+	}
+	return swapped, nil
+}
+
+// Finds the given key in the chain and passes its value to fn, which returns the
+// new value and whether to write it. Returns whether the key was found.
+// Expects the primary page to be write-locked.
+func (table *LinearHashTable) updateInChain(primary *LinearBucket, key int64, fn func(int64) (int64, bool)) (bool, error) {
+	found := false
+	err := table.walkChain(primary.page.GetPageNum(), func(bucket *LinearBucket) bool {
+		for i := int64(0); i < bucket.numKeys; i++ {
+			if bucket.getKeyAt(i) == key {
+				if value, ok := fn(bucket.getCell(i).GetValue()); ok {
+					bucket.modifyCell(i, HashEntry{key: key, value: value})
+				}
+				found = true
+				return true
+			}
+		}
+		return false
+	})
+	return found, err
+}
+
+// Delete the given key-value pair, does not merge buckets.
+func (table *LinearHashTable) Delete(key int64) error {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	defer table.RUnlock()
+	primary, err := table.getPrimary(key, WRITE_LOCK)
+	if err != nil {
+		return err
+	}
+	defer primary.page.Put()
+	defer primary.page.WUnlock()
+	found, err := table.deleteFromChain(primary, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("delete aborted: %w", utils.ErrKeyNotFound)
+	}
+	atomic.AddInt64(&table.numKeys, -1)
+	return nil
+}
+
+// Finds the entry in the chain, then moves all other keys in its page left by one.
+// Returns whether the key was found. Expects the primary page to be write-locked.
+func (table *LinearHashTable) deleteFromChain(primary *LinearBucket, key int64) (bool, error) {
+	found := false
+	err := table.walkChain(primary.page.GetPageNum(), func(bucket *LinearBucket) bool {
+		for i := int64(0); i < bucket.numKeys; i++ {
+			if bucket.getKeyAt(i) == key {
+				for j := i; j < bucket.numKeys-1; j++ {
+					bucket.modifyCell(j, bucket.getCell(j+1))
+				}
+				bucket.updateNumKeys(bucket.numKeys - 1)
+				found = true
+				return true
+			}
+		}
+		return false
+	})
+	return found, err
+}
+
+// Apply a batch of writes. Writes are grouped by bucket so that each chain
+// is locked once for all of its writes.
+func (table *LinearHashTable) ApplyBatch(batch *utils.WriteBatch) error {
+	ops := batch.Ops()
+	table.RLock()
+	sort.SliceStable(ops, func(i, j int) bool {
+		return table.address(ops[i].Key) < table.address(ops[j].Key)
+	})
+	table.RUnlock()
+	for len(ops) > 0 {
+		n, err := table.applyToChain(ops)
+		if err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// Applies the leading ops that belong to the same chain as the first one, then
+// splits if the table has become too full. Returns how many were applied.
+func (table *LinearHashTable) applyToChain(ops []utils.BatchOp) (int, error) {
+	// [CONCURRENCY] Lock the table, then the chain.
+	table.RLock()
+	primary, err := table.getPrimary(ops[0].Key, WRITE_LOCK)
+	if err != nil {
+		table.RUnlock()
+		return 0, err
+	}
+	addr := table.address(ops[0].Key)
+	n, added := 0, int64(0)
+	for ; n < len(ops) && table.address(ops[n].Key) == addr; n++ {
+		op := ops[n]
+		var found bool
+		if op.Delete {
+			if found, err = table.deleteFromChain(primary, op.Key); found {
+				added--
+			}
+		} else {
+			found, err = table.updateInChain(primary, op.Key, func(int64) (int64, bool) {
+				return op.Value, true
+			})
+			if err == nil && !found {
+				if err = table.insertIntoChain(primary, HashEntry{key: op.Key, value: op.Value}); err == nil {
+					added++
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	primary.page.WUnlock()
+	primary.page.Put()
+	table.RUnlock()
+	atomic.AddInt64(&table.numKeys, added)
+	if err != nil {
+		return n, err
+	}
+	return n, table.splitIfFull()
+}
+
+// Select all entries in the given bucket.
+func (table *LinearHashTable) selectBucket(hash int64) ([]utils.Entry, error) {
+	page, err := table.pager.GetPage(table.buckets[hash])
+	if err != nil {
+		return nil, err
+	}
+	page.RLock()
+	defer page.Put()
+	defer page.RUnlock()
+	ret := make([]utils.Entry, 0)
+	err = table.walkChain(page.GetPageNum(), func(bucket *LinearBucket) bool {
+		entries, _ := bucket.Select()
+		ret = append(ret, entries...)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Select all entries in this table.
+func (table *LinearHashTable) Select() ([]utils.Entry, error) {
+	// [CONCURRENCY] Lock the table
+	table.RLock()
+	defer table.RUnlock()
+	ret := make([]utils.Entry, 0)
+	for i := range table.buckets {
+		entries, err := table.selectBucket(int64(i))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, entries...)
+	}
+	return ret, nil
+}
+
+// Print out each bucket.
+func (table *LinearHashTable) Print(w io.Writer) {
+	table.RLock()
+	defer table.RUnlock()
+	io.WriteString(w, "====\n")
+	io.WriteString(w, fmt.Sprintf("level: %d, next: %d\n", table.level, table.next))
+	for i, pn := range table.buckets {
+		io.WriteString(w, fmt.Sprintf("====\nbucket %d\n", i))
+		table.walkChain(pn, func(bucket *LinearBucket) bool {
+			bucket.Print(w)
+			return false
+		})
+	}
+	io.WriteString(w, "====\n")
+}
+
+// Print out a specific page.
+func (table *LinearHashTable) PrintPN(pn int, w io.Writer) {
+	table.RLock()
+	defer table.RUnlock()
+	if int64(pn) >= table.pager.GetNumPages() {
+		io.WriteString(w, "out of bounds\n")
+		return
+	}
+	bucket, err := table.getBucketByPN(int64(pn))
+	if err != nil {
+		return
+	}
+	bucket.Print(w)
+	bucket.page.Put()
+}
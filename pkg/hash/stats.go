@@ -0,0 +1,95 @@
+package hash
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Number of equal-width bins in the bucket fill histogram.
+var FILL_HISTOGRAM_BINS int64 = 10
+
+// HashStats summarizes the shape of a hash table.
+type HashStats struct {
+	GlobalDepth    int64           // Global depth of the directory.
+	DirectorySize  int64           // Number of directory entries.
+	NumBuckets     int64           // Number of distinct buckets.
+	NumEntries     int64           // Number of entries across all buckets.
+	LoadFactor     float64         // Fraction of bucket capacity in use.
+	DepthHistogram map[int64]int64 // Local depth -> number of buckets with that depth.
+	FillHistogram  []int64         // Number of buckets in each fill bin; bin i covers [i/n, (i+1)/n) full.
+}
+
+// Stats walks every bucket in the table and reports on its shape.
+func (table *HashTable) Stats() (HashStats, error) {
+	dir := table.getDirectory()
+	stats := HashStats{
+		GlobalDepth:    dir.depth,
+		DirectorySize:  int64(len(dir.buckets)),
+		DepthHistogram: make(map[int64]int64),
+		FillHistogram:  make([]int64, FILL_HISTOGRAM_BINS),
+	}
+	seen := make(map[int64]bool)
+	for _, pn := range dir.buckets {
+		if seen[pn] {
+			continue
+		}
+		seen[pn] = true
+		bucket, err := table.GetBucketByPN(pn, READ_LOCK)
+		if err != nil {
+			return HashStats{}, err
+		}
+		depth, numKeys := bucket.depth, bucket.numKeys
+		bucket.RUnlock()
+		bucket.page.Put()
+		// Tally the bucket.
+		stats.NumBuckets++
+		stats.NumEntries += numKeys
+		stats.DepthHistogram[depth]++
+		bin := numKeys * FILL_HISTOGRAM_BINS / table.GetBucketSize()
+		if bin >= FILL_HISTOGRAM_BINS {
+			bin = FILL_HISTOGRAM_BINS - 1
+		}
+		stats.FillHistogram[bin]++
+	}
+	if stats.NumBuckets > 0 {
+		stats.LoadFactor = float64(stats.NumEntries) / float64(stats.NumBuckets*table.GetBucketSize())
+	}
+	return stats, nil
+}
+
+// Pretty-print these stats.
+func (stats HashStats) Print(w io.Writer) {
+	io.WriteString(w, fmt.Sprintf("global depth: %d\n", stats.GlobalDepth))
+	io.WriteString(w, fmt.Sprintf("directory size: %d\n", stats.DirectorySize))
+	io.WriteString(w, fmt.Sprintf("distinct buckets: %d\n", stats.NumBuckets))
+	io.WriteString(w, fmt.Sprintf("entries: %d\n", stats.NumEntries))
+	io.WriteString(w, fmt.Sprintf("load factor: %.3f\n", stats.LoadFactor))
+	// Print local depths in increasing order.
+	depths := make([]int64, 0, len(stats.DepthHistogram))
+	for depth := range stats.DepthHistogram {
+		depths = append(depths, depth)
+	}
+	sort.Slice(depths, func(i, j int) bool { return depths[i] < depths[j] })
+	io.WriteString(w, "local depths:\n")
+	for _, depth := range depths {
+		io.WriteString(w, fmt.Sprintf("  %3d: %d\n", depth, stats.DepthHistogram[depth]))
+	}
+	// Print the fill histogram with a bar per bin.
+	io.WriteString(w, "bucket fill:\n")
+	binWidth := 100 / len(stats.FillHistogram)
+	for i, count := range stats.FillHistogram {
+		bar := strings.Repeat("#", int(count*40/maxInt64(stats.NumBuckets, 1)))
+		line := fmt.Sprintf("  %3d-%3d%%: %6d %s", i*binWidth, (i+1)*binWidth, count, bar)
+		io.WriteString(w, strings.TrimRight(line, " ")+"\n")
+	}
+}
+
+// max(x, y)
+func maxInt64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -5,18 +5,27 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	pager "github.com/brown-csci1270/db/pkg/pager"
 	utils "github.com/brown-csci1270/db/pkg/utils"
 )
 
 // HashTable definitions.
+// The directory is never modified in place: splits build a new directory and
+// swap it in, so readers only ever lock the bucket they are interested in.
 type HashTable struct {
+	dir      atomic.Value // Current *directory
+	pager    *pager.Pager
+	splitMtx sync.Mutex // Lock on directory swaps and page allocation
+}
+
+// An immutable snapshot of the bucket directory.
+type directory struct {
 	depth   int64
 	buckets []int64 // Array of bucket page numbers
-	pager   *pager.Pager
-	rwlock  sync.RWMutex // Lock on the hash table index
 }
 
 // Returns a new HashTable.
@@ -31,37 +40,34 @@ func NewHashTable(pager *pager.Pager) (*HashTable, error) {
 		buckets[i] = bucket.page.GetPageNum()
 		bucket.page.Put()
 	}
-	return &HashTable{depth: depth, buckets: buckets, pager: pager}, nil
-}
-
-// [CONCURRENCY] Grab a write lock on the hash table index
-func (table *HashTable) WLock() {
-	table.rwlock.Lock()
-}
-
-// [CONCURRENCY] Release a write lock on the hash table index
-func (table *HashTable) WUnlock() {
-	table.rwlock.Unlock()
+	return newHashTable(pager, depth, buckets), nil
 }
 
-// [CONCURRENCY] Grab a read lock on the hash table index
-func (table *HashTable) RLock() {
-	table.rwlock.RLock()
+// Wraps a directory into a HashTable.
+func newHashTable(pager *pager.Pager, depth int64, buckets []int64) *HashTable {
+	table := &HashTable{pager: pager}
+	table.dir.Store(&directory{depth: depth, buckets: buckets})
+	return table
 }
 
-// [CONCURRENCY] Release a read lock on the hash table index
-func (table *HashTable) RUnlock() {
-	table.rwlock.RUnlock()
+// Get the current directory.
+func (table *HashTable) getDirectory() *directory {
+	return table.dir.Load().(*directory)
 }
 
 // Get depth.
 func (table *HashTable) GetDepth() int64 {
-	return table.depth
+	return table.getDirectory().depth
+}
+
+// Get the number of entries that fit in a bucket.
+func (table *HashTable) GetBucketSize() int64 {
+	return bucketSize(table.pager.GetPageSize())
 }
 
 // Get bucket page numbers.
 func (table *HashTable) GetBuckets() []int64 {
-	return table.buckets
+	return table.getDirectory().buckets
 }
 
 // Get pager.
@@ -69,32 +75,40 @@ func (table *HashTable) GetPager() *pager.Pager {
 	return table.pager
 }
 
+// Returns the bucket that the given key hashes to, locked accordingly, along with its hash.
+// [CONCURRENCY] If a split swaps the directory while we wait on the bucket lock,
+// the key may have moved, so we look it up again.
+func (table *HashTable) lockBucket(key int64, lock BucketLockType) (*HashBucket, int64, error) {
+	for {
+		dir := table.getDirectory()
+		hash := Hasher(key, dir.depth)
+		bucket, err := table.GetBucketByPN(dir.buckets[hash], lock)
+		if err != nil {
+			return nil, 0, err
+		}
+		cur := table.getDirectory()
+		if cur == dir || cur.buckets[Hasher(key, cur.depth)] == dir.buckets[hash] {
+			return bucket, hash, nil
+		}
+		bucket.unlock(lock)
+		bucket.page.Put()
+	}
+}
+
 // Finds the entry with the given key.
 func (table *HashTable) Find(key int64) (utils.Entry, error) {
 	/* SOLUTION {{{ */
-	// [CONCURRENCY] Lock the index
-	table.RLock()
-	// Hash the key.
-	hash := Hasher(key, table.depth)
-	if hash < 0 || int(hash) >= len(table.buckets) {
-		// [CONCURRENCY] Unlock the index on the error path
-		table.RUnlock()
-		return nil, errors.New("not found")
-	}
 	// Get and lock the corresponding bucket.
-	bucket, err := table.GetBucket(hash, READ_LOCK)
+	bucket, _, err := table.lockBucket(key, READ_LOCK)
 	if err != nil {
-		// [CONCURRENCY] Unlock the index on the error path
-		table.RUnlock()
 		return nil, err
 	}
 	defer bucket.RUnlock()
 	defer bucket.page.Put()
-	table.RUnlock()
 	// Find the entry.
 	entry, found := bucket.Find(key)
 	if !found {
-		return nil, errors.New("not found")
+		return nil, utils.ErrKeyNotFound
 	}
 	return entry, nil
 	/* SOLUTION }}} */
@@ -102,31 +116,40 @@ func (table *HashTable) Find(key int64) (utils.Entry, error) {
 
 // ExtendTable increases the global depth of the table by 1.
 func (table *HashTable) ExtendTable() {
-	table.depth = table.depth + 1
-	table.buckets = append(table.buckets, table.buckets...)
+	table.splitMtx.Lock()
+	defer table.splitMtx.Unlock()
+	table.dir.Store(table.getDirectory().extend())
+}
+
+// Returns a copy of this directory with the global depth increased by 1.
+func (dir *directory) extend() *directory {
+	buckets := make([]int64, 0, 2*len(dir.buckets))
+	buckets = append(buckets, dir.buckets...)
+	buckets = append(buckets, dir.buckets...)
+	return &directory{depth: dir.depth + 1, buckets: buckets}
 }
 
 // Split the given bucket into two, extending the table if necessary.
 func (table *HashTable) Split(bucket *HashBucket, hash int64) error {
 	/* SOLUTION {{{ */
-	// [CONCURRENCY] Note: the index & bucket should be locked before entry
+	// [CONCURRENCY] Note: the bucket should be write-locked before entry
 	// Figure out where the new pointer should live.
 	oldHash := (hash % powInt(2, bucket.depth))
 	newHash := oldHash + powInt(2, bucket.depth)
-	// If we are splitting, check if we need to double the table first.
-	if bucket.depth == table.depth {
-		table.ExtendTable()
-	}
 	// Next, make a new bucket.
-	bucket.updateDepth(bucket.depth + 1)
-	newBucket, err := NewHashBucket(table.pager, bucket.depth)
+	// [CONCURRENCY] Allocation and the directory swap are serialized by splitMtx.
+	// The new bucket stays write-locked until it is fully split, since it
+	// becomes discoverable as soon as the new directory is published.
+	table.splitMtx.Lock()
+	newBucket, err := NewHashBucket(table.pager, bucket.depth+1)
 	if err != nil {
+		table.splitMtx.Unlock()
 		return err
 	}
+	newBucket.WLock()
 	defer newBucket.page.Put()
-	// [CONCURRENCY] Note: newBucket doesn't have to be locked because we
-	// currently hold a write lock on the index, so no other user can
-	// discover this new bucket
+	defer newBucket.WUnlock()
+	bucket.updateDepth(bucket.depth + 1)
 	// Move entries over to it.
 	tmpEntries := make([]HashEntry, bucket.numKeys)
 	for i := int64(0); i < bucket.numKeys; i++ {
@@ -146,17 +169,26 @@ func (table *HashTable) Split(bucket *HashBucket, hash int64) error {
 	// Initialize bucket attributes.
 	bucket.updateNumKeys(oldNKeys)
 	newBucket.updateNumKeys(newNKeys)
+	// Copy the directory, doubling it first if we need to.
+	dir := table.getDirectory()
+	if bucket.depth > dir.depth {
+		dir = dir.extend()
+	} else {
+		dir = &directory{depth: dir.depth, buckets: append([]int64(nil), dir.buckets...)}
+	}
+	// Point the rest of the buckets to the new page, then publish.
 	power := bucket.depth
-	// Point the rest of the buckets to the new page.
-	for i := newHash; i < powInt(2, table.depth); {
-		table.buckets[i] = newBucket.page.GetPageNum()
+	for i := newHash; i < powInt(2, dir.depth); {
+		dir.buckets[i] = newBucket.page.GetPageNum()
 		i += powInt(2, power)
 	}
+	table.dir.Store(dir)
+	table.splitMtx.Unlock()
 	// Check if recursive splitting is required
-	if oldNKeys >= BUCKETSIZE {
+	if oldNKeys >= table.GetBucketSize() {
 		return table.Split(bucket, oldHash)
 	}
-	if newNKeys >= BUCKETSIZE {
+	if newNKeys >= table.GetBucketSize() {
 		return table.Split(newBucket, newHash)
 	}
 	return nil
@@ -166,23 +198,16 @@ func (table *HashTable) Split(bucket *HashBucket, hash int64) error {
 // Inserts the given key-value pair, splits if necessary.
 func (table *HashTable) Insert(key int64, value int64) error {
 	/* SOLUTION {{{ */
-	// [CONCURRENCY] Lock the index
-	table.WLock()
-
-	hash := Hasher(key, table.depth)
-	bucket, err := table.GetBucket(hash, WRITE_LOCK)
+	// [CONCURRENCY] Lock only the bucket; splits lock the directory themselves.
+	bucket, hash, err := table.lockBucket(key, WRITE_LOCK)
 	if err != nil {
-		// [CONCURRENCY] Unlock the index on the error path
-		table.WUnlock()
 		return err
 	}
 	defer bucket.WUnlock()
 	defer bucket.page.Put()
-	// Release the lock on the index if it's not necessary
-	if bucket.numKeys < BUCKETSIZE-1 {
-		table.WUnlock()
-	} else {
-		defer table.WUnlock()
+	// [CONCURRENCY] Check for the key under the write lock, so concurrent inserts can't both succeed.
+	if _, found := bucket.Find(key); found {
+		return fmt.Errorf("cannot insert duplicate key: %w", utils.ErrKeyExists)
 	}
 	// Insert and split.
 	split, err := bucket.Insert(key, value)
@@ -199,38 +224,121 @@ func (table *HashTable) Insert(key int64, value int64) error {
 // Update the given key-value pair.
 func (table *HashTable) Update(key int64, value int64) error {
 	/* SOLUTION {{{ */
-	// [CONCURRENCY] Lock the index
-	table.RLock()
-	hash := Hasher(key, table.depth)
-
-	bucket, err := table.GetBucket(hash, WRITE_LOCK)
+	bucket, _, err := table.lockBucket(key, WRITE_LOCK)
 	if err != nil {
-		// [CONCURRENCY] Unlock the index on the error path
-		table.RUnlock()
 		return err
 	}
 	defer bucket.WUnlock()
 	defer bucket.page.Put()
-	table.RUnlock()
 	return bucket.Update(key, value)
 	/* SOLUTION }}} */
 }
 
+// Inserts the given key-value pair, or updates it if the key already exists.
+func (table *HashTable) Upsert(key int64, value int64) error {
+	// [CONCURRENCY] Holding the bucket's write lock makes the check and the write atomic.
+	bucket, hash, err := table.lockBucket(key, WRITE_LOCK)
+	if err != nil {
+		return err
+	}
+	defer bucket.WUnlock()
+	defer bucket.page.Put()
+	if _, found := bucket.Find(key); found {
+		return bucket.Update(key, value)
+	}
+	split, err := bucket.Insert(key, value)
+	if err != nil || !split {
+		return err
+	}
+	return table.Split(bucket, hash)
+}
+
+// Updates the given key to value if it currently holds expected. Returns whether it did.
+func (table *HashTable) CompareAndSwap(key int64, expected int64, value int64) (bool, error) {
+	bucket, _, err := table.lockBucket(key, WRITE_LOCK)
+	if err != nil {
+		return false, err
+	}
+	defer bucket.WUnlock()
+	defer bucket.page.Put()
+	entry, found := bucket.Find(key)
+	if !found {
+		return false, fmt.Errorf("swap aborted: %w", utils.ErrKeyNotFound)
+	}
+	if entry.GetValue() != expected {
+		return false, nil
+	}
+	return true, bucket.Update(key, value)
+}
+
+// Apply a batch of writes. Writes are grouped by bucket so that each bucket
+// is locked once for all of its writes, unless it splits along the way.
+func (table *HashTable) ApplyBatch(batch *utils.WriteBatch) error {
+	ops := batch.Ops()
+	dir := table.getDirectory()
+	sort.SliceStable(ops, func(i, j int) bool {
+		return dir.buckets[Hasher(ops[i].Key, dir.depth)] < dir.buckets[Hasher(ops[j].Key, dir.depth)]
+	})
+	for len(ops) > 0 {
+		n, err := table.applyToBucket(ops)
+		if err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// Applies the leading ops that belong to the same bucket as the first one.
+// Returns how many were applied.
+func (table *HashTable) applyToBucket(ops []utils.BatchOp) (int, error) {
+	bucket, hash, err := table.lockBucket(ops[0].Key, WRITE_LOCK)
+	if err != nil {
+		return 0, err
+	}
+	defer bucket.WUnlock()
+	defer bucket.page.Put()
+	pn := bucket.page.GetPageNum()
+	for i, op := range ops {
+		// [CONCURRENCY] Other buckets may split meanwhile, but keys can't move
+		// into or out of this one while we hold its lock.
+		dir := table.getDirectory()
+		if dir.buckets[Hasher(op.Key, dir.depth)] != pn {
+			return i, nil
+		}
+		if op.Delete {
+			if err := bucket.Delete(op.Key); err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
+				return i, err
+			}
+			continue
+		}
+		if _, found := bucket.Find(op.Key); found {
+			if err := bucket.Update(op.Key, op.Value); err != nil {
+				return i, err
+			}
+			continue
+		}
+		split, err := bucket.Insert(op.Key, op.Value)
+		if err != nil {
+			return i, err
+		}
+		if split {
+			// Entries may move to a new bucket, so start a new run after splitting.
+			return i + 1, table.Split(bucket, hash)
+		}
+	}
+	return len(ops), nil
+}
+
 // Delete the given key-value pair, does not coalesce.
 func (table *HashTable) Delete(key int64) error {
 	/* SOLUTION {{{ */
-	// [CONCURRENCY] Lock the index
-	table.RLock()
-	hash := Hasher(key, table.depth)
-	bucket, err := table.GetBucket(hash, WRITE_LOCK)
+	bucket, _, err := table.lockBucket(key, WRITE_LOCK)
 	if err != nil {
-		// [CONCURRENCY] Unlock the index on the error path
-		table.RUnlock()
 		return err
 	}
 	defer bucket.WUnlock()
 	defer bucket.page.Put()
-	table.RUnlock()
 	return bucket.Delete(key)
 	/* SOLUTION }}} */
 }
@@ -238,37 +346,82 @@ func (table *HashTable) Delete(key int64) error {
 // Select all entries in this table.
 func (table *HashTable) Select() ([]utils.Entry, error) {
 	/* SOLUTION {{{ */
-	// [CONCURRENCY] Lock the index
-	table.RLock()
-	defer table.RUnlock()
-	// Go over all of the pages.
-	ret := make([]utils.Entry, 0)
-	for i := int64(0); i < table.pager.GetNumPages(); i++ {
-		bucket, err := table.GetBucketByPN(i, READ_LOCK)
+	return table.selectHash(0, 0)
+	/* SOLUTION }}} */
+}
+
+// Select all entries whose hash at the given depth is the given hash.
+// [CONCURRENCY] Only one bucket is locked at a time. If the entries span several
+// buckets, each half of the hash space is selected separately; since every key
+// belongs to exactly one half, a key that is present throughout is returned exactly once.
+func (table *HashTable) selectHash(depth int64, hash int64) ([]utils.Entry, error) {
+	for {
+		// Find the buckets covering this hash.
+		dir := table.getDirectory()
+		pn, single := dir.coveringBucket(depth, hash)
+		if !single {
+			lower, err := table.selectHash(depth+1, hash)
+			if err != nil {
+				return nil, err
+			}
+			upper, err := table.selectHash(depth+1, hash+powInt(2, depth))
+			if err != nil {
+				return nil, err
+			}
+			return append(lower, upper...), nil
+		}
+		// Lock the bucket, then make sure no split moved entries out of it.
+		bucket, err := table.GetBucketByPN(pn, READ_LOCK)
 		if err != nil {
 			return nil, err
 		}
+		if cur := table.getDirectory(); cur != dir {
+			if curPN, curSingle := cur.coveringBucket(depth, hash); !curSingle || curPN != pn {
+				bucket.RUnlock()
+				bucket.page.Put()
+				continue
+			}
+		}
 		entries, err := bucket.Select()
 		bucket.RUnlock()
-		bucket.GetPage().Put()
+		bucket.page.Put()
 		if err != nil {
 			return nil, err
 		}
-		ret = append(ret, entries...)
+		ret := make([]utils.Entry, 0, len(entries))
+		for _, entry := range entries {
+			if Hasher(entry.GetKey(), depth) == hash {
+				ret = append(ret, entry)
+			}
+		}
+		return ret, nil
 	}
-	return ret, nil
-	/* SOLUTION }}} */
+}
+
+// Returns the page number of the bucket holding all keys whose hash at the
+// given depth is the given hash, and false if more than one bucket holds them.
+func (dir *directory) coveringBucket(depth int64, hash int64) (int64, bool) {
+	if depth > dir.depth {
+		// The directory never shrinks, so this only happens to a stale directory.
+		return dir.buckets[hash%powInt(2, dir.depth)], true
+	}
+	pn := dir.buckets[hash]
+	for i := hash; i < int64(len(dir.buckets)); i += powInt(2, depth) {
+		if dir.buckets[i] != pn {
+			return 0, false
+		}
+	}
+	return pn, true
 }
 
 // Print out each bucket.
 func (table *HashTable) Print(w io.Writer) {
-	table.RLock()
-	defer table.RUnlock()
+	dir := table.getDirectory()
 	io.WriteString(w, "====\n")
-	io.WriteString(w, fmt.Sprintf("global depth: %d\n", table.depth))
-	for i := range table.buckets {
+	io.WriteString(w, fmt.Sprintf("global depth: %d\n", dir.depth))
+	for i, pn := range dir.buckets {
 		io.WriteString(w, fmt.Sprintf("====\nbucket %d\n", i))
-		bucket, err := table.GetBucket(int64(i), READ_LOCK)
+		bucket, err := table.GetBucketByPN(pn, READ_LOCK)
 		if err != nil {
 			continue
 		}
@@ -281,8 +434,6 @@ func (table *HashTable) Print(w io.Writer) {
 
 // Print out a specific bucket.
 func (table *HashTable) PrintPN(pn int, w io.Writer) {
-	table.RLock()
-	defer table.RUnlock()
 	if int64(pn) >= table.pager.GetNumPages() {
 		fmt.Println("out of bounds")
 		return
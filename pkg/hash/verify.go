@@ -6,12 +6,13 @@ func IsHash(index *HashIndex) (bool, error) {
 	for _, pn := range buckets {
 		// Get bucket
 		bucket, err := table.GetBucketByPN(pn, NO_LOCK)
-		d := bucket.GetDepth()
 		if err != nil {
 			return false, err
 		}
+		d := bucket.GetDepth()
 		// Get all entries
 		entries, err := bucket.Select()
+		bucket.GetPage().Put()
 		if err != nil {
 			return false, err
 		}
@@ -19,7 +20,25 @@ func IsHash(index *HashIndex) (bool, error) {
 		for _, e := range entries {
 			key := e.GetKey()
 			hash := Hasher(key, d)
-			if pn != table.buckets[hash] {
+			if pn != buckets[hash] {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func IsLinearHash(index *LinearHashIndex) (bool, error) {
+	table := index.GetTable()
+	for i := range table.GetBuckets() {
+		// Get all entries in the bucket's chain
+		entries, err := table.selectBucket(int64(i))
+		if err != nil {
+			return false, err
+		}
+		// Check that all entries should hash to this bucket.
+		for _, e := range entries {
+			if table.address(e.GetKey()) != int64(i) {
 				return false, nil
 			}
 		}
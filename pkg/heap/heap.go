@@ -0,0 +1,140 @@
+package heap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	pager "github.com/brown-csci1270/db/pkg/pager"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Heap file variables. Each page stores the number of bytes in use,
+// followed by records, each prefixed with its length.
+var USED_OFFSET int64 = 0
+var USED_SIZE int64 = binary.MaxVarintLen64
+var HEAP_HEADER_SIZE int64 = USED_SIZE
+var LENGTH_SIZE int64 = binary.MaxVarintLen64
+
+// Largest record that fits on a page of the given size.
+func MaxRecordSize(pageSize int64) int64 {
+	return pageSize - HEAP_HEADER_SIZE - LENGTH_SIZE
+}
+
+// Suffix of the file storing a table's heap.
+const HEAP_SUFFIX = ".heap"
+
+// HeapFile stores variable-length records in an append-only file.
+// Records are addressed by their record id, which is the record's byte offset in the file.
+type HeapFile struct {
+	pager    *pager.Pager
+	pageSize int64
+	numPages int64      // Number of pages in the heap; accessed atomically.
+	mtx      sync.Mutex // Serializes appends to the last page.
+}
+
+// Opens the heap file with the given filename.
+func OpenHeapFile(filename string) (*HeapFile, error) {
+	return OpenHeapFileWithPageSize(filename, pager.PAGESIZE)
+}
+
+// Opens the heap file with the given filename, made of pages of the given size.
+func OpenHeapFileWithPageSize(filename string, pageSize int64) (*HeapFile, error) {
+	pager, err := pager.NewPagerWithPageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+	err = pager.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &HeapFile{pager: pager, pageSize: pageSize, numPages: pager.GetNumPages()}, nil
+}
+
+// Creates a heap file that lives only in memory under the given name.
+func OpenMemoryHeapFile(name string) *HeapFile {
+	pager := pager.NewPager()
+	pager.OpenAnonymous(name)
+	return &HeapFile{pager: pager, pageSize: pager.GetPageSize()}
+}
+
+// Get pager.
+func (heap *HeapFile) GetPager() *pager.Pager {
+	return heap.pager
+}
+
+// Closes the heap file by closing the pager.
+func (heap *HeapFile) Close() error {
+	return heap.pager.Close()
+}
+
+// Append a record to the heap, returning its record id.
+func (heap *HeapFile) Append(data []byte) (int64, error) {
+	recordSize := int64(len(data))
+	if recordSize > MaxRecordSize(heap.pageSize) {
+		return -1, errors.New("record is too large")
+	}
+	heap.mtx.Lock()
+	defer heap.mtx.Unlock()
+	// Get the last page, or start a new one if the record doesn't fit.
+	pn := atomic.LoadInt64(&heap.numPages) - 1
+	var page *pager.Page
+	var used int64
+	var err error
+	if pn >= 0 {
+		if page, err = heap.pager.GetPage(pn); err != nil {
+			return -1, err
+		}
+		used, _ = binary.Varint((*page.GetData())[USED_OFFSET : USED_OFFSET+USED_SIZE])
+		if used+LENGTH_SIZE+recordSize > heap.pageSize {
+			page.Put()
+			page = nil
+		}
+	}
+	if page == nil {
+		if page, err = heap.pager.GetPage(pn + 1); err != nil {
+			return -1, err
+		}
+		used = HEAP_HEADER_SIZE
+	}
+	defer page.Put()
+	page.WLock()
+	defer page.WUnlock()
+	// Write the record, then bump the number of bytes in use.
+	lengthData := make([]byte, LENGTH_SIZE)
+	binary.PutVarint(lengthData, recordSize)
+	page.Update(lengthData, used, LENGTH_SIZE)
+	page.Update(data, used+LENGTH_SIZE, recordSize)
+	usedData := make([]byte, USED_SIZE)
+	binary.PutVarint(usedData, used+LENGTH_SIZE+recordSize)
+	page.Update(usedData, USED_OFFSET, USED_SIZE)
+	if page.GetPageNum() > pn {
+		atomic.StoreInt64(&heap.numPages, page.GetPageNum()+1)
+	}
+	return page.GetPageNum()*heap.pageSize + used, nil
+}
+
+// Read the record with the given record id.
+func (heap *HeapFile) Read(rid int64) ([]byte, error) {
+	pn, offset := rid/heap.pageSize, rid%heap.pageSize
+	if rid < 0 || pn >= atomic.LoadInt64(&heap.numPages) || offset < HEAP_HEADER_SIZE || offset+LENGTH_SIZE > heap.pageSize {
+		return nil, fmt.Errorf("invalid record id: %w", utils.ErrCorrupt)
+	}
+	page, err := heap.pager.GetPage(pn)
+	if err != nil {
+		return nil, err
+	}
+	defer page.Put()
+	page.RLock()
+	defer page.RUnlock()
+	data := *page.GetData()
+	recordSize, _ := binary.Varint(data[offset : offset+LENGTH_SIZE])
+	if recordSize < 0 || offset+LENGTH_SIZE+recordSize > heap.pageSize {
+		return nil, fmt.Errorf("invalid record id: %w", utils.ErrCorrupt)
+	}
+	record := make([]byte, recordSize)
+	copy(record, data[offset+LENGTH_SIZE:offset+LENGTH_SIZE+recordSize])
+	return record, nil
+}
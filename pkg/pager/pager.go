@@ -11,11 +11,12 @@ import (
 
 	config "github.com/brown-csci1270/db/pkg/config"
 	list "github.com/brown-csci1270/db/pkg/list"
+	utils "github.com/brown-csci1270/db/pkg/utils"
 
 	directio "github.com/ncw/directio"
 )
 
-// Page size - defaults to 4kb.
+// Default page size - 4kb. Pagers may use any multiple of it.
 const PAGESIZE = int64(directio.BlockSize)
 
 // Number of pages.
@@ -24,7 +25,10 @@ const NUMPAGES = config.NumPages
 // Pagers manage pages of data read from a file.
 type Pager struct {
 	file         *os.File             // File descriptor.
+	name         string               // Name of the pager, if not backed by a file.
 	nPages       int64                // The number of pages used by this database.
+	nFrames      int                  // The number of pages that can be buffered.
+	pageSize     int64                // The size of each page in bytes.
 	ptMtx        sync.Mutex           // Page table mutex.
 	freeList     *list.List           // Free page list.
 	unpinnedList *list.List           // Unpinned page list.
@@ -32,16 +36,32 @@ type Pager struct {
 	pageTable    map[int64]*list.Link // Page table.
 }
 
-// Construct a new Pager.
+// Construct a new Pager with pages of the default size.
 func NewPager() *Pager {
-	var pager *Pager = &Pager{}
+	pager, _ := NewPagerWithPageSize(PAGESIZE)
+	return pager
+}
+
+// Construct a new Pager with pages of the given size. Pages are read and written
+// with direct I/O, so the size must be a multiple of the default page size.
+func NewPagerWithPageSize(pageSize int64) (*Pager, error) {
+	if pageSize <= 0 || pageSize%PAGESIZE != 0 {
+		return nil, fmt.Errorf("page size must be a positive multiple of %d, got %d", PAGESIZE, pageSize)
+	}
+	var pager *Pager = &Pager{pageSize: pageSize}
 	pager.pageTable = make(map[int64]*list.Link)
 	pager.freeList = list.NewList()
 	pager.unpinnedList = list.NewList()
 	pager.pinnedList = list.NewList()
-	frames := directio.AlignedBlock(int(PAGESIZE * NUMPAGES))
-	for i := 0; i < NUMPAGES; i++ {
-		frame := frames[i*int(PAGESIZE) : (i+1)*int(PAGESIZE)]
+	pager.allocateFrames(NUMPAGES)
+	return pager, nil
+}
+
+// Add n empty frames to the free list.
+func (pager *Pager) allocateFrames(n int) {
+	frames := directio.AlignedBlock(int(pager.pageSize) * n)
+	for i := 0; i < n; i++ {
+		frame := frames[i*int(pager.pageSize) : (i+1)*int(pager.pageSize)]
 		page := Page{
 			pager:    pager,
 			pagenum:  NOPAGE,
@@ -51,7 +71,35 @@ func NewPager() *Pager {
 		}
 		pager.freeList.PushTail(&page)
 	}
-	return pager
+	pager.nFrames += n
+}
+
+// SetBufferSize sets the number of pages buffered by a pager backed by disk.
+// Shrinking only gives up pages that aren't pinned, so the buffer may stay larger.
+func (pager *Pager) SetBufferSize(n int) {
+	pager.ptMtx.Lock()
+	defer pager.ptMtx.Unlock()
+	// Pagers not backed by disk grow as needed anyway.
+	if !pager.HasFile() {
+		return
+	}
+	if n > pager.nFrames {
+		pager.allocateFrames(n - pager.nFrames)
+		return
+	}
+	for pager.nFrames > n {
+		if freeLink := pager.freeList.PeekHead(); freeLink != nil {
+			freeLink.PopSelf()
+		} else if unpinLink := pager.unpinnedList.PeekHead(); unpinLink != nil {
+			unpinLink.PopSelf()
+			page := unpinLink.GetKey().(*Page)
+			pager.FlushPage(page)
+			delete(pager.pageTable, page.pagenum)
+		} else {
+			return
+		}
+		pager.nFrames--
+	}
 }
 
 // HasFile checks if the pager is backed by disk.
@@ -59,11 +107,27 @@ func (pager *Pager) HasFile() bool {
 	return pager.file != nil
 }
 
-// GetFileName returns the file name.
+// GetFileName returns the file name, or the pager's name if it isn't backed by disk.
 func (pager *Pager) GetFileName() string {
+	if !pager.HasFile() {
+		return pager.name
+	}
 	return filepath.Base(pager.file.Name())
 }
 
+// GetFilePath returns the path the pager was opened with, or the pager's name if it isn't backed by disk.
+func (pager *Pager) GetFilePath() string {
+	if !pager.HasFile() {
+		return pager.name
+	}
+	return pager.file.Name()
+}
+
+// GetPageSize returns the size of each page in bytes.
+func (pager *Pager) GetPageSize() int64 {
+	return pager.pageSize
+}
+
 // GetNumPages returns the number of pages.
 func (pager *Pager) GetNumPages() int64 {
 	return pager.nPages
@@ -94,15 +158,22 @@ func (pager *Pager) Open(filename string) (err error) {
 	var len int64
 	if info, err = pager.file.Stat(); err == nil {
 		len = info.Size()
-		if len%PAGESIZE != 0 {
-			return errors.New("open: DB file has been corrupted")
+		if len%pager.pageSize != 0 {
+			return fmt.Errorf("open: DB file has been corrupted: %w", utils.ErrCorrupt)
 		}
 	}
 	// Set the number of pages and hand off initialization to someone else.
-	pager.nPages = len / PAGESIZE
+	pager.nPages = len / pager.pageSize
 	return nil
 }
 
+// OpenAnonymous initializes our pager without a backing file.
+// Anonymous pagers never evict pages; they grow their buffer as needed instead.
+func (pager *Pager) OpenAnonymous(name string) {
+	pager.name = name
+	pager.nPages = 0
+}
+
 // Close signals our pager to flush all dirty pages to disk.
 func (pager *Pager) Close() (err error) {
 	// Prevent new data from being paged in.
@@ -123,7 +194,7 @@ func (pager *Pager) Close() (err error) {
 
 // Populate a page's data field, given a pagenumber.
 func (pager *Pager) ReadPageFromDisk(page *Page, pagenum int64) error {
-	if _, err := pager.file.Seek(pagenum*PAGESIZE, 0); err != nil {
+	if _, err := pager.file.Seek(pagenum*pager.pageSize, 0); err != nil {
 		return err
 	}
 	if _, err := pager.file.Read(*page.data); err != nil && err != io.EOF {
@@ -148,6 +219,12 @@ func (pager *Pager) NewPage(pagenum int64) (*Page, error) {
 		newPage = unpinLink.GetKey().(*Page)
 		pager.FlushPage(newPage)
 		delete(pager.pageTable, newPage.pagenum)
+	} else if !pager.HasFile() {
+		// If our pager isn't backed by disk, grow the buffer instead.
+		pager.allocateFrames(NUMPAGES)
+		freeLink := pager.freeList.PeekHead()
+		freeLink.PopSelf()
+		newPage = freeLink.GetKey().(*Page)
 	} else {
 		// If still no page is found, error.
 		return nil, errors.New("no available pages")
@@ -215,7 +292,7 @@ func (pager *Pager) FlushPage(page *Page) {
 	if pager.HasFile() && page.IsDirty() {
 		pager.file.WriteAt(
 			*page.data,
-			page.pagenum*PAGESIZE,
+			page.pagenum*pager.pageSize,
 		)
 		page.SetDirty(false)
 	}
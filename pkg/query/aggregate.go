@@ -0,0 +1,289 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+// Aggregate functions.
+type AggregateFunc int64
+
+const (
+	Count AggregateFunc = 0
+	Sum   AggregateFunc = 1
+	Min   AggregateFunc = 2
+	Max   AggregateFunc = 3
+	Avg   AggregateFunc = 4 // Rounded toward zero.
+)
+
+// Get the name of an aggregate function.
+func (f AggregateFunc) String() string {
+	switch f {
+	case Count:
+		return "count"
+	case Sum:
+		return "sum"
+	case Min:
+		return "min"
+	case Max:
+		return "max"
+	case Avg:
+		return "avg"
+	default:
+		return fmt.Sprintf("AggregateFunc(%d)", int64(f))
+	}
+}
+
+// Parse an aggregate function from its name.
+func ParseAggregateFunc(s string) (AggregateFunc, error) {
+	for f := Count; f <= Avg; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid aggregate function %q", s)
+}
+
+// An aggregate computes one value over the tuples of a group. Count may leave
+// Arg nil to count tuples.
+type Aggregate struct {
+	Func AggregateFunc
+	Arg  Scalar
+}
+
+func (a Aggregate) String() string {
+	arg := "*"
+	if a.Arg != nil {
+		arg = a.Arg.String()
+	}
+	return fmt.Sprintf("%v(%s)", a.Func, arg)
+}
+
+// The running state of an aggregate over a group.
+type accumulator struct {
+	count, sum, min, max int64
+}
+
+func (acc *accumulator) add(v int64) {
+	if acc.count == 0 || v < acc.min {
+		acc.min = v
+	}
+	if acc.count == 0 || v > acc.max {
+		acc.max = v
+	}
+	acc.count++
+	acc.sum += v
+}
+
+// Get the value of an aggregate over the group. Aggregates other than count
+// are 0 over an empty group.
+func (acc *accumulator) result(f AggregateFunc) int64 {
+	switch f {
+	case Count:
+		return acc.count
+	case Sum:
+		return acc.sum
+	case Min:
+		return acc.min
+	case Max:
+		return acc.max
+	default:
+		if acc.count == 0 {
+			return 0
+		}
+		return acc.sum / acc.count
+	}
+}
+
+// Add a tuple to the accumulators of its group.
+func accumulate(accs []accumulator, aggs []Aggregate, t Tuple) (err error) {
+	for i, agg := range aggs {
+		var v int64
+		if agg.Arg != nil {
+			if v, err = agg.Arg.Eval(t); err != nil {
+				return err
+			}
+		}
+		accs[i].add(v)
+	}
+	return nil
+}
+
+// Build the output tuple of a group: its key, if grouped, then its aggregates.
+func groupTuple(grouped bool, key int64, accs []accumulator, aggs []Aggregate) Tuple {
+	var t Tuple
+	if grouped {
+		t = append(t, key)
+	}
+	for i, agg := range aggs {
+		t = append(t, accs[i].result(agg.Func))
+	}
+	return t
+}
+
+// Describe an aggregation operator.
+func describeAggregate(kind string, groupBy Scalar, aggs []Aggregate) string {
+	parts := make([]string, len(aggs))
+	for i, agg := range aggs {
+		parts[i] = agg.String()
+	}
+	s := kind + " " + strings.Join(parts, ", ")
+	if groupBy != nil {
+		s += " group by " + groupBy.String()
+	}
+	return s
+}
+
+// HashAggregate groups its input in an in-memory hash table, then returns a
+// tuple for each group in the order the groups were first seen. Without a
+// group by, all tuples form a single group, even if there are none.
+type HashAggregate struct {
+	child   Operator
+	groupBy Scalar
+	aggs    []Aggregate
+	results []Tuple
+}
+
+// Construct a hash aggregation. groupBy may be nil.
+func NewHashAggregate(child Operator, groupBy Scalar, aggs []Aggregate) *HashAggregate {
+	return &HashAggregate{child: child, groupBy: groupBy, aggs: aggs}
+}
+
+func (op *HashAggregate) Open() error {
+	groups := make(map[int64][]accumulator)
+	var order []int64
+	if op.groupBy == nil {
+		groups[0], order = make([]accumulator, len(op.aggs)), []int64{0}
+	}
+	err := Drain(op.child, func(t Tuple) (err error) {
+		var key int64
+		if op.groupBy != nil {
+			if key, err = op.groupBy.Eval(t); err != nil {
+				return err
+			}
+		}
+		accs, ok := groups[key]
+		if !ok {
+			accs = make([]accumulator, len(op.aggs))
+			groups[key], order = accs, append(order, key)
+		}
+		return accumulate(accs, op.aggs, t)
+	})
+	if err != nil {
+		return err
+	}
+	op.results = make([]Tuple, len(order))
+	for i, key := range order {
+		op.results[i] = groupTuple(op.groupBy != nil, key, groups[key], op.aggs)
+	}
+	return nil
+}
+
+func (op *HashAggregate) Next() (Tuple, error) {
+	if len(op.results) == 0 {
+		return nil, nil
+	}
+	t := op.results[0]
+	op.results = op.results[1:]
+	return t, nil
+}
+
+func (op *HashAggregate) Close() error {
+	op.results = nil
+	return nil
+}
+
+func (op *HashAggregate) String() string {
+	return describeAggregate("HashAggregate", op.groupBy, op.aggs)
+}
+
+func (op *HashAggregate) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// SortAggregate aggregates input that is already ordered by its group, one
+// group at a time, so only the current group is held in memory. Without a
+// group by, all tuples form a single group, even if there are none.
+type SortAggregate struct {
+	child   Operator
+	groupBy Scalar
+	aggs    []Aggregate
+	next    Tuple // The first tuple of the next group.
+	nextKey int64
+	done    bool
+}
+
+// Construct a sort aggregation. groupBy may be nil.
+func NewSortAggregate(child Operator, groupBy Scalar, aggs []Aggregate) *SortAggregate {
+	return &SortAggregate{child: child, groupBy: groupBy, aggs: aggs}
+}
+
+func (op *SortAggregate) Open() error {
+	op.done = false
+	if err := op.child.Open(); err != nil {
+		return err
+	}
+	return op.advance()
+}
+
+// Read the next input tuple and its group.
+func (op *SortAggregate) advance() (err error) {
+	if op.next, err = op.child.Next(); err != nil || op.next == nil || op.groupBy == nil {
+		return err
+	}
+	op.nextKey, err = op.groupBy.Eval(op.next)
+	return err
+}
+
+func (op *SortAggregate) Next() (Tuple, error) {
+	if op.done || (op.next == nil && op.groupBy != nil) {
+		return nil, nil
+	}
+	accs := make([]accumulator, len(op.aggs))
+	key := op.nextKey
+	for op.next != nil && (op.groupBy == nil || op.nextKey == key) {
+		if err := accumulate(accs, op.aggs, op.next); err != nil {
+			return nil, err
+		}
+		if err := op.advance(); err != nil {
+			return nil, err
+		}
+	}
+	op.done = op.groupBy == nil
+	return groupTuple(op.groupBy != nil, key, accs, op.aggs), nil
+}
+
+func (op *SortAggregate) Close() error {
+	op.next = nil
+	return op.child.Close()
+}
+
+func (op *SortAggregate) String() string {
+	return describeAggregate("SortAggregate", op.groupBy, op.aggs)
+}
+
+func (op *SortAggregate) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// Aggregate the entries of a table, grouped by "key" or "value", or all
+// together if groupBy is empty. Btrees grouped by key, and ungrouped tables,
+// are aggregated as they are read; anything else is hashed.
+func AggregateTable(name string, table db.Index, groupBy string, aggs []Aggregate) (Operator, error) {
+	scan := NewScan(name, table)
+	switch groupBy {
+	case "":
+		return NewSortAggregate(scan, nil, aggs), nil
+	case "key":
+		if isOrdered(table) {
+			return NewSortAggregate(scan, Column("key", 0), aggs), nil
+		}
+		return NewHashAggregate(scan, Column("key", 0), aggs), nil
+	case "value":
+		return NewHashAggregate(scan, Column("value", 1), aggs), nil
+	default:
+		return nil, fmt.Errorf("can only group by key or value, not %q", groupBy)
+	}
+}
@@ -1,32 +1,153 @@
 package query
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
 	bitset "github.com/bits-and-blooms/bitset"
-	hash "github.com/brown-csci1270/db/pkg/hash"
+	xxhash "github.com/cespare/xxhash"
+	murmur3 "github.com/spaolacci/murmur3"
 )
 
 type BloomFilter struct {
-	size int64
-	bits *bitset.BitSet
+	size      int64 // Number of bits.
+	numHashes int64 // Number of bits set per key.
+	bits      *bitset.BitSet
 }
 
-// CreateFilter initializes a BloomFilter with the given size.
-func CreateFilter(size int64) *BloomFilter {
-	bloom_filter := BloomFilter{size: size, bits: bitset.New(uint(size))}
+// CreateFilter initializes a BloomFilter with the given number of bits, setting
+// numHashes of them per key.
+func CreateFilter(size int64, numHashes int64) *BloomFilter {
+	if size < 1 {
+		size = 1
+	}
+	if numHashes < 1 {
+		numHashes = 1
+	}
+	bloom_filter := BloomFilter{size: size, numHashes: numHashes, bits: bitset.New(uint(size))}
 	return &bloom_filter
 }
 
+// CreateFilterFor initializes a BloomFilter sized to hold expectedItems keys
+// with the given false positive rate.
+func CreateFilterFor(expectedItems int64, falsePositiveRate float64) (*BloomFilter, error) {
+	if err := checkFalsePositiveRate(falsePositiveRate); err != nil {
+		return nil, err
+	}
+	if expectedItems < 1 {
+		expectedItems = 1
+	}
+	// m = -n ln(p) / ln(2)^2 bits and k = (m / n) ln(2) hashes are optimal.
+	size := math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	numHashes := math.Round(size / float64(expectedItems) * math.Ln2)
+	return CreateFilter(int64(size), int64(numHashes)), nil
+}
+
+// Check that a false positive rate is strictly between 0 and 1; anything else
+// can't size a filter.
+func checkFalsePositiveRate(rate float64) error {
+	if !(rate > 0 && rate < 1) {
+		return fmt.Errorf("false positive rate must be between 0 and 1, got %v", rate)
+	}
+	return nil
+}
+
+// Get the number of bits in the filter.
+func (filter *BloomFilter) GetSize() int64 {
+	return filter.size
+}
+
+// Get the number of bits set per key.
+func (filter *BloomFilter) GetNumHashes() int64 {
+	return filter.numHashes
+}
+
+// Hash a key twice. Bit i of the key's k bits is h1 + i*h2, mod the size. h2 is
+// kept between 1 and size-1, since a multiple of the size would put every bit
+// in the same place.
+func (filter *BloomFilter) hashPair(key int64) (uint64, uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(buf, key)
+	size := uint64(filter.size)
+	h1, h2 := murmur3.Sum64(buf)%size, xxhash.Sum64(buf)
+	if size > 1 {
+		h2 = h2%(size-1) + 1
+	}
+	return h1, h2
+}
+
 // Insert adds an element into the bloom filter.
 func (filter *BloomFilter) Insert(key int64) {
-	hash1 := hash.MurmurHasher(key, filter.size)
-	hash2 := hash.XxHasher(key, filter.size)
-	filter.bits.Set(hash1)
-	filter.bits.Set(hash2)
+	h1, h2 := filter.hashPair(key)
+	for i := int64(0); i < filter.numHashes; i++ {
+		filter.bits.Set(uint((h1 + uint64(i)*h2) % uint64(filter.size)))
+	}
 }
 
 // Contains checks if the given key can be found in the bloom filter/
 func (filter *BloomFilter) Contains(key int64) bool {
-	hash1 := hash.MurmurHasher(key, filter.size)
-	hash2 := hash.XxHasher(key, filter.size)
-	return filter.bits.Test(hash1) && filter.bits.Test(hash2)
+	h1, h2 := filter.hashPair(key)
+	for i := int64(0); i < filter.numHashes; i++ {
+		if !filter.bits.Test(uint((h1 + uint64(i)*h2) % uint64(filter.size))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Estimate the false positive rate from the fraction of bits set.
+func (filter *BloomFilter) EstimatedFalsePositiveRate() float64 {
+	fill := float64(filter.bits.Count()) / float64(filter.size)
+	return math.Pow(fill, float64(filter.numHashes))
+}
+
+// Union adds every key in other to the filter. Both filters must have the same
+// size and number of hashes.
+func (filter *BloomFilter) Union(other *BloomFilter) error {
+	if filter.size != other.size || filter.numHashes != other.numHashes {
+		return fmt.Errorf("can't union a %d-bit, %d-hash filter with a %d-bit, %d-hash filter",
+			filter.size, filter.numHashes, other.size, other.numHashes)
+	}
+	filter.bits.InPlaceUnion(other.bits)
+	return nil
+}
+
+// Serialize the filter as its size and number of hashes, then its bits.
+func (filter *BloomFilter) MarshalBinary() ([]byte, error) {
+	bits, err := filter.bits.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 2*binary.MaxVarintLen64, 2*binary.MaxVarintLen64+len(bits))
+	n := binary.PutVarint(buf, filter.size)
+	n += binary.PutVarint(buf[n:], filter.numHashes)
+	return append(buf[:n], bits...), nil
+}
+
+// Deserialize a filter written by MarshalBinary.
+func (filter *BloomFilter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	size, err := binary.ReadVarint(r)
+	if err != nil {
+		return err
+	}
+	numHashes, err := binary.ReadVarint(r)
+	if err != nil {
+		return err
+	}
+	if size < 1 || numHashes < 1 {
+		return errors.New("invalid bloom filter header")
+	}
+	bits := &bitset.BitSet{}
+	if err = bits.UnmarshalBinary(data[len(data)-r.Len():]); err != nil {
+		return err
+	}
+	if bits.Len() != uint(size) {
+		return fmt.Errorf("bloom filter has %d bits, expected %d", bits.Len(), size)
+	}
+	filter.size, filter.numHashes, filter.bits = size, numHashes, bits
+	return nil
 }
@@ -0,0 +1,369 @@
+package query
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+// Each tuple held in memory costs its values and sort key, plus about this
+// many bytes for their slice headers.
+const sortTupleOverhead = 48
+
+// Runs are read back through buffers of this size, which bounds how many runs
+// can be merged at once within the memory budget.
+const sortReadBufferSize = 4096
+
+// ExternalSort sorts its input within a memory budget. Input that doesn't fit
+// is sorted in runs that are spilled to temporary files, then merged. Ties keep
+// the order of the input.
+type ExternalSort struct {
+	child  Operator
+	terms  []SortTerm
+	memory int64      // Bytes of tuples to hold in memory before spilling a run.
+	tuples []Tuple    // The sorted input, if it fit in memory.
+	runs   []string   // Temporary files holding sorted runs.
+	merger *runMerger // Merges the runs, if the input didn't fit in memory.
+}
+
+// Construct an external sort that holds up to memory bytes of tuples at once.
+func NewExternalSort(child Operator, terms []SortTerm, memory int64) *ExternalSort {
+	return &ExternalSort{child: child, terms: terms, memory: memory}
+}
+
+func (op *ExternalSort) Open() (err error) {
+	op.Close()
+	defer func() {
+		if err != nil {
+			op.Close()
+		}
+	}()
+	var tuples, keys []Tuple
+	var used int64
+	spill := func() error {
+		path, err := writeRun(sortTuples(tuples, keys, op.terms))
+		if err != nil {
+			return err
+		}
+		op.runs = append(op.runs, path)
+		tuples, keys, used = nil, nil, 0
+		return nil
+	}
+	err = Drain(op.child, func(t Tuple) error {
+		key, err := sortKey(t, op.terms)
+		if err != nil {
+			return err
+		}
+		tuples = append(tuples, t)
+		keys = append(keys, key)
+		used += 8*int64(len(t)+len(key)) + sortTupleOverhead
+		if used >= op.memory {
+			return spill()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(op.runs) == 0 {
+		op.tuples = sortTuples(tuples, keys, op.terms)
+		return nil
+	}
+	if len(tuples) > 0 {
+		if err = spill(); err != nil {
+			return err
+		}
+	}
+	// Merge consecutive runs, keeping them in input order, until few enough
+	// remain to read at once.
+	fanIn := int(op.memory / sortReadBufferSize)
+	if fanIn < 2 {
+		fanIn = 2
+	}
+	for len(op.runs) > fanIn {
+		var merged []string
+		for len(op.runs) > 0 {
+			n := fanIn
+			if n > len(op.runs) {
+				n = len(op.runs)
+			}
+			path, err := mergeRuns(op.runs[:n], op.terms)
+			if err != nil {
+				op.runs = append(merged, op.runs...)
+				return err
+			}
+			removeRuns(op.runs[:n])
+			merged, op.runs = append(merged, path), op.runs[n:]
+		}
+		op.runs = merged
+	}
+	op.merger, err = openMerger(op.runs, op.terms)
+	return err
+}
+
+func (op *ExternalSort) Next() (Tuple, error) {
+	if op.merger != nil {
+		return op.merger.next()
+	}
+	if len(op.tuples) == 0 {
+		return nil, nil
+	}
+	t := op.tuples[0]
+	op.tuples = op.tuples[1:]
+	return t, nil
+}
+
+func (op *ExternalSort) Close() (err error) {
+	if op.merger != nil {
+		err = op.merger.close()
+		op.merger = nil
+	}
+	removeRuns(op.runs)
+	op.tuples, op.runs = nil, nil
+	return err
+}
+
+func (op *ExternalSort) String() string {
+	return "ExternalSort " + describeTerms(op.terms)
+}
+
+func (op *ExternalSort) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// Delete the files of spilled runs.
+func removeRuns(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// Writes tuples to a run file, each as its length then its values, as varints.
+type runWriter struct {
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	buf    []byte
+}
+
+// Create a run in a new temporary file.
+func createRun() (*runWriter, error) {
+	path, err := db.GetTempDB()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return &runWriter{path: path, file: file, writer: bufio.NewWriter(file), buf: make([]byte, binary.MaxVarintLen64)}, nil
+}
+
+func (w *runWriter) write(t Tuple) error {
+	n := binary.PutUvarint(w.buf, uint64(len(t)))
+	if _, err := w.writer.Write(w.buf[:n]); err != nil {
+		return err
+	}
+	for _, v := range t {
+		n = binary.PutVarint(w.buf, v)
+		if _, err := w.writer.Write(w.buf[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish the run, deleting it if anything went wrong.
+func (w *runWriter) close(err error) (string, error) {
+	if err == nil {
+		err = w.writer.Flush()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(w.path)
+		return "", err
+	}
+	return w.path, nil
+}
+
+// Write sorted tuples to a new run.
+func writeRun(tuples []Tuple) (string, error) {
+	w, err := createRun()
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tuples {
+		if err = w.write(t); err != nil {
+			break
+		}
+	}
+	return w.close(err)
+}
+
+// Merge runs into a new run.
+func mergeRuns(paths []string, terms []SortTerm) (string, error) {
+	m, err := openMerger(paths, terms)
+	if err != nil {
+		return "", err
+	}
+	defer m.close()
+	w, err := createRun()
+	if err != nil {
+		return "", err
+	}
+	for {
+		var t Tuple
+		if t, err = m.next(); err != nil || t == nil {
+			break
+		}
+		if err = w.write(t); err != nil {
+			break
+		}
+	}
+	return w.close(err)
+}
+
+// Reads a run back.
+type runReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// Open a run for reading.
+func openRun(path string) (*runReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &runReader{file: file, reader: bufio.NewReaderSize(file, sortReadBufferSize)}, nil
+}
+
+func (r *runReader) close() error {
+	return r.file.Close()
+}
+
+// Get the next tuple of the run, or nil at its end.
+func (r *runReader) next() (Tuple, error) {
+	n, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t := make(Tuple, n)
+	for i := range t {
+		if t[i], err = binary.ReadVarint(r.reader); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// The next tuple of a run being merged.
+type mergeItem struct {
+	t   Tuple
+	key Tuple
+	run int
+}
+
+// Merges sorted runs through a heap of the next tuple of each. Ties go to the
+// earlier run, so merging runs in input order keeps the sort stable.
+type runMerger struct {
+	runs  []*runReader
+	items []mergeItem
+	terms []SortTerm
+}
+
+func (m *runMerger) Len() int {
+	return len(m.items)
+}
+
+func (m *runMerger) Less(i, j int) bool {
+	if c := compareKeys(m.items[i].key, m.items[j].key, m.terms); c != 0 {
+		return c < 0
+	}
+	return m.items[i].run < m.items[j].run
+}
+
+func (m *runMerger) Swap(i, j int) {
+	m.items[i], m.items[j] = m.items[j], m.items[i]
+}
+
+func (m *runMerger) Push(x interface{}) {
+	m.items = append(m.items, x.(mergeItem))
+}
+
+func (m *runMerger) Pop() interface{} {
+	item := m.items[len(m.items)-1]
+	m.items = m.items[:len(m.items)-1]
+	return item
+}
+
+// Open runs for merging.
+func openMerger(paths []string, terms []SortTerm) (*runMerger, error) {
+	m := &runMerger{terms: terms}
+	for i, path := range paths {
+		run, err := openRun(path)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.runs = append(m.runs, run)
+		item, err := m.read(i)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		if item.t != nil {
+			m.items = append(m.items, item)
+		}
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+// Read the next tuple of a run.
+func (m *runMerger) read(run int) (item mergeItem, err error) {
+	item.run = run
+	if item.t, err = m.runs[run].next(); err != nil || item.t == nil {
+		return item, err
+	}
+	item.key, err = sortKey(item.t, m.terms)
+	return item, err
+}
+
+// Get the next tuple in order, or nil once every run is done.
+func (m *runMerger) next() (Tuple, error) {
+	if len(m.items) == 0 {
+		return nil, nil
+	}
+	t := m.items[0].t
+	item, err := m.read(m.items[0].run)
+	if err != nil {
+		return nil, err
+	}
+	if item.t == nil {
+		heap.Pop(m)
+	} else {
+		m.items[0] = item
+		heap.Fix(m, 0)
+	}
+	return t, nil
+}
+
+func (m *runMerger) close() (err error) {
+	for _, run := range m.runs {
+		if closeErr := run.close(); err == nil {
+			err = closeErr
+		}
+	}
+	m.runs, m.items = nil, nil
+	return err
+}
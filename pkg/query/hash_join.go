@@ -2,78 +2,173 @@ package query
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"os"
+	"encoding/binary"
+	"sync/atomic"
 
+	config "github.com/brown-csci1270/db/pkg/config"
 	db "github.com/brown-csci1270/db/pkg/db"
 	hash "github.com/brown-csci1270/db/pkg/hash"
 	utils "github.com/brown-csci1270/db/pkg/utils"
 
+	murmur3 "github.com/spaolacci/murmur3"
 	errgroup "golang.org/x/sync/errgroup"
 )
 
-var DEFAULT_FILTER_SIZE int64 = 1024
+// Each entry held in a partition's in-memory hash table costs about this many bytes.
+const joinEntryCost = 64
 
-// Entry pair struct - output of a join.
+// Each entry takes up about this many bytes of a table's pages.
+const joinEntryDiskSize = 16
+
+// Most partitions written at once; each holds an open file and a write buffer.
+var MAX_JOIN_PARTITIONS = 64
+
+// Partitions that still don't fit in memory after this many rounds of
+// repartitioning, e.g. because of a single hot key, are joined in memory anyway.
+var MAX_REPARTITION_DEPTH = 3
+
+// JoinOptions tune a Grace hash join. Zero fields take the defaults from config.
+type JoinOptions struct {
+	FalsePositiveRate float64    // Target false positive rate of the Bloom filter over each partition.
+	Memory            int64      // Bytes of partitions held in memory at once, across all workers.
+	Workers           int        // Number of partitions probed in parallel.
+	Stats             *JoinStats // If set, filled in as the join runs.
+}
+
+// JoinStats count how well a join's Bloom filters screened out left entries
+// without a match, and how often partitions overflowed. Updated atomically,
+// since partitions are probed in parallel.
+type JoinStats struct {
+	Probes         int64 // Left entries checked against a filter.
+	Rejected       int64 // Left entries the filter ruled out.
+	FalsePositives int64 // Left entries the filter passed that had no match.
+	Repartitions   int64 // Partitions split again because they didn't fit in memory.
+}
+
+// Get the fraction of left entries without a match that the filters passed.
+func (stats *JoinStats) FalsePositiveRate() float64 {
+	negatives := atomic.LoadInt64(&stats.Rejected) + atomic.LoadInt64(&stats.FalsePositives)
+	if negatives == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&stats.FalsePositives)) / float64(negatives)
+}
+
+// Fill in the defaults of unset options.
+func (opts JoinOptions) withDefaults() JoinOptions {
+	if opts.FalsePositiveRate == 0 {
+		opts.FalsePositiveRate = config.BloomFalsePositiveRate
+	}
+	if opts.Memory <= 0 {
+		opts.Memory = config.JoinMemory
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = config.JoinWorkers
+	}
+	return opts
+}
+
+// Entry pair struct - output of a join. Outer joins leave the missing side nil;
+// semi and anti joins only set l.
 type EntryPair struct {
 	l utils.Entry
 	r utils.Entry
 }
 
-// Int pair struct - to keep track of seen bucket pairs.
-type pair struct {
-	l int64
-	r int64
+// A partition of each input, spilled to temporary files as (key, value) tuples.
+type partition struct {
+	left, right string
+	rightCount  int64 // Number of entries in the right file.
+	level       int   // Number of times these entries have been partitioned.
 }
 
-// buildHashIndex constructs a temporary hash table for all the entries in the given sourceTable.
-func buildHashIndex(
-	sourceTable db.Index,
-	useKey bool,
-) (tempIndex *hash.HashIndex, dbName string, err error) {
-	// Get a temporary db file.
-	dbName, err = db.GetTempDB()
-	if err != nil {
-		return nil, "", err
+// Get the attribute an entry is joined on.
+func joinAttr(t Tuple, useKey bool) int64 {
+	if useKey {
+		return t[0]
 	}
-	// Init the temporary hash table.
-	tempIndex, err = hash.OpenTable(dbName)
-	if err != nil {
-		return nil, "", err
-	}
-	// Build the hash index.
-	// get start cursor
-	cursor, step_err := sourceTable.TableStart()
-	if step_err != nil {
-		return nil, "", err
-	}
-	// before reaching end, do while loop by using stepForward
-	for step_err == nil {
-		if cursor.IsEnd() {
-			step_err = cursor.StepForward()
-			continue
+	return t[1]
+}
+
+// Get the partition of a join attribute, hashing with a different seed at each
+// level so entries that collided at one level are spread out at the next.
+func partitionOf(attr int64, level int, n int) int {
+	buf := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(buf, attr)
+	return int(murmur3.Sum64WithSeed(buf, uint32(level)) % uint64(n))
+}
+
+// Call fn on each entry of a table.
+func scanTable(table db.Index) func(fn func(Tuple) error) error {
+	return func(fn func(Tuple) error) error {
+		return Drain(NewScan(table.GetName(), table), fn)
+	}
+}
+
+// Call fn on each tuple of a spilled file.
+func scanRun(path string) func(fn func(Tuple) error) error {
+	return func(fn func(Tuple) error) error {
+		run, err := openRun(path)
+		if err != nil {
+			return err
+		}
+		defer run.close()
+		for {
+			t, err := run.next()
+			if err != nil || t == nil {
+				return err
+			}
+			if err = fn(t); err != nil {
+				return err
+			}
 		}
-		cur_entry, err := cursor.GetEntry()
-		// get the current entry
+	}
+}
+
+// Split entries into n files by their join attribute, counting the entries in each.
+func partitionEntries(scan func(fn func(Tuple) error) error, useKey bool, level int, n int) ([]string, []int64, error) {
+	writers := make([]*runWriter, 0, n)
+	abort := func(err error) ([]string, []int64, error) {
+		for _, w := range writers {
+			w.close(err)
+		}
+		return nil, nil, err
+	}
+	for i := 0; i < n; i++ {
+		w, err := createRun()
 		if err != nil {
-			return nil, "", err
+			return abort(err)
 		}
-		if useKey {
-			// fmt.Println("hash_join/buildHashIndex: usekey, steping forward, entry: ", cur_entry.GetKey(), cur_entry.GetValue())
-			tempIndex.Insert(cur_entry.GetKey(), cur_entry.GetValue())
-		} else {
-			// fmt.Println("hash_join/buildHashIndex: not usekey, steping forward, entry: ", cur_entry.GetKey(), cur_entry.GetValue())
-			tempIndex.Insert(cur_entry.GetValue(), cur_entry.GetKey())
+		writers = append(writers, w)
+	}
+	counts := make([]int64, n)
+	err := scan(func(t Tuple) error {
+		i := partitionOf(joinAttr(t, useKey), level, n)
+		counts[i]++
+		return writers[i].write(t)
+	})
+	// Once anything fails, the remaining files are deleted as they're closed.
+	paths := make([]string, n)
+	for i, w := range writers {
+		path, closeErr := w.close(err)
+		if err == nil {
+			err = closeErr
 		}
-		// step forward
-		step_err = cursor.StepForward()
-		// if step_err != nil {
-		// 	// fmt.Println("step_err:", step_err, cur_entry.GetKey(), cur_entry.GetValue())
-		// 	break
-		// }
-	}
-	return tempIndex, dbName, nil
+		paths[i] = path
+	}
+	if err != nil {
+		removeRuns(paths)
+		return nil, nil, err
+	}
+	return paths, counts, nil
+}
+
+// Build an entry from a (key, value) tuple.
+func tupleEntry(t Tuple) utils.Entry {
+	entry := hash.HashEntry{}
+	entry.SetKey(t[0])
+	entry.SetValue(t[1])
+	return entry
 }
 
 // sendResult attempts to send a single join result to the resultsChan channel as long as the errgroup hasn't been cancelled.
@@ -90,191 +185,187 @@ func sendResult(
 	}
 }
 
-// See which entries in rBucket have a match in lBucket.
-func probeBuckets(
-	ctx context.Context,
-	resultsChan chan EntryPair,
-	lBucket *hash.HashBucket,
-	rBucket *hash.HashBucket,
-	joinOnLeftKey bool,
-	joinOnRightKey bool,
-) error {
-	defer lBucket.GetPage().Put()
-	defer rBucket.GetPage().Put()
-	// Probe buckets.
-	fmt.Println("enter hash_join/probeBuckets")
-	// get the left bucket entrys
-	left_entrys, err := lBucket.Select()
+// A Grace hash join in progress.
+type graceJoin struct {
+	ctx            context.Context
+	resultsChan    chan EntryPair
+	joinOnLeftKey  bool
+	joinOnRightKey bool
+	joinType       JoinType
+	opts           JoinOptions
+	budget         int64 // Bytes of a partition each worker can hold in memory.
+	fanOut         int   // Number of partitions to split an input into.
+}
+
+// Join a partition of each input, deleting their files when done. Partitions
+// too big to fit in memory are split again.
+func (j *graceJoin) probePartition(p partition) error {
+	defer removeRuns([]string{p.left, p.right})
+	if p.rightCount*joinEntryCost > j.budget && p.level < MAX_REPARTITION_DEPTH {
+		return j.repartition(p)
+	}
+	// Build a hash table and Bloom filter over the right partition.
+	var rights []Tuple
+	table := make(map[int64][]int)
+	filter, err := CreateFilterFor(p.rightCount, j.opts.FalsePositiveRate)
 	if err != nil {
 		return err
 	}
-	
-	right_entrys, err := rBucket.Select()
+	err = scanRun(p.right)(func(r Tuple) error {
+		attr := joinAttr(r, j.joinOnRightKey)
+		table[attr] = append(table[attr], len(rights))
+		rights = append(rights, r)
+		filter.Insert(attr)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Println("length", len(left_entrys), len(right_entrys))
-	// create bloom filter for right bucket
-	bloom_filter := CreateFilter(DEFAULT_FILTER_SIZE)
-
-	for _, r_entry := range right_entrys {
-		bloom_filter.Insert(r_entry.GetKey())
+	// Stream the left partition past it.
+	rightMatched := make([]bool, len(rights))
+	var probes, rejected, falsePositives int64
+	err = scanRun(p.left)(func(l Tuple) error {
+		attr := joinAttr(l, j.joinOnLeftKey)
+		probes++
+		var matches []int
+		if !filter.Contains(attr) {
+			rejected++
+		} else if matches = table[attr]; len(matches) == 0 {
+			falsePositives++
+		}
+		switch {
+		case j.joinType == SemiJoin && len(matches) > 0, j.joinType == AntiJoin && len(matches) == 0:
+			return sendResult(j.ctx, j.resultsChan, EntryPair{l: tupleEntry(l)})
+		case j.joinType == SemiJoin || j.joinType == AntiJoin:
+			return nil
+		case len(matches) == 0 && j.joinType.keepsUnmatchedLeft():
+			return sendResult(j.ctx, j.resultsChan, EntryPair{l: tupleEntry(l)})
+		}
+		for _, i := range matches {
+			rightMatched[i] = true
+			if err := sendResult(j.ctx, j.resultsChan, EntryPair{tupleEntry(l), tupleEntry(rights[i])}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if stats := j.opts.Stats; stats != nil {
+		atomic.AddInt64(&stats.Probes, probes)
+		atomic.AddInt64(&stats.Rejected, rejected)
+		atomic.AddInt64(&stats.FalsePositives, falsePositives)
 	}
-
-	// iterate the left table
-	for idx, l_entry := range left_entrys {
-		contain := bloom_filter.Contains(l_entry.GetKey())
-		
-		if contain {
-			fmt.Println(idx, "iteration, contain")
-			// left: key, right: key
-			if joinOnLeftKey && joinOnRightKey{
-				// start to iterate the right bucket
-				fmt.Println("hash_join/probebucket: left-key, right-key")
-				for idx2, r_entry := range right_entrys {
-					if l_entry.GetKey() == r_entry.GetKey() {
-						// fmt.Println("equal", idx, idx2)
-						left := hash.HashEntry{}
-						left.SetKey(l_entry.GetKey())
-						left.SetValue(l_entry.GetValue())
-						right := hash.HashEntry{}
-						right.SetKey(r_entry.GetKey())
-						right.SetValue(r_entry.GetValue())
-						err := sendResult(ctx, resultsChan, EntryPair{left, right})
-						if err != nil {
-							fmt.Println("errrrr", idx, idx2, left.GetKey(), left.GetValue(), right.GetKey(), right.GetValue())
-							return err
-						}
-					}
-				}
-			// left: value, right: value
-			} else if !joinOnLeftKey && !joinOnRightKey {
-				fmt.Println("hash_join/probebucket: left-value, right-value")
-				// start to iterate the right bucket
-				for _, r_entry := range right_entrys {
-					if l_entry.GetKey() == r_entry.GetKey() {
-						left := hash.HashEntry{}
-						left.SetKey(l_entry.GetValue())
-						left.SetValue(l_entry.GetKey())
-						right := hash.HashEntry{}
-						right.SetKey(r_entry.GetValue())
-						right.SetValue(r_entry.GetKey())
-						err := sendResult(ctx, resultsChan, EntryPair{left, right})
-						if err != nil {
-							return err
-						}
-					}
-				}
-			// left: key, right: value
-			} else if joinOnLeftKey && !joinOnRightKey{
-				fmt.Println("hash_join/probebucket: left-key, right-value")
-				// start to iterate the right bucket
-				for _, r_entry := range right_entrys {
-					if l_entry.GetKey() == r_entry.GetKey() {
-						left := hash.HashEntry{}
-						left.SetKey(l_entry.GetKey())
-						left.SetValue(l_entry.GetValue())
-						right := hash.HashEntry{}
-						right.SetKey(r_entry.GetValue())
-						right.SetValue(r_entry.GetKey())
-						err := sendResult(ctx, resultsChan, EntryPair{left, right})
-						if err != nil {
-							return err
-						}
-					}
-				}
-			// left: value, right: key
-			} else if !joinOnLeftKey && joinOnRightKey{
-				fmt.Println("hash_join/probebucket: left-value, right-key")
-				// start to iterate the right bucket
-				for _, r_entry := range right_entrys {
-					if l_entry.GetKey() == r_entry.GetKey() {
-						left := hash.HashEntry{}
-						left.SetKey(l_entry.GetValue())
-						left.SetValue(l_entry.GetKey())
-						right := hash.HashEntry{}
-						right.SetKey(r_entry.GetKey())
-						right.SetValue(r_entry.GetValue())
-						err := sendResult(ctx, resultsChan, EntryPair{left, right})
-						if err != nil {
-							return err
-						}
-					}
-				}
-			// else invalid
-			} else {
-				return errors.New("hash_join/probeBuckets: join key error")
+	if err != nil || !j.joinType.keepsUnmatchedRight() {
+		return err
+	}
+	for i, r := range rights {
+		if !rightMatched[i] {
+			if err := sendResult(j.ctx, j.resultsChan, EntryPair{r: tupleEntry(r)}); err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
-// Join leftTable on rightTable using Grace Hash Join.
+// Split an overflowing partition of each input and join the pieces.
+func (j *graceJoin) repartition(p partition) error {
+	if j.opts.Stats != nil {
+		atomic.AddInt64(&j.opts.Stats.Repartitions, 1)
+	}
+	lefts, _, err := partitionEntries(scanRun(p.left), j.joinOnLeftKey, p.level+1, j.fanOut)
+	if err != nil {
+		return err
+	}
+	rights, counts, err := partitionEntries(scanRun(p.right), j.joinOnRightKey, p.level+1, j.fanOut)
+	if err != nil {
+		removeRuns(lefts)
+		return err
+	}
+	for i := range lefts {
+		if err = j.probePartition(partition{lefts[i], rights[i], counts[i], p.level + 1}); err != nil {
+			removeRuns(lefts[i+1:])
+			removeRuns(rights[i+1:])
+			return err
+		}
+	}
+	return nil
+}
+
+// Join leftTable on rightTable using Grace Hash Join. Both tables are split
+// into partitions by hashing their join attributes, so that each partition of
+// the right table fits in a worker's share of the memory budget; a pool of
+// workers then joins matching partitions in parallel.
 func Join(
 	ctx context.Context,
 	leftTable db.Index,
 	rightTable db.Index,
 	joinOnLeftKey bool,
 	joinOnRightKey bool,
+	joinType JoinType,
+	opts JoinOptions,
 ) (chan EntryPair, context.Context, *errgroup.Group, func(), error) {
-	leftHashIndex, leftDbName, err := buildHashIndex(leftTable, joinOnLeftKey)
+	opts = opts.withDefaults()
+	if err := checkFalsePositiveRate(opts.FalsePositiveRate); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	budget := opts.Memory / int64(opts.Workers)
+	// Every partition being written holds a write buffer.
+	fanOut := int(opts.Memory / sortReadBufferSize)
+	if fanOut > MAX_JOIN_PARTITIONS {
+		fanOut = MAX_JOIN_PARTITIONS
+	}
+	if fanOut < 2 {
+		fanOut = 2
+	}
+	// Estimate how many partitions it takes for each right partition to fit in
+	// a worker's budget, using at least one per worker.
+	rightEntries := rightTable.GetPager().GetNumPages() * rightTable.GetPager().GetPageSize() / joinEntryDiskSize
+	n := int((rightEntries*joinEntryCost + budget - 1) / budget)
+	if n < opts.Workers {
+		n = opts.Workers
+	}
+	if n > fanOut {
+		n = fanOut
+	}
+	lefts, _, err := partitionEntries(scanTable(leftTable), joinOnLeftKey, 0, n)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-	rightHashIndex, rightDbName, err := buildHashIndex(rightTable, joinOnRightKey)
+	rights, counts, err := partitionEntries(scanTable(rightTable), joinOnRightKey, 0, n)
 	if err != nil {
-		os.Remove(leftDbName)
-		os.Remove(leftDbName + ".meta")
+		removeRuns(lefts)
 		return nil, nil, nil, nil, err
 	}
 	cleanupCallback := func() {
-		os.Remove(leftDbName)
-		os.Remove(leftDbName + ".meta")
-		os.Remove(rightDbName)
-		os.Remove(rightDbName + ".meta")
-	}
-	// Make both hash indices the same global size.
-	leftHashTable := leftHashIndex.GetTable()
-	rightHashTable := rightHashIndex.GetTable()
-	for leftHashTable.GetDepth() != rightHashTable.GetDepth() {
-		if leftHashTable.GetDepth() < rightHashTable.GetDepth() {
-			// Split the left table
-			leftHashTable.ExtendTable()
-		} else {
-			// Split the right table
-			rightHashTable.ExtendTable()
-		}
+		removeRuns(lefts)
+		removeRuns(rights)
 	}
-	// Probe phase: match buckets to buckets and emit entries that match.
+	// Probe phase: workers take partitions off a queue and emit entries that match.
 	group, ctx := errgroup.WithContext(ctx)
 	resultsChan := make(chan EntryPair, 1024)
-	// Iterate through hash buckets, keeping track of pairs we've seen before.
-	leftBuckets := leftHashTable.GetBuckets()
-	rightBuckets := rightHashTable.GetBuckets()
-	seenList := make(map[pair]bool)
-	for i, lBucketPN := range leftBuckets {
-		rBucketPN := rightBuckets[i]
-		bucketPair := pair{l: lBucketPN, r: rBucketPN}
-		if _, seen := seenList[bucketPair]; seen {
-			continue
-		}
-		seenList[bucketPair] = true
-
-		lBucket, err := leftHashTable.GetBucketByPN(lBucketPN, hash.NO_LOCK)
-		if err != nil {
-			return nil, nil, nil, cleanupCallback, err
-		}
-		rBucket, err := rightHashTable.GetBucketByPN(rBucketPN, hash.NO_LOCK)
-		if err != nil {
-			lBucket.GetPage().Put()
-			return nil, nil, nil, cleanupCallback, err
-		}
-		// l_res, _:=lBucket.Select()
-		// r_res, _:=rBucket.Select()
-		// fmt.Println("hash_join/Join: left, right: ", len(l_res), len(r_res))
+	j := &graceJoin{
+		ctx:            ctx,
+		resultsChan:    resultsChan,
+		joinOnLeftKey:  joinOnLeftKey,
+		joinOnRightKey: joinOnRightKey,
+		joinType:       joinType,
+		opts:           opts,
+		budget:         budget,
+		fanOut:         fanOut,
+	}
+	partitions := make(chan partition, n)
+	for i := range lefts {
+		partitions <- partition{lefts[i], rights[i], counts[i], 0}
+	}
+	close(partitions)
+	for w := 0; w < opts.Workers; w++ {
 		group.Go(func() error {
-			return probeBuckets(ctx, resultsChan, lBucket, rBucket, joinOnLeftKey, joinOnRightKey)
+			for p := range partitions {
+				if err := j.probePartition(p); err != nil {
+					return err
+				}
+			}
+			return nil
 		})
 	}
 	return resultsChan, ctx, group, cleanupCallback, nil
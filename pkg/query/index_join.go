@@ -0,0 +1,33 @@
+package query
+
+import (
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+// A right table with at least this many times as many pages as the left table
+// is probed through its index instead of being hashed. A hash join writes out
+// and reads back both tables, while an index join reads the left table once and
+// the right table only where probes land; but each probe walks the index from
+// its root and may touch a different page than the last, so the right table
+// must be much bigger than the left before skipping most of it pays off.
+var INDEX_JOIN_SIZE_RATIO int64 = 8
+
+// Join leftTable on rightTable's key using an index nested loop join: each
+// entry of leftTable looks up its key or value in rightTable's index. Each
+// output tuple holds the left entry's key and value followed by the right
+// entry's.
+func IndexNestedLoopJoin(leftTable db.Index, rightTable db.Index, joinOnLeftKey bool) Operator {
+	probe := Column("left.value", 1)
+	if joinOnLeftKey {
+		probe = Column("left.key", 0)
+	}
+	return NewIndexJoin(NewScan("left", leftTable), "right", rightTable, probe)
+}
+
+// Check if probing rightTable's index for every left entry is cheaper than
+// hashing both tables. Only joins on the right table's key can use its index.
+func useIndexJoin(leftTable db.Index, rightTable db.Index, joinOnRightKey bool) bool {
+	leftPages := leftTable.GetPager().GetNumPages()
+	rightPages := rightTable.GetPager().GetNumPages()
+	return joinOnRightKey && leftPages*INDEX_JOIN_SIZE_RATIO <= rightPages
+}
@@ -0,0 +1,57 @@
+package query
+
+import (
+	"fmt"
+)
+
+// Join types.
+type JoinType int64
+
+const (
+	InnerJoin      JoinType = 0 // Matching pairs.
+	LeftOuterJoin  JoinType = 1 // Matching pairs, and left entries without a match.
+	RightOuterJoin JoinType = 2 // Matching pairs, and right entries without a match.
+	FullOuterJoin  JoinType = 3 // Matching pairs, and entries on either side without a match.
+	SemiJoin       JoinType = 4 // Left entries with a match.
+	AntiJoin       JoinType = 5 // Left entries without a match.
+)
+
+// Get the name of a join type.
+func (joinType JoinType) String() string {
+	switch joinType {
+	case InnerJoin:
+		return "inner"
+	case LeftOuterJoin:
+		return "left"
+	case RightOuterJoin:
+		return "right"
+	case FullOuterJoin:
+		return "full"
+	case SemiJoin:
+		return "semi"
+	case AntiJoin:
+		return "anti"
+	default:
+		return fmt.Sprintf("JoinType(%d)", int64(joinType))
+	}
+}
+
+// Parse a join type from its name.
+func ParseJoinType(s string) (JoinType, error) {
+	for joinType := InnerJoin; joinType <= AntiJoin; joinType++ {
+		if joinType.String() == s {
+			return joinType, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid join type %q", s)
+}
+
+// Check if a join emits left entries without a match.
+func (joinType JoinType) keepsUnmatchedLeft() bool {
+	return joinType == LeftOuterJoin || joinType == FullOuterJoin || joinType == AntiJoin
+}
+
+// Check if a join emits right entries without a match.
+func (joinType JoinType) keepsUnmatchedRight() bool {
+	return joinType == RightOuterJoin || joinType == FullOuterJoin
+}
@@ -0,0 +1,171 @@
+package query
+
+import (
+	"fmt"
+
+	btree "github.com/brown-csci1270/db/pkg/btree"
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+// MergeJoin joins left and right tuples whose join keys are equal. Both inputs
+// must already be sorted by their join keys, so they are streamed side by side
+// and only the right tuples sharing the current key are held in memory.
+type MergeJoin struct {
+	left, right       Operator
+	leftKey, rightKey Scalar
+	l                 Tuple   // The current left tuple.
+	lKey              int64   // The join key of l.
+	r                 Tuple   // The first right tuple past the current run.
+	rKey              int64   // The join key of r.
+	run               []Tuple // Right tuples with the key runKey.
+	runKey            int64
+	hasRun            bool
+	next              int // Index of the next tuple in run to join with l.
+}
+
+// Construct a merge join on leftKey = rightKey.
+func NewMergeJoin(left Operator, right Operator, leftKey Scalar, rightKey Scalar) *MergeJoin {
+	return &MergeJoin{left: left, right: right, leftKey: leftKey, rightKey: rightKey}
+}
+
+func (op *MergeJoin) Open() error {
+	op.run, op.hasRun, op.next = nil, false, 0
+	if err := op.left.Open(); err != nil {
+		return err
+	}
+	if err := op.right.Open(); err != nil {
+		op.left.Close()
+		return err
+	}
+	err := op.advanceLeft()
+	if err == nil {
+		err = op.advanceRight()
+	}
+	if err != nil {
+		op.Close()
+	}
+	return err
+}
+
+// Read the next left tuple and its key.
+func (op *MergeJoin) advanceLeft() (err error) {
+	if op.l, err = op.left.Next(); err != nil || op.l == nil {
+		return err
+	}
+	op.lKey, err = op.leftKey.Eval(op.l)
+	return err
+}
+
+// Read the next right tuple and its key.
+func (op *MergeJoin) advanceRight() (err error) {
+	if op.r, err = op.right.Next(); err != nil || op.r == nil {
+		return err
+	}
+	op.rKey, err = op.rightKey.Eval(op.r)
+	return err
+}
+
+func (op *MergeJoin) Next() (Tuple, error) {
+	for op.l != nil {
+		// Join the current left tuple with each right tuple in its run.
+		if op.hasRun && op.lKey == op.runKey {
+			if op.next < len(op.run) {
+				r := op.run[op.next]
+				op.next++
+				return append(append(Tuple{}, op.l...), r...), nil
+			}
+			// The next left tuple may share this key.
+			op.next = 0
+			if err := op.advanceLeft(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Skip right tuples with smaller keys.
+		for op.r != nil && op.rKey < op.lKey {
+			if err := op.advanceRight(); err != nil {
+				return nil, err
+			}
+		}
+		if op.r == nil {
+			break
+		}
+		if op.rKey > op.lKey {
+			if err := op.advanceLeft(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Collect the run of right tuples with this key.
+		op.run, op.runKey, op.hasRun, op.next = op.run[:0], op.rKey, true, 0
+		for op.r != nil && op.rKey == op.runKey {
+			op.run = append(op.run, op.r)
+			if err := op.advanceRight(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (op *MergeJoin) Close() error {
+	op.l, op.r, op.run, op.hasRun = nil, nil, nil, false
+	err := op.left.Close()
+	if rightErr := op.right.Close(); err == nil {
+		err = rightErr
+	}
+	return err
+}
+
+func (op *MergeJoin) String() string {
+	return fmt.Sprintf("MergeJoin %v = %v", op.leftKey, op.rightKey)
+}
+
+func (op *MergeJoin) Children() []Operator {
+	return []Operator{op.left, op.right}
+}
+
+// Whether a table's entries are read in key order.
+func isOrdered(table db.Index) bool {
+	_, ok := table.(*btree.BTreeIndex)
+	return ok
+}
+
+// Read a table sorted by its key or value. Btrees are streamed in key order
+// straight from their cursors; anything else is sorted first, using up to
+// memory bytes before spilling to disk.
+func sortedInput(name string, table db.Index, byKey bool, memory int64) Operator {
+	scan := NewScan(name, table)
+	if byKey && isOrdered(table) {
+		return scan
+	}
+	column := Column(name+".value", 1)
+	if byKey {
+		column = Column(name+".key", 0)
+	}
+	return NewExternalSort(scan, []SortTerm{{Expr: column}}, memory)
+}
+
+// Join leftTable on rightTable using a sort-merge join. Each output tuple holds
+// the left entry's key and value followed by the right entry's. Inputs that
+// need sorting use up to memory bytes each before spilling to disk.
+func SortMergeJoin(
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	memory int64,
+) Operator {
+	leftName, rightName := "left", "right"
+	leftKey, rightKey := Column(leftName+".value", 1), Column(rightName+".value", 1)
+	if joinOnLeftKey {
+		leftKey = Column(leftName+".key", 0)
+	}
+	if joinOnRightKey {
+		rightKey = Column(rightName+".key", 0)
+	}
+	return NewMergeJoin(
+		sortedInput(leftName, leftTable, joinOnLeftKey, memory),
+		sortedInput(rightName, rightTable, joinOnRightKey, memory),
+		leftKey, rightKey)
+}
@@ -0,0 +1,657 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	btree "github.com/brown-csci1270/db/pkg/btree"
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// A Tuple holds the key and value of an entry from each table in a query, in
+// the order the tables appear, or the columns computed from them.
+type Tuple []int64
+
+// An Operator produces tuples one at a time, pulling them from its inputs as
+// needed. Operators must be opened before use and closed after; they can be
+// opened again to start over.
+type Operator interface {
+	Open() error
+	Next() (Tuple, error) // Get the next tuple, or nil once there are no more.
+	Close() error
+	String() string       // Describe this operator.
+	Children() []Operator // Inputs of this operator.
+}
+
+// Open an operator, call fn on each tuple it produces, then close it.
+// Stops at the first error.
+func Drain(op Operator, fn func(Tuple) error) (err error) {
+	if err = op.Open(); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := op.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	for {
+		t, err := op.Next()
+		if err != nil || t == nil {
+			return err
+		}
+		if err = fn(t); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the entries a cursor reaches, skipping past the ends of btree leaves.
+type cursorReader struct {
+	cursor  utils.Cursor
+	started bool
+	done    bool
+}
+
+// Get the next entry, or nil once the cursor can't move further.
+func (r *cursorReader) next() (utils.Entry, error) {
+	for !r.done {
+		if r.started {
+			if err := r.cursor.StepForward(); err != nil {
+				r.done = true
+				break
+			}
+		}
+		r.started = true
+		if r.cursor.IsEnd() {
+			continue
+		}
+		return r.cursor.GetEntry()
+	}
+	return nil, nil
+}
+
+// Scan reads every entry of a table through a cursor.
+type Scan struct {
+	name   string
+	table  db.Index
+	reader *cursorReader
+}
+
+// Construct a scan of a table.
+func NewScan(name string, table db.Index) *Scan {
+	return &Scan{name: name, table: table}
+}
+
+func (op *Scan) Open() error {
+	cursor, err := op.table.TableStart()
+	if err != nil {
+		return err
+	}
+	op.reader = &cursorReader{cursor: cursor}
+	return nil
+}
+
+func (op *Scan) Next() (Tuple, error) {
+	entry, err := op.reader.next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return Tuple{entry.GetKey(), entry.GetValue()}, nil
+}
+
+func (op *Scan) Close() error {
+	op.reader = nil
+	return nil
+}
+
+func (op *Scan) String() string {
+	return fmt.Sprintf("Scan %s", op.name)
+}
+
+func (op *Scan) Children() []Operator {
+	return nil
+}
+
+// IndexScan reads the entries of a table with keys in [lo, hi] using its index.
+// Btrees read the range in key order through a cursor; other indexes can only
+// look up a single key.
+type IndexScan struct {
+	name   string
+	table  db.Index
+	lo, hi int64
+	reader *cursorReader
+	found  utils.Entry // The entry of a single key lookup, until it is returned.
+}
+
+// Construct a scan of the keys in [lo, hi].
+func NewIndexScan(name string, table db.Index, lo int64, hi int64) *IndexScan {
+	return &IndexScan{name: name, table: table, lo: lo, hi: hi}
+}
+
+func (op *IndexScan) Open() error {
+	op.reader, op.found = nil, nil
+	if op.lo > op.hi {
+		return nil
+	}
+	if tree, ok := op.table.(*btree.BTreeIndex); ok {
+		cursor, err := tree.TableFind(op.lo)
+		if err != nil {
+			return err
+		}
+		op.reader = &cursorReader{cursor: cursor}
+		return nil
+	}
+	if op.lo != op.hi {
+		return fmt.Errorf("%s can't be scanned by key range; it isn't a btree", op.name)
+	}
+	entry, err := op.table.Find(op.lo)
+	if err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
+		return err
+	}
+	op.found = entry
+	return nil
+}
+
+func (op *IndexScan) Next() (Tuple, error) {
+	if op.reader == nil {
+		entry := op.found
+		op.found = nil
+		if entry == nil {
+			return nil, nil
+		}
+		return Tuple{entry.GetKey(), entry.GetValue()}, nil
+	}
+	entry, err := op.reader.next()
+	if err != nil || entry == nil || entry.GetKey() > op.hi {
+		return nil, err
+	}
+	return Tuple{entry.GetKey(), entry.GetValue()}, nil
+}
+
+func (op *IndexScan) Close() error {
+	op.reader, op.found = nil, nil
+	return nil
+}
+
+func (op *IndexScan) String() string {
+	if op.lo == op.hi {
+		return fmt.Sprintf("IndexScan %s key = %d", op.name, op.lo)
+	}
+	return fmt.Sprintf("IndexScan %s %d <= key <= %d", op.name, op.lo, op.hi)
+}
+
+func (op *IndexScan) Children() []Operator {
+	return nil
+}
+
+// SecondaryIndexScan reads the entries of a table with a given value using the
+// table's secondary index.
+type SecondaryIndexScan struct {
+	d       *db.Database
+	name    string
+	value   int64
+	entries []utils.Entry
+}
+
+// Construct a scan for the entries with the given value.
+func NewSecondaryIndexScan(d *db.Database, name string, value int64) *SecondaryIndexScan {
+	return &SecondaryIndexScan{d: d, name: name, value: value}
+}
+
+func (op *SecondaryIndexScan) Open() (err error) {
+	op.entries, err = op.d.FindByValue(op.name, op.value)
+	return err
+}
+
+func (op *SecondaryIndexScan) Next() (Tuple, error) {
+	if len(op.entries) == 0 {
+		return nil, nil
+	}
+	entry := op.entries[0]
+	op.entries = op.entries[1:]
+	return Tuple{entry.GetKey(), entry.GetValue()}, nil
+}
+
+func (op *SecondaryIndexScan) Close() error {
+	op.entries = nil
+	return nil
+}
+
+func (op *SecondaryIndexScan) String() string {
+	return fmt.Sprintf("SecondaryIndexScan %s value = %d", op.name, op.value)
+}
+
+func (op *SecondaryIndexScan) Children() []Operator {
+	return nil
+}
+
+// Filter passes on the tuples for which a condition holds.
+type Filter struct {
+	child Operator
+	cond  Scalar
+}
+
+// Construct a filter.
+func NewFilter(child Operator, cond Scalar) *Filter {
+	return &Filter{child: child, cond: cond}
+}
+
+func (op *Filter) Open() error {
+	return op.child.Open()
+}
+
+func (op *Filter) Next() (Tuple, error) {
+	for {
+		t, err := op.child.Next()
+		if err != nil || t == nil {
+			return nil, err
+		}
+		ok, err := op.cond.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		if ok != 0 {
+			return t, nil
+		}
+	}
+}
+
+func (op *Filter) Close() error {
+	return op.child.Close()
+}
+
+func (op *Filter) String() string {
+	return fmt.Sprintf("Filter %v", op.cond)
+}
+
+func (op *Filter) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// Project computes the output columns of each tuple.
+type Project struct {
+	child   Operator
+	columns []Scalar
+}
+
+// Construct a projection.
+func NewProject(child Operator, columns []Scalar) *Project {
+	return &Project{child: child, columns: columns}
+}
+
+func (op *Project) Open() error {
+	return op.child.Open()
+}
+
+func (op *Project) Next() (Tuple, error) {
+	t, err := op.child.Next()
+	if err != nil || t == nil {
+		return nil, err
+	}
+	out := make(Tuple, len(op.columns))
+	for i, column := range op.columns {
+		if out[i], err = column.Eval(t); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (op *Project) Close() error {
+	return op.child.Close()
+}
+
+func (op *Project) String() string {
+	columns := make([]string, len(op.columns))
+	for i, column := range op.columns {
+		columns[i] = column.String()
+	}
+	return "Project " + strings.Join(columns, ", ")
+}
+
+func (op *Project) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// Limit passes on at most n tuples.
+type Limit struct {
+	child Operator
+	n     int64
+	count int64
+}
+
+// Construct a limit.
+func NewLimit(child Operator, n int64) *Limit {
+	return &Limit{child: child, n: n}
+}
+
+func (op *Limit) Open() error {
+	op.count = 0
+	return op.child.Open()
+}
+
+func (op *Limit) Next() (Tuple, error) {
+	// Stop pulling from the input once enough tuples have been seen.
+	if op.count >= op.n {
+		return nil, nil
+	}
+	t, err := op.child.Next()
+	if err != nil || t == nil {
+		return nil, err
+	}
+	op.count++
+	return t, nil
+}
+
+func (op *Limit) Close() error {
+	return op.child.Close()
+}
+
+func (op *Limit) String() string {
+	return fmt.Sprintf("Limit %d", op.n)
+}
+
+func (op *Limit) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// A sort key.
+type SortTerm struct {
+	Expr Scalar
+	Desc bool
+}
+
+// Sort reads all of its input into memory and returns it in order. Ties keep
+// the order of the input.
+type Sort struct {
+	child  Operator
+	terms  []SortTerm
+	tuples []Tuple
+}
+
+// Construct a sort.
+func NewSort(child Operator, terms []SortTerm) *Sort {
+	return &Sort{child: child, terms: terms}
+}
+
+func (op *Sort) Open() (err error) {
+	// Compute the sort keys once per tuple.
+	var tuples, keys []Tuple
+	err = Drain(op.child, func(t Tuple) error {
+		key, err := sortKey(t, op.terms)
+		if err != nil {
+			return err
+		}
+		tuples = append(tuples, t)
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	op.tuples = sortTuples(tuples, keys, op.terms)
+	return nil
+}
+
+// Compute the sort key of a tuple.
+func sortKey(t Tuple, terms []SortTerm) (Tuple, error) {
+	key := make(Tuple, len(terms))
+	for i, term := range terms {
+		v, err := term.Expr.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = v
+	}
+	return key, nil
+}
+
+// Stably sort tuples by their keys.
+func sortTuples(tuples []Tuple, keys []Tuple, terms []SortTerm) []Tuple {
+	order := make([]int, len(tuples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return compareKeys(keys[order[i]], keys[order[j]], terms) < 0
+	})
+	sorted := make([]Tuple, len(tuples))
+	for i, j := range order {
+		sorted[i] = tuples[j]
+	}
+	return sorted
+}
+
+// Compare two sort keys, returning -1, 0 or 1.
+func compareKeys(a Tuple, b Tuple, terms []SortTerm) int {
+	for k, term := range terms {
+		if a[k] == b[k] {
+			continue
+		}
+		if (a[k] < b[k]) != term.Desc {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func (op *Sort) Next() (Tuple, error) {
+	if len(op.tuples) == 0 {
+		return nil, nil
+	}
+	t := op.tuples[0]
+	op.tuples = op.tuples[1:]
+	return t, nil
+}
+
+func (op *Sort) Close() error {
+	op.tuples = nil
+	return nil
+}
+
+func (op *Sort) String() string {
+	return "Sort " + describeTerms(op.terms)
+}
+
+// Describe sort keys.
+func describeTerms(terms []SortTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term.Expr.String()
+		if term.Desc {
+			parts[i] += " desc"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (op *Sort) Children() []Operator {
+	return []Operator{op.child}
+}
+
+// NestedLoopJoin joins every pair of left and right tuples for which a
+// condition holds, reading the right input once per left tuple.
+type NestedLoopJoin struct {
+	left, right Operator
+	cond        Scalar
+	l           Tuple // The current left tuple; nil when the right input is closed.
+}
+
+// Construct a nested loop join.
+func NewNestedLoopJoin(left Operator, right Operator, cond Scalar) *NestedLoopJoin {
+	return &NestedLoopJoin{left: left, right: right, cond: cond}
+}
+
+func (op *NestedLoopJoin) Open() error {
+	op.l = nil
+	return op.left.Open()
+}
+
+func (op *NestedLoopJoin) Next() (Tuple, error) {
+	for {
+		// Move on to the next left tuple, and start over on the right.
+		if op.l == nil {
+			l, err := op.left.Next()
+			if err != nil || l == nil {
+				return nil, err
+			}
+			if err = op.right.Open(); err != nil {
+				return nil, err
+			}
+			op.l = l
+		}
+		r, err := op.right.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			op.l = nil
+			if err = op.right.Close(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		t := append(append(Tuple{}, op.l...), r...)
+		ok, err := op.cond.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		if ok != 0 {
+			return t, nil
+		}
+	}
+}
+
+func (op *NestedLoopJoin) Close() error {
+	if op.l != nil {
+		op.l = nil
+		op.right.Close()
+	}
+	return op.left.Close()
+}
+
+func (op *NestedLoopJoin) String() string {
+	return fmt.Sprintf("NestedLoopJoin %v", op.cond)
+}
+
+func (op *NestedLoopJoin) Children() []Operator {
+	return []Operator{op.left, op.right}
+}
+
+// HashJoin joins left and right tuples whose join keys are equal. The right
+// input is read into an in-memory hash table, then the left input is streamed
+// past it.
+type HashJoin struct {
+	left, right       Operator
+	leftKey, rightKey Scalar
+	table             map[int64][]Tuple
+	l                 Tuple   // The current left tuple.
+	matches           []Tuple // Right tuples matching l that haven't been returned.
+}
+
+// Construct a hash join on leftKey = rightKey.
+func NewHashJoin(left Operator, right Operator, leftKey Scalar, rightKey Scalar) *HashJoin {
+	return &HashJoin{left: left, right: right, leftKey: leftKey, rightKey: rightKey}
+}
+
+func (op *HashJoin) Open() error {
+	op.table = make(map[int64][]Tuple)
+	op.l, op.matches = nil, nil
+	err := Drain(op.right, func(r Tuple) error {
+		key, err := op.rightKey.Eval(r)
+		if err != nil {
+			return err
+		}
+		op.table[key] = append(op.table[key], r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return op.left.Open()
+}
+
+func (op *HashJoin) Next() (Tuple, error) {
+	for len(op.matches) == 0 {
+		l, err := op.left.Next()
+		if err != nil || l == nil {
+			return nil, err
+		}
+		key, err := op.leftKey.Eval(l)
+		if err != nil {
+			return nil, err
+		}
+		op.l, op.matches = l, op.table[key]
+	}
+	r := op.matches[0]
+	op.matches = op.matches[1:]
+	return append(append(Tuple{}, op.l...), r...), nil
+}
+
+func (op *HashJoin) Close() error {
+	op.table, op.l, op.matches = nil, nil, nil
+	return op.left.Close()
+}
+
+func (op *HashJoin) String() string {
+	return fmt.Sprintf("HashJoin %v = %v", op.leftKey, op.rightKey)
+}
+
+func (op *HashJoin) Children() []Operator {
+	return []Operator{op.left, op.right}
+}
+
+// IndexJoin joins each left tuple with the entry of a table whose key matches,
+// looking it up in the table's index.
+type IndexJoin struct {
+	left  Operator
+	name  string
+	table db.Index
+	probe Scalar // Computes the key to look up from a left tuple.
+}
+
+// Construct an index join on table.key = probe.
+func NewIndexJoin(left Operator, name string, table db.Index, probe Scalar) *IndexJoin {
+	return &IndexJoin{left: left, name: name, table: table, probe: probe}
+}
+
+func (op *IndexJoin) Open() error {
+	return op.left.Open()
+}
+
+func (op *IndexJoin) Next() (Tuple, error) {
+	for {
+		l, err := op.left.Next()
+		if err != nil || l == nil {
+			return nil, err
+		}
+		key, err := op.probe.Eval(l)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := op.table.Find(key)
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append(append(Tuple{}, l...), entry.GetKey(), entry.GetValue()), nil
+	}
+}
+
+func (op *IndexJoin) Close() error {
+	return op.left.Close()
+}
+
+func (op *IndexJoin) String() string {
+	return fmt.Sprintf("IndexJoin %s key = %v", op.name, op.probe)
+}
+
+func (op *IndexJoin) Children() []Operator {
+	return []Operator{op.left}
+}
@@ -8,6 +8,7 @@ import (
 
 	db "github.com/brown-csci1270/db/pkg/db"
 	repl "github.com/brown-csci1270/db/pkg/repl"
+	utils "github.com/brown-csci1270/db/pkg/utils"
 )
 
 // Query REPL.
@@ -15,33 +16,148 @@ func QueryRepl(d *db.Database) *repl.REPL {
 	r := repl.NewRepl()
 	r.AddCommand("join", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleJoin(d, payload, replConfig.GetWriter())
-	}, "Create a table. usage: create table <table>")
+	}, "Join two tables. usage: join [inner|left|right|full|semi|anti] <table1> <key/val for table1> on <table2> <key/val for table2> [stats]")
+	r.AddCommand("sql", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleSQL(d, payload, replConfig.GetWriter())
+	}, "Run a SQL statement on key/value tables. usage: sql [explain] <select|insert|update|delete> ...")
+	r.AddCommand("aggregate", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleAggregate(d, payload, replConfig.GetWriter())
+	}, "Aggregate a table. usage: aggregate <count|sum|min|max|avg>(<key|value|*>)[, ...] from <table> [group by <key|value>]")
 	return r
 }
 
+// Handle sql.
+func HandleSQL(d *db.Database, payload string, w io.Writer) (err error) {
+	// Usage: sql <statement>
+	statement := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(payload), "sql"))
+	if statement == "" {
+		return fmt.Errorf("usage: sql [explain] <select|insert|update|delete> ...")
+	}
+	if err = ExecuteSQL(d, statement, w); err != nil {
+		return fmt.Errorf("sql error: %w", err)
+	}
+	return nil
+}
+
+// Handle aggregate.
+func HandleAggregate(d *db.Database, payload string, w io.Writer) (err error) {
+	// Usage: aggregate <count|sum|min|max|avg>(<key|value|*>)[, ...] from <table> [group by <key|value>]
+	usage := fmt.Errorf("usage: aggregate <count|sum|min|max|avg>(<key|value|*>)[, ...] from <table> [group by <key|value>]")
+	parts := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(payload), "aggregate")), " from ", 2)
+	if len(parts) != 2 {
+		return usage
+	}
+	var aggs []Aggregate
+	for _, term := range strings.Split(parts[0], ",") {
+		term = strings.TrimSpace(term)
+		open := strings.Index(term, "(")
+		if open < 0 || !strings.HasSuffix(term, ")") {
+			return usage
+		}
+		f, err := ParseAggregateFunc(term[:open])
+		if err != nil {
+			return fmt.Errorf("aggregate error: %w", err)
+		}
+		agg := Aggregate{Func: f}
+		switch arg := strings.TrimSpace(term[open+1 : len(term)-1]); {
+		case arg == "key":
+			agg.Arg = Column("key", 0)
+		case arg == "value":
+			agg.Arg = Column("value", 1)
+		case arg != "*" || f != Count:
+			return usage
+		}
+		aggs = append(aggs, agg)
+	}
+	fields := strings.Fields(parts[1])
+	groupBy := ""
+	if len(fields) == 4 && fields[1] == "group" && fields[2] == "by" {
+		groupBy = fields[3]
+	} else if len(fields) != 1 {
+		return usage
+	}
+	table, err := d.GetTable(fields[0])
+	if err != nil {
+		return fmt.Errorf("find error: %w", err)
+	}
+	op, err := AggregateTable(fields[0], table, groupBy, aggs)
+	if err != nil {
+		return fmt.Errorf("aggregate error: %w", err)
+	}
+	err = Drain(op, func(t Tuple) error {
+		_, err := io.WriteString(w, formatTuple(t))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("aggregate error: %w", err)
+	}
+	return nil
+}
+
 // Handle join.
 func HandleJoin(d *db.Database, payload string, w io.Writer) (err error) {
 	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: join <table1> <key/val for table1> on <table2> <key/val for table2>
-	if numFields != 6 || fields[3] != "on" || (fields[2] != "key" && fields[2] != "val") || (fields[5] != "key" && fields[5] != "val") {
-		return fmt.Errorf("usage: join <table1> <key/val for table1> on <table2> <key/val for table2>")
+	// Usage: join [inner|left|right|full|semi|anti] <table1> <key/val for table1> on <table2> <key/val for table2> [stats]
+	showStats := len(fields) > 0 && fields[len(fields)-1] == "stats"
+	if showStats {
+		fields = fields[:len(fields)-1]
+	}
+	joinType := InnerJoin
+	if len(fields) == 7 {
+		if joinType, err = ParseJoinType(fields[1]); err != nil {
+			return fmt.Errorf("join error: %w", err)
+		}
+		fields = append(fields[:1], fields[2:]...)
+	}
+	if len(fields) != 6 || fields[3] != "on" || (fields[2] != "key" && fields[2] != "val") || (fields[5] != "key" && fields[5] != "val") {
+		return fmt.Errorf("usage: join [inner|left|right|full|semi|anti] <table1> <key/val for table1> on <table2> <key/val for table2> [stats]")
 	}
 	table1Name := fields[1]
 	table1, err := d.GetTable(table1Name)
 	if err != nil {
-		return fmt.Errorf("find error: %v", err)
+		return fmt.Errorf("find error: %w", err)
 	}
 	table2Name := fields[4]
 	table2, err := d.GetTable(table2Name)
 	if err != nil {
-		return fmt.Errorf("find error: %v", err)
+		return fmt.Errorf("find error: %w", err)
 	}
 	joinOnLeftKey := fields[2] == "key"
 	joinOnRightKey := fields[5] == "key"
+	// Avoid building temporary hash tables where the inputs allow it: a small
+	// left table can probe the right table's index, and tables already sorted
+	// by their join keys can be merged directly.
+	var join Operator
+	switch {
+	case joinType != InnerJoin:
+	case useIndexJoin(table1, table2, joinOnRightKey):
+		join = IndexNestedLoopJoin(table1, table2, joinOnLeftKey)
+	case joinOnLeftKey && joinOnRightKey && isOrdered(table1) && isOrdered(table2):
+		join = SortMergeJoin(table1, table2, true, true, d.GetOptions().SortMemory)
+	}
+	if join != nil {
+		err = Drain(join, func(t Tuple) error {
+			_, err := io.WriteString(w, fmt.Sprintf("{(%v, %v), (%v, %v)}\n", t[0], t[1], t[2], t[3]))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("join error: %w", err)
+		}
+		if showStats {
+			io.WriteString(w, fmt.Sprintf("bloom filters: not used by %v\n", join))
+		}
+		return nil
+	}
+	stats := &JoinStats{}
+	opts := JoinOptions{
+		FalsePositiveRate: d.GetOptions().BloomFPRate,
+		Memory:            d.GetOptions().JoinMemory,
+		Workers:           d.GetOptions().JoinWorkers,
+		Stats:             stats,
+	}
 	ctx, cancelCtx := context.WithCancel(context.Background())
 	defer cancelCtx()
-	resultsChan, _, group, cleanupCallback, err := Join(ctx, table1, table2, joinOnLeftKey, joinOnRightKey)
+	resultsChan, _, group, cleanupCallback, err := Join(ctx, table1, table2, joinOnLeftKey, joinOnRightKey, joinType, opts)
 	if cleanupCallback != nil {
 		defer cleanupCallback()
 	}
@@ -55,8 +171,11 @@ func HandleJoin(d *db.Database, payload string, w io.Writer) (err error) {
 			if !valid {
 				break
 			}
-			io.WriteString(w, fmt.Sprintf("{(%v, %v), (%v, %v)}\n",
-				pair.l.GetKey(), pair.l.GetValue(), pair.r.GetKey(), pair.r.GetValue()))
+			if joinType == SemiJoin || joinType == AntiJoin {
+				io.WriteString(w, fmt.Sprintf("{%s}\n", formatEntry(pair.l)))
+			} else {
+				io.WriteString(w, fmt.Sprintf("{%s, %s}\n", formatEntry(pair.l), formatEntry(pair.r)))
+			}
 		}
 		done <- true
 	}()
@@ -64,7 +183,20 @@ func HandleJoin(d *db.Database, payload string, w io.Writer) (err error) {
 	close(resultsChan)
 	<-done
 	if err != nil {
-		return fmt.Errorf("join error: %v", err)
+		return fmt.Errorf("join error: %w", err)
+	}
+	if showStats {
+		io.WriteString(w, fmt.Sprintf("bloom filters: %d probes, %d rejected, %d false positives (rate %.4f, target %.4f)\n",
+			stats.Probes, stats.Rejected, stats.FalsePositives, stats.FalsePositiveRate(), opts.FalsePositiveRate))
+		io.WriteString(w, fmt.Sprintf("partitions split again: %d\n", stats.Repartitions))
 	}
 	return nil
 }
+
+// Format one side of a join result; outer joins leave a missing side nil.
+func formatEntry(entry utils.Entry) string {
+	if entry == nil {
+		return "NULL"
+	}
+	return fmt.Sprintf("(%v, %v)", entry.GetKey(), entry.GetValue())
+}
@@ -0,0 +1,179 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Scalar computes an int64 from a tuple. Conditions are true when nonzero.
+type Scalar interface {
+	Eval(t Tuple) (int64, error)
+	String() string
+}
+
+// Get the column at the given position of a tuple, printed as name.
+func Column(name string, offset int) Scalar {
+	return &colExpr{name: name, offset: offset}
+}
+
+// Get a constant.
+func Constant(v int64) Scalar {
+	return &constExpr{v: v}
+}
+
+// Apply a binary operator: or, and, =, !=, <, <=, >, >=, +, -, *, / or %.
+func Binary(op string, left Scalar, right Scalar) Scalar {
+	return &binaryExpr{op: op, left: left, right: right}
+}
+
+// A constant.
+type constExpr struct {
+	v int64
+}
+
+func (e *constExpr) Eval(t Tuple) (int64, error) {
+	return e.v, nil
+}
+
+func (e *constExpr) String() string {
+	return fmt.Sprint(e.v)
+}
+
+// A column of a tuple.
+type colExpr struct {
+	name   string // The column as written in the query.
+	offset int    // Position of the column in a tuple.
+}
+
+func (e *colExpr) Eval(t Tuple) (int64, error) {
+	return t[e.offset], nil
+}
+
+func (e *colExpr) String() string {
+	return e.name
+}
+
+// Negation, either logical or arithmetic.
+type unaryExpr struct {
+	op      string
+	operand Scalar
+}
+
+func (e *unaryExpr) Eval(t Tuple) (int64, error) {
+	v, err := e.operand.Eval(t)
+	if err != nil {
+		return 0, err
+	}
+	if e.op == "not" {
+		return boolToInt(v == 0), nil
+	}
+	return -v, nil
+}
+
+func (e *unaryExpr) String() string {
+	if e.op == "not" {
+		return fmt.Sprintf("(not %v)", e.operand)
+	}
+	return fmt.Sprintf("(-%v)", e.operand)
+}
+
+// A binary operation.
+type binaryExpr struct {
+	op          string
+	left, right Scalar
+}
+
+func (e *binaryExpr) Eval(t Tuple) (int64, error) {
+	l, err := e.left.Eval(t)
+	if err != nil {
+		return 0, err
+	}
+	// Short-circuit logical operators.
+	switch {
+	case e.op == "and" && l == 0:
+		return 0, nil
+	case e.op == "or" && l != 0:
+		return 1, nil
+	}
+	r, err := e.right.Eval(t)
+	if err != nil {
+		return 0, err
+	}
+	switch e.op {
+	case "and", "or":
+		return boolToInt(r != 0), nil
+	case "=":
+		return boolToInt(l == r), nil
+	case "!=":
+		return boolToInt(l != r), nil
+	case "<":
+		return boolToInt(l < r), nil
+	case "<=":
+		return boolToInt(l <= r), nil
+	case ">":
+		return boolToInt(l > r), nil
+	case ">=":
+		return boolToInt(l >= r), nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return 0, errors.New("division by zero")
+		}
+		if e.op == "/" {
+			return l / r, nil
+		}
+		return l % r, nil
+	default:
+		return 0, fmt.Errorf("unknown operator %s", e.op)
+	}
+}
+
+func (e *binaryExpr) String() string {
+	return fmt.Sprintf("(%v %s %v)", e.left, e.op, e.right)
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Record the offsets of the tables whose columns an expression uses.
+func tableOffsets(e Scalar, offsets map[int]bool) {
+	switch e := e.(type) {
+	case *colExpr:
+		offsets[e.offset-e.offset%2] = true
+	case *unaryExpr:
+		tableOffsets(e.operand, offsets)
+	case *binaryExpr:
+		tableOffsets(e.left, offsets)
+		tableOffsets(e.right, offsets)
+	}
+}
+
+// Copy an expression with its columns moved by delta positions.
+func shiftColumns(e Scalar, delta int) Scalar {
+	switch e := e.(type) {
+	case *colExpr:
+		return &colExpr{name: e.name, offset: e.offset + delta}
+	case *unaryExpr:
+		return &unaryExpr{op: e.op, operand: shiftColumns(e.operand, delta)}
+	case *binaryExpr:
+		return &binaryExpr{op: e.op, left: shiftColumns(e.left, delta), right: shiftColumns(e.right, delta)}
+	default:
+		return e
+	}
+}
+
+// Check if an expression doesn't depend on any tuple.
+func isConstant(e Scalar) bool {
+	offsets := make(map[int]bool)
+	tableOffsets(e, offsets)
+	return len(offsets) == 0
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Kinds of SQL tokens.
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota // End of input.
+	tokIdent                   // Keywords, table names and column names.
+	tokInt                     // Unsigned integer literals.
+	tokSymbol                  // Punctuation and operators.
+)
+
+// A token of SQL input.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // Byte offset of the token in the input.
+}
+
+// Symbols, longest first so that "<=" isn't read as "<" then "=".
+var sqlSymbols = []string{"<=", ">=", "!=", "<>", "(", ")", ",", ".", "*", "=", "<", ">", "+", "-", "/", "%", ";"}
+
+// Split a SQL statement into tokens. Identifiers are lowercased.
+func lex(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	for pos := 0; pos < len(input); {
+		c := rune(input[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case unicode.IsLetter(c) || c == '_':
+			start := pos
+			for pos < len(input) && isIdentChar(rune(input[pos])) {
+				pos++
+			}
+			tokens = append(tokens, token{tokIdent, strings.ToLower(input[start:pos]), start})
+		case unicode.IsDigit(c):
+			start := pos
+			for pos < len(input) && unicode.IsDigit(rune(input[pos])) {
+				pos++
+			}
+			tokens = append(tokens, token{tokInt, input[start:pos], start})
+		default:
+			matched := false
+			for _, sym := range sqlSymbols {
+				if strings.HasPrefix(input[pos:], sym) {
+					tokens = append(tokens, token{tokSymbol, sym, pos})
+					pos += len(sym)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, pos)
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(input)}), nil
+}
+
+// Check if a character can appear in an identifier after the first.
+func isIdentChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
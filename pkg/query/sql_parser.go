@@ -0,0 +1,575 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A parsed SQL statement.
+type Statement interface {
+	statement()
+}
+
+// SELECT <columns> FROM <table> [JOIN <table> ON <expr>] [WHERE <expr>] [ORDER BY <expr> [ASC|DESC], ...] [LIMIT <n>]
+type SelectStmt struct {
+	Columns []Expr // Nil for *.
+	From    TableRef
+	Join    *JoinClause
+	Where   Expr // Nil if there is no WHERE clause.
+	OrderBy []OrderTerm
+	Limit   int64 // -1 if there is no LIMIT clause.
+}
+
+// INSERT INTO <table> [(key, value)] VALUES (<key>, <value>), ...
+type InsertStmt struct {
+	Table string
+	Rows  [][2]Expr // Each row's key and value.
+}
+
+// UPDATE <table> SET value = <expr> [WHERE <expr>]
+type UpdateStmt struct {
+	Table string
+	Value Expr
+	Where Expr
+}
+
+// DELETE FROM <table> [WHERE <expr>]
+type DeleteStmt struct {
+	Table string
+	Where Expr
+}
+
+// EXPLAIN <statement>
+type ExplainStmt struct {
+	Stmt Statement
+}
+
+func (*SelectStmt) statement()  {}
+func (*InsertStmt) statement()  {}
+func (*UpdateStmt) statement()  {}
+func (*DeleteStmt) statement()  {}
+func (*ExplainStmt) statement() {}
+
+// A table in a FROM or JOIN clause, optionally renamed.
+type TableRef struct {
+	Name  string
+	Alias string // Empty if the table isn't renamed.
+}
+
+// A JOIN clause.
+type JoinClause struct {
+	Table TableRef
+	On    Expr
+}
+
+// A term of an ORDER BY clause.
+type OrderTerm struct {
+	Expr Expr
+	Desc bool
+}
+
+// A parsed SQL expression over int64s. Comparisons and logical operators
+// yield 1 for true and 0 for false.
+type Expr interface {
+	String() string
+}
+
+// A column, optionally qualified by a table name or alias.
+type ColumnRef struct {
+	Table  string // Empty if unqualified.
+	Column string // Either key or value.
+}
+
+// An integer literal.
+type IntLiteral struct {
+	Value int64
+}
+
+// A binary operation; Op is one of or, and, =, !=, <, <=, >, >=, +, -, *, / and %.
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// A unary operation; Op is either not or -.
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+func (ref *ColumnRef) String() string {
+	if ref.Table == "" {
+		return ref.Column
+	}
+	return ref.Table + "." + ref.Column
+}
+
+func (lit *IntLiteral) String() string {
+	return strconv.FormatInt(lit.Value, 10)
+}
+
+func (e *BinaryExpr) String() string {
+	return fmt.Sprintf("(%v %s %v)", e.Left, e.Op, e.Right)
+}
+
+func (e *UnaryExpr) String() string {
+	if e.Op == "not" {
+		return fmt.Sprintf("(not %v)", e.Expr)
+	}
+	return fmt.Sprintf("(-%v)", e.Expr)
+}
+
+// Words that can't be used as table names or aliases.
+var sqlKeywords = map[string]bool{
+	"select": true, "from": true, "join": true, "on": true, "where": true, "order": true, "by": true,
+	"asc": true, "desc": true, "limit": true, "insert": true, "into": true, "values": true, "update": true,
+	"set": true, "delete": true, "explain": true, "and": true, "or": true, "not": true, "as": true,
+}
+
+// Parse a single SQL statement, optionally ending in a semicolon.
+func ParseSQL(input string) (Statement, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	return stmt, nil
+}
+
+// A recursive descent parser over a list of tokens.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Get the next token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// Consume the next token.
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// Build an error for a token that doesn't fit the grammar.
+func (p *parser) unexpected(tok token) error {
+	if tok.kind == tokEOF {
+		return errors.New("unexpected end of statement")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// Consume the next token if it is one of the given keywords.
+func (p *parser) acceptKeyword(keywords ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokIdent {
+		return "", false
+	}
+	for _, kw := range keywords {
+		if tok.text == kw {
+			p.next()
+			return kw, true
+		}
+	}
+	return "", false
+}
+
+// Consume the given keyword, or error.
+func (p *parser) expectKeyword(keyword string) error {
+	if _, ok := p.acceptKeyword(keyword); !ok {
+		return fmt.Errorf("expected %s: %w", strings.ToUpper(keyword), p.unexpected(p.peek()))
+	}
+	return nil
+}
+
+// Consume the next token if it is the given symbol.
+func (p *parser) acceptSymbol(symbol string) bool {
+	if tok := p.peek(); tok.kind == tokSymbol && tok.text == symbol {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// Consume the given symbol, or error.
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return fmt.Errorf("expected %q: %w", symbol, p.unexpected(p.peek()))
+	}
+	return nil
+}
+
+// Consume a name that isn't a keyword.
+func (p *parser) expectName() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokIdent || sqlKeywords[tok.text] {
+		return "", fmt.Errorf("expected a name: %w", p.unexpected(tok))
+	}
+	p.next()
+	return tok.text, nil
+}
+
+// Consume an integer literal.
+func (p *parser) expectInt() (int64, error) {
+	tok := p.peek()
+	if tok.kind != tokInt {
+		return 0, fmt.Errorf("expected a number: %w", p.unexpected(tok))
+	}
+	p.next()
+	return strconv.ParseInt(tok.text, 10, 64)
+}
+
+// statement := [EXPLAIN] (select | insert | update | delete)
+func (p *parser) parseStatement() (Statement, error) {
+	kw, ok := p.acceptKeyword("explain", "select", "insert", "update", "delete")
+	if !ok {
+		return nil, fmt.Errorf("expected SELECT, INSERT, UPDATE or DELETE: %w", p.unexpected(p.peek()))
+	}
+	switch kw {
+	case "explain":
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := stmt.(*ExplainStmt); ok {
+			return nil, errors.New("cannot explain an EXPLAIN statement")
+		}
+		return &ExplainStmt{Stmt: stmt}, nil
+	case "select":
+		return p.parseSelect()
+	case "insert":
+		return p.parseInsert()
+	case "update":
+		return p.parseUpdate()
+	default:
+		return p.parseDelete()
+	}
+}
+
+// select := SELECT (* | expr, ...) FROM table [JOIN table ON expr] [WHERE expr] [ORDER BY expr [ASC|DESC], ...] [LIMIT n]
+func (p *parser) parseSelect() (stmt *SelectStmt, err error) {
+	stmt = &SelectStmt{Limit: -1}
+	if !p.acceptSymbol("*") {
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, expr)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if stmt.From, err = p.parseTableRef(); err != nil {
+		return nil, err
+	}
+	if _, ok := p.acceptKeyword("join"); ok {
+		join := &JoinClause{}
+		if join.Table, err = p.parseTableRef(); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("on"); err != nil {
+			return nil, err
+		}
+		if join.On, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		stmt.Join = join
+	}
+	if stmt.Where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	if _, ok := p.acceptKeyword("order"); ok {
+		if err = p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			term := OrderTerm{}
+			if term.Expr, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			dir, _ := p.acceptKeyword("asc", "desc")
+			term.Desc = dir == "desc"
+			stmt.OrderBy = append(stmt.OrderBy, term)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if _, ok := p.acceptKeyword("limit"); ok {
+		if stmt.Limit, err = p.expectInt(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// table := name [[AS] alias]
+func (p *parser) parseTableRef() (ref TableRef, err error) {
+	if ref.Name, err = p.expectName(); err != nil {
+		return ref, err
+	}
+	_, as := p.acceptKeyword("as")
+	if tok := p.peek(); as || (tok.kind == tokIdent && !sqlKeywords[tok.text]) {
+		if ref.Alias, err = p.expectName(); err != nil {
+			return ref, err
+		}
+	}
+	return ref, nil
+}
+
+// where := [WHERE expr]
+func (p *parser) parseWhere() (Expr, error) {
+	if _, ok := p.acceptKeyword("where"); !ok {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+// insert := INSERT INTO table [(key, value)] VALUES (expr, expr), ...
+func (p *parser) parseInsert() (stmt *InsertStmt, err error) {
+	stmt = &InsertStmt{}
+	if err = p.expectKeyword("into"); err != nil {
+		return nil, err
+	}
+	if stmt.Table, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	// The column list may put the value first.
+	swapped := false
+	if p.acceptSymbol("(") {
+		var columns [2]string
+		for i := range columns {
+			if i > 0 {
+				if err = p.expectSymbol(","); err != nil {
+					return nil, err
+				}
+			}
+			if columns[i], err = p.expectName(); err != nil {
+				return nil, err
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		switch columns {
+		case [2]string{"key", "value"}:
+		case [2]string{"value", "key"}:
+			swapped = true
+		default:
+			return nil, fmt.Errorf("expected columns (key, value), got (%s, %s)", columns[0], columns[1])
+		}
+	}
+	if err = p.expectKeyword("values"); err != nil {
+		return nil, err
+	}
+	for {
+		var row [2]Expr
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		if row[0], err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+		if row[1], err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if swapped {
+			row[0], row[1] = row[1], row[0]
+		}
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return stmt, nil
+}
+
+// update := UPDATE table SET value = expr [WHERE expr]
+func (p *parser) parseUpdate() (stmt *UpdateStmt, err error) {
+	stmt = &UpdateStmt{}
+	if stmt.Table, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	column, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if column != "value" {
+		return nil, fmt.Errorf("only value can be set, not %s", column)
+	}
+	if err = p.expectSymbol("="); err != nil {
+		return nil, err
+	}
+	if stmt.Value, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if stmt.Where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// delete := DELETE FROM table [WHERE expr]
+func (p *parser) parseDelete() (stmt *DeleteStmt, err error) {
+	stmt = &DeleteStmt{}
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if stmt.Table, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if stmt.Where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// Binary operators by precedence, loosest first.
+var binaryOps = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!=", "<>", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// expr := the binary operators above, then NOT, then unary minus, then primaries.
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseBinary(0)
+}
+
+// Parse a left-associative chain of operators at the given precedence level.
+func (p *parser) parseBinary(level int) (Expr, error) {
+	if level == len(binaryOps) {
+		return p.parseUnary()
+	}
+	// NOT binds looser than comparisons but tighter than AND.
+	if level == 2 {
+		if _, ok := p.acceptKeyword("not"); ok {
+			expr, err := p.parseBinary(level)
+			if err != nil {
+				return nil, err
+			}
+			return &UnaryExpr{Op: "not", Expr: expr}, nil
+		}
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(binaryOps[level])
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if op == "<>" {
+			op = "!="
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// Consume the next token if it is one of the given operators.
+func (p *parser) acceptOp(ops []string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokSymbol && tok.kind != tokIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// unary := - unary | primary
+func (p *parser) parseUnary() (Expr, error) {
+	if !p.acceptSymbol("-") {
+		return p.parsePrimary()
+	}
+	// Fold negative literals so that the smallest int64 can be written.
+	if tok := p.peek(); tok.kind == tokInt {
+		p.next()
+		v, err := strconv.ParseInt("-"+tok.text, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &IntLiteral{Value: v}, nil
+	}
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: "-", Expr: expr}, nil
+}
+
+// primary := n | [table.]column | (expr)
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokInt:
+		v, err := p.expectInt()
+		if err != nil {
+			return nil, err
+		}
+		return &IntLiteral{Value: v}, nil
+	case tok.kind == tokIdent && !sqlKeywords[tok.text]:
+		p.next()
+		ref := &ColumnRef{Column: tok.text}
+		if p.acceptSymbol(".") {
+			column, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			ref.Table, ref.Column = tok.text, column
+		}
+		return ref, nil
+	case p.acceptSymbol("("):
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	default:
+		return nil, fmt.Errorf("expected an expression: %w", p.unexpected(tok))
+	}
+}
@@ -0,0 +1,510 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	btree "github.com/brown-csci1270/db/pkg/btree"
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+// Write a query plan as an indented tree.
+func ExplainPlan(op Operator, w io.Writer) {
+	explainPlan(op, w, 0)
+}
+
+func explainPlan(op Operator, w io.Writer, depth int) {
+	io.WriteString(w, strings.Repeat("  ", depth)+op.String()+"\n")
+	for _, child := range op.Children() {
+		explainPlan(child, w, depth+1)
+	}
+}
+
+// A table in scope of a query.
+type scopeTable struct {
+	name   string
+	alias  string // The name the query refers to the table by.
+	info   db.TableInfo
+	table  db.Index
+	offset int // Position of the table's key in a Tuple.
+}
+
+// Plans queries against a database.
+type planner struct {
+	d      *db.Database
+	tables []scopeTable
+}
+
+// Add a table to the planner's scope.
+func (pl *planner) addTable(ref TableRef) (scopeTable, error) {
+	info, ok := pl.d.GetTableInfo(ref.Name)
+	if !ok {
+		return scopeTable{}, fmt.Errorf("%s: %w", ref.Name, utils.ErrTableNotFound)
+	}
+	if info.IsRowTable() {
+		return scopeTable{}, fmt.Errorf("%s has columns; sql only supports key/value tables", ref.Name)
+	}
+	table, err := pl.d.GetTable(ref.Name)
+	if err != nil {
+		return scopeTable{}, err
+	}
+	st := scopeTable{name: ref.Name, alias: ref.Alias, info: info, table: table, offset: 2 * len(pl.tables)}
+	if st.alias == "" {
+		st.alias = ref.Name
+	}
+	for _, other := range pl.tables {
+		if other.alias == st.alias {
+			return scopeTable{}, fmt.Errorf("%s appears twice; give it an alias", st.alias)
+		}
+	}
+	pl.tables = append(pl.tables, st)
+	return st, nil
+}
+
+// Resolve the AST of an expression against the tables in scope.
+func (pl *planner) bind(e Expr) (Scalar, error) {
+	switch e := e.(type) {
+	case *IntLiteral:
+		return &constExpr{e.Value}, nil
+	case *ColumnRef:
+		if e.Column != "key" && e.Column != "value" {
+			return nil, fmt.Errorf("unknown column %v; tables have key and value", e)
+		}
+		var found []scopeTable
+		for _, st := range pl.tables {
+			if e.Table == "" || e.Table == st.alias {
+				found = append(found, st)
+			}
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("unknown table %s", e.Table)
+		}
+		if len(found) > 1 {
+			return nil, fmt.Errorf("column %v is ambiguous", e)
+		}
+		offset := found[0].offset
+		if e.Column == "value" {
+			offset++
+		}
+		return &colExpr{name: e.String(), offset: offset}, nil
+	case *UnaryExpr:
+		operand, err := pl.bind(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: e.Op, operand: operand}, nil
+	case *BinaryExpr:
+		left, err := pl.bind(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := pl.bind(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{op: e.Op, left: left, right: right}, nil
+	default:
+		return nil, fmt.Errorf("unsupported expression %v", e)
+	}
+}
+
+// Split a condition into the terms ANDed together.
+func conjuncts(e Scalar) []Scalar {
+	if e == nil {
+		return nil
+	}
+	if b, ok := e.(*binaryExpr); ok && b.op == "and" {
+		return append(conjuncts(b.left), conjuncts(b.right)...)
+	}
+	return []Scalar{e}
+}
+
+// AND a list of conditions together; nil if the list is empty.
+func conjoin(conds []Scalar) Scalar {
+	var result Scalar
+	for _, cond := range conds {
+		if result == nil {
+			result = cond
+		} else {
+			result = &binaryExpr{op: "and", left: result, right: cond}
+		}
+	}
+	return result
+}
+
+// Wrap an operator in a filter, unless there is no condition.
+func filter(op Operator, cond Scalar) Operator {
+	if cond == nil {
+		return op
+	}
+	return NewFilter(op, cond)
+}
+
+// Match a condition of the form <column> <op> <constant>, with the column on either side.
+func matchColumnCond(cond Scalar) (col *colExpr, op string, v int64, ok bool) {
+	b, isBinary := cond.(*binaryExpr)
+	if !isBinary {
+		return nil, "", 0, false
+	}
+	flipped := map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	if _, isCompare := flipped[b.op]; !isCompare {
+		return nil, "", 0, false
+	}
+	left, right, op := b.left, b.right, b.op
+	if _, isCol := right.(*colExpr); isCol {
+		left, right, op = right, left, flipped[op]
+	}
+	col, isCol := left.(*colExpr)
+	if !isCol || !isConstant(right) {
+		return nil, "", 0, false
+	}
+	v, err := right.Eval(nil)
+	if err != nil {
+		return nil, "", 0, false
+	}
+	return col, op, v, true
+}
+
+// Choose how to read a table given the conditions that only involve it, and
+// apply the conditions that the access path doesn't.
+func (pl *planner) accessPath(st scopeTable, conds []Scalar) (Operator, bool) {
+	var residual []Scalar
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	hasRange, hasValue := false, false
+	var value int64
+	for i, cond := range conds {
+		col, op, v, ok := matchColumnCond(cond)
+		if !ok {
+			residual = append(residual, cond)
+			continue
+		}
+		switch {
+		case col.offset == st.offset && op == "=":
+			// A key lookup reads at most one entry, so it always wins.
+			rest := append(append([]Scalar{}, conds[:i]...), conds[i+1:]...)
+			return filter(NewIndexScan(st.name, st.table, v, v), conjoin(rest)), true
+		case col.offset == st.offset && op != "!=":
+			// Range conditions stay in the filter, so bounds can be inclusive.
+			hasRange = true
+			if (op == ">" || op == ">=") && v > lo {
+				lo = v
+			} else if (op == "<" || op == "<=") && v < hi {
+				hi = v
+			}
+			residual = append(residual, cond)
+		case col.offset == st.offset+1 && op == "=" && !hasValue:
+			hasValue, value = true, v
+			residual = append(residual, cond)
+		default:
+			residual = append(residual, cond)
+		}
+	}
+	_, isBTree := st.table.(*btree.BTreeIndex)
+	if hasRange && isBTree {
+		return filter(NewIndexScan(st.name, st.table, lo, hi), conjoin(residual)), true
+	}
+	if hasValue && hasSecondaryIndex(st.info) {
+		// Drop the condition the lookup satisfies.
+		for i, cond := range residual {
+			if col, op, v, ok := matchColumnCond(cond); ok && col.offset == st.offset+1 && op == "=" && v == value {
+				residual = append(residual[:i:i], residual[i+1:]...)
+				break
+			}
+		}
+		return filter(NewSecondaryIndexScan(pl.d, st.name, value), conjoin(residual)), false
+	}
+	return filter(NewScan(st.name, st.table), conjoin(residual)), isBTree
+}
+
+// Check if a table has a secondary index on its values.
+func hasSecondaryIndex(info db.TableInfo) bool {
+	for _, column := range info.Indexes {
+		if column == "value" {
+			return true
+		}
+	}
+	return false
+}
+
+// Split conditions by the tables they involve: those that only involve one
+// table, keyed by that table's offset, and the rest, including constants.
+func splitConds(conds []Scalar) (map[int][]Scalar, []Scalar) {
+	single := make(map[int][]Scalar)
+	var multi []Scalar
+	for _, cond := range conds {
+		offsets := make(map[int]bool)
+		tableOffsets(cond, offsets)
+		if len(offsets) == 1 {
+			for offset := range offsets {
+				single[offset] = append(single[offset], cond)
+			}
+		} else {
+			multi = append(multi, cond)
+		}
+	}
+	return single, multi
+}
+
+// Plan a select statement.
+func (pl *planner) planSelect(stmt *SelectStmt) (Operator, error) {
+	from, err := pl.addTable(stmt.From)
+	if err != nil {
+		return nil, err
+	}
+	var right scopeTable
+	if stmt.Join != nil {
+		if right, err = pl.addTable(stmt.Join.Table); err != nil {
+			return nil, err
+		}
+	}
+	var where Scalar
+	if stmt.Where != nil {
+		if where, err = pl.bind(stmt.Where); err != nil {
+			return nil, err
+		}
+	}
+	// Push conditions on a single table down to where that table is read.
+	single, multi := splitConds(conjuncts(where))
+	plan, ordered := pl.accessPath(from, single[from.offset])
+	if stmt.Join != nil {
+		on, err := pl.bind(stmt.Join.On)
+		if err != nil {
+			return nil, err
+		}
+		plan = pl.planJoin(plan, ordered, right, on, single[right.offset])
+		ordered = false
+	}
+	plan = filter(plan, conjoin(multi))
+	if len(stmt.OrderBy) > 0 {
+		terms := make([]SortTerm, len(stmt.OrderBy))
+		for i, term := range stmt.OrderBy {
+			e, err := pl.bind(term.Expr)
+			if err != nil {
+				return nil, err
+			}
+			terms[i] = SortTerm{Expr: e, Desc: term.Desc}
+		}
+		// Btrees are already read in key order.
+		col, isCol := terms[0].Expr.(*colExpr)
+		if !(ordered && len(terms) == 1 && !terms[0].Desc && isCol && col.offset == from.offset) {
+			plan = NewExternalSort(plan, terms, pl.d.GetOptions().SortMemory)
+		}
+	}
+	if stmt.Limit >= 0 {
+		plan = NewLimit(plan, stmt.Limit)
+	}
+	if stmt.Columns != nil {
+		exprs := make([]Scalar, len(stmt.Columns))
+		for i, column := range stmt.Columns {
+			if exprs[i], err = pl.bind(column); err != nil {
+				return nil, err
+			}
+		}
+		plan = NewProject(plan, exprs)
+	}
+	return plan, nil
+}
+
+// Plan a join of the left input with a table. Equality on the right table's
+// key merges the two when both are read in key order, or otherwise looks up
+// each match in its index; other equalities hash the right table; anything
+// else compares every pair of tuples. If ordered is set, the left input is in
+// the order of the first table's key.
+func (pl *planner) planJoin(left Operator, ordered bool, right scopeTable, on Scalar, rightConds []Scalar) Operator {
+	conds := conjuncts(on)
+	// The right table is read on its own, so its columns start at 0.
+	local := right
+	local.offset = 0
+	for i := range rightConds {
+		rightConds[i] = shiftColumns(rightConds[i], -right.offset)
+	}
+	var hashKeys []Scalar
+	hashCond := -1
+	for i, cond := range conds {
+		b, ok := cond.(*binaryExpr)
+		if !ok || b.op != "=" {
+			continue
+		}
+		for _, sides := range [][2]Scalar{{b.left, b.right}, {b.right, b.left}} {
+			rightOffsets, leftOffsets := make(map[int]bool), make(map[int]bool)
+			tableOffsets(sides[0], rightOffsets)
+			tableOffsets(sides[1], leftOffsets)
+			if len(rightOffsets) != 1 || !rightOffsets[right.offset] || len(leftOffsets) == 0 || leftOffsets[right.offset] {
+				continue
+			}
+			rest := append(append([]Scalar{}, conds[:i]...), conds[i+1:]...)
+			if col, isCol := sides[0].(*colExpr); isCol && col.offset == right.offset {
+				if leftCol, isCol := sides[1].(*colExpr); isCol && leftCol.offset == 0 && ordered {
+					if rightPlan, rightOrdered := pl.accessPath(local, rightConds); rightOrdered {
+						return filter(NewMergeJoin(left, rightPlan, leftCol, shiftColumns(col, -right.offset)), conjoin(rest))
+					}
+				}
+				join := NewIndexJoin(left, right.name, right.table, sides[1])
+				// Conditions on the right table are checked after the lookup.
+				for _, cond := range rightConds {
+					rest = append(rest, shiftColumns(cond, right.offset))
+				}
+				return filter(join, conjoin(rest))
+			}
+			if hashKeys == nil {
+				hashKeys, hashCond = []Scalar{sides[1], shiftColumns(sides[0], -right.offset)}, i
+			}
+		}
+	}
+	rightPlan, _ := pl.accessPath(local, rightConds)
+	if hashKeys != nil {
+		rest := append(append([]Scalar{}, conds[:hashCond]...), conds[hashCond+1:]...)
+		return filter(NewHashJoin(left, rightPlan, hashKeys[0], hashKeys[1]), conjoin(rest))
+	}
+	return NewNestedLoopJoin(left, rightPlan, on)
+}
+
+// Plan the scan for an update or delete of the entries where a condition holds.
+func (pl *planner) planWrite(name string, where Expr) (Operator, error) {
+	st, err := pl.addTable(TableRef{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	var cond Scalar
+	if where != nil {
+		if cond, err = pl.bind(where); err != nil {
+			return nil, err
+		}
+	}
+	single, multi := splitConds(conjuncts(cond))
+	plan, _ := pl.accessPath(st, single[st.offset])
+	return filter(plan, conjoin(multi)), nil
+}
+
+// Plan a statement that reads from the database.
+func PlanSelect(d *db.Database, stmt *SelectStmt) (Operator, error) {
+	pl := &planner{d: d}
+	return pl.planSelect(stmt)
+}
+
+// Run a SQL statement, writing any results to w.
+func ExecuteSQL(d *db.Database, input string, w io.Writer) error {
+	stmt, err := ParseSQL(input)
+	if err != nil {
+		return err
+	}
+	return executeStatement(d, stmt, w)
+}
+
+// Run a parsed SQL statement, writing any results to w.
+func executeStatement(d *db.Database, stmt Statement, w io.Writer) error {
+	pl := &planner{d: d}
+	switch stmt := stmt.(type) {
+	case *ExplainStmt:
+		return explainStatement(d, stmt.Stmt, w)
+	case *SelectStmt:
+		plan, err := pl.planSelect(stmt)
+		if err != nil {
+			return err
+		}
+		return Drain(plan, func(t Tuple) error {
+			_, err := io.WriteString(w, formatTuple(t))
+			return err
+		})
+	case *InsertStmt:
+		for _, row := range stmt.Rows {
+			var kv [2]int64
+			for i, e := range row {
+				bound, err := pl.bind(e)
+				if err != nil {
+					return err
+				}
+				if kv[i], err = bound.Eval(nil); err != nil {
+					return err
+				}
+			}
+			if err := d.Insert(stmt.Table, kv[0], kv[1]); err != nil {
+				return err
+			}
+		}
+		io.WriteString(w, fmt.Sprintf("%d entries inserted.\n", len(stmt.Rows)))
+		return nil
+	case *UpdateStmt:
+		plan, err := pl.planWrite(stmt.Table, stmt.Where)
+		if err != nil {
+			return err
+		}
+		value, err := pl.bind(stmt.Value)
+		if err != nil {
+			return err
+		}
+		// Find every change before making any, since cursors can't survive writes.
+		batch := utils.NewWriteBatch()
+		err = Drain(plan, func(t Tuple) error {
+			v, err := value.Eval(t)
+			if err != nil {
+				return err
+			}
+			batch.Put(t[0], v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = d.ApplyBatch(stmt.Table, batch); err != nil {
+			return err
+		}
+		io.WriteString(w, fmt.Sprintf("%d entries updated.\n", batch.Len()))
+		return nil
+	case *DeleteStmt:
+		plan, err := pl.planWrite(stmt.Table, stmt.Where)
+		if err != nil {
+			return err
+		}
+		batch := utils.NewWriteBatch()
+		err = Drain(plan, func(t Tuple) error {
+			batch.Delete(t[0])
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = d.ApplyBatch(stmt.Table, batch); err != nil {
+			return err
+		}
+		io.WriteString(w, fmt.Sprintf("%d entries deleted.\n", batch.Len()))
+		return nil
+	default:
+		return errors.New("unsupported statement")
+	}
+}
+
+// Write the plan of a statement.
+func explainStatement(d *db.Database, stmt Statement, w io.Writer) error {
+	pl := &planner{d: d}
+	var plan Operator
+	var err error
+	switch stmt := stmt.(type) {
+	case *SelectStmt:
+		plan, err = pl.planSelect(stmt)
+	case *UpdateStmt:
+		plan, err = pl.planWrite(stmt.Table, stmt.Where)
+	case *DeleteStmt:
+		plan, err = pl.planWrite(stmt.Table, stmt.Where)
+	default:
+		return errors.New("only SELECT, UPDATE and DELETE can be explained")
+	}
+	if err != nil {
+		return err
+	}
+	ExplainPlan(plan, w)
+	return nil
+}
+
+// Format a result Tuple like (a, b, ...).
+func formatTuple(t Tuple) string {
+	parts := make([]string, len(t))
+	for i, v := range t {
+		parts[i] = fmt.Sprint(v)
+	}
+	return "(" + strings.Join(parts, ", ") + ")\n"
+}
@@ -24,6 +24,18 @@ import (
 
    CHECKPOINT log -- lists the currently running transactions:
    < Tx1, Tx2... checkpoint >
+
+   DROP log -- a table was dropped:
+   < drop table table >
+
+   RENAME log -- a table was renamed:
+   < rename table oldname to newname >
+
+   TRUNCATE log -- a table was emptied:
+   < truncate table table >
+
+   BATCH log -- a batch of edits to one table, applied as a unit:
+   < Tx, table, BATCH, INSERT|DELETE|UPDATE key oldval newval; ... >
 */
 
 // A log.
@@ -47,6 +59,10 @@ func FromString(s string) (Log, error) {
 	startExp, _ := regexp.Compile(fmt.Sprintf("< (%s) start >", uuidPattern))
 	commitExp, _ := regexp.Compile(fmt.Sprintf("< (%s) commit >", uuidPattern))
 	checkpointExp, _ := regexp.Compile(fmt.Sprintf("< (%s,?\\s)*checkpoint >", uuidPattern))
+	dropExp, _ := regexp.Compile("< drop table (?P<tblName>\\w+) >")
+	renameExp, _ := regexp.Compile("< rename table (?P<oldName>\\w+) to (?P<newName>\\w+) >")
+	truncateExp, _ := regexp.Compile("< truncate table (?P<tblName>\\w+) >")
+	batchExp, _ := regexp.Compile(fmt.Sprintf("< (?P<uuid>%s), (?P<table>\\w+), BATCH, (?P<edits>%s(; %s)*) >", uuidPattern, batchEditPattern, batchEditPattern))
 	uuidExp, _ := regexp.Compile(uuidPattern)
 	switch {
 	case tableExp.MatchString(s):
@@ -57,6 +73,25 @@ func FromString(s string) (Log, error) {
 			tblType: tblType,
 			tblName: tblName,
 		}, nil
+	case batchExp.MatchString(s):
+		expStrs := batchExp.FindStringSubmatch(s)
+		id := uuid.MustParse(expStrs[1])
+		edits := make([]editLog, 0)
+		for _, editStr := range strings.Split(expStrs[3], "; ") {
+			fields := strings.Fields(editStr)
+			key, _ := strconv.Atoi(fields[1])
+			oldval, _ := strconv.Atoi(fields[2])
+			newval, _ := strconv.Atoi(fields[3])
+			edits = append(edits, editLog{
+				id:        id,
+				tablename: expStrs[2],
+				action:    Action(fields[0]),
+				key:       int64(key),
+				oldval:    int64(oldval),
+				newval:    int64(newval),
+			})
+		}
+		return &batchLog{id: id, tablename: expStrs[2], edits: edits}, nil
 	case editExp.MatchString(s):
 		expStrs := editExp.FindStringSubmatch(s)
 		uuid := uuid.MustParse(expStrs[1])
@@ -84,12 +119,22 @@ func FromString(s string) (Log, error) {
 			uuids = append(uuids, uuid.MustParse(uuidStr))
 		}
 		return &checkpointLog{ids: uuids}, nil
+	case dropExp.MatchString(s):
+		expStrs := dropExp.FindStringSubmatch(s)
+		return &dropLog{tblName: expStrs[1]}, nil
+	case renameExp.MatchString(s):
+		expStrs := renameExp.FindStringSubmatch(s)
+		return &renameLog{oldName: expStrs[1], newName: expStrs[2]}, nil
+	case truncateExp.MatchString(s):
+		expStrs := truncateExp.FindStringSubmatch(s)
+		return &truncateLog{tblName: expStrs[1]}, nil
 	default:
 		return nil, errors.New("could not parse log")
 	}
 }
 
 var uuidPattern string = "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}"
+var batchEditPattern string = "(?:UPDATE|INSERT|DELETE) \\d+ \\d+ \\d+"
 
 // Log for a transaction table create.
 type tableLog struct {
@@ -148,3 +193,46 @@ func (cl *checkpointLog) toString() string {
 	}
 	return fmt.Sprintf("< %s checkpoint >\n", strings.Join(idStrings, ", "))
 }
+
+// Log for a table drop.
+type dropLog struct {
+	tblName string
+}
+
+func (dl *dropLog) toString() string {
+	return fmt.Sprintf("< drop table %s >\n", dl.tblName)
+}
+
+// Log for a table rename.
+type renameLog struct {
+	oldName string
+	newName string
+}
+
+func (rl *renameLog) toString() string {
+	return fmt.Sprintf("< rename table %s to %s >\n", rl.oldName, rl.newName)
+}
+
+// Log for a table truncate.
+type truncateLog struct {
+	tblName string
+}
+
+func (tl *truncateLog) toString() string {
+	return fmt.Sprintf("< truncate table %s >\n", tl.tblName)
+}
+
+// Log for a batch of edits to one table.
+type batchLog struct {
+	id        uuid.UUID
+	tablename string
+	edits     []editLog
+}
+
+func (bl *batchLog) toString() string {
+	editStrings := make([]string, 0, len(bl.edits))
+	for _, el := range bl.edits {
+		editStrings = append(editStrings, fmt.Sprintf("%s %v %v %v", el.action, el.key, el.oldval, el.newval))
+	}
+	return fmt.Sprintf("< %s, %s, BATCH, %s >\n", bl.id.String(), bl.tablename, strings.Join(editStrings, "; "))
+}
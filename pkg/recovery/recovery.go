@@ -3,12 +3,16 @@ package recovery
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
 	concurrency "github.com/brown-csci1270/db/pkg/concurrency"
+	config "github.com/brown-csci1270/db/pkg/config"
 	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
 	"github.com/otiai10/copy"
 
 	uuid "github.com/google/uuid"
@@ -20,6 +24,7 @@ type RecoveryManager struct {
 	tm      *concurrency.TransactionManager
 	txStack map[uuid.UUID]([]Log)
 	fd      *os.File
+	sync    bool // Whether to sync the log after every record.
 	mtx     sync.Mutex
 }
 
@@ -38,13 +43,23 @@ func NewRecoveryManager(
 		tm:      tm,
 		txStack: make(map[uuid.UUID][]Log),
 		fd:      fd,
+		sync:    d.GetOptions().Sync == config.SyncAlways,
 	}, nil
 }
 
+// Only key/value writes are logged; a row table's heap can't be redone or
+// undone, so row tables are refused rather than left out of the log.
+func checkLogged(d *db.Database, tblName string) error {
+	if info, ok := d.GetTableInfo(tblName); ok && info.IsRowTable() {
+		return fmt.Errorf("%s has columns; row tables aren't supported in recovery mode", tblName)
+	}
+	return nil
+}
+
 // Write the string `s` to the log file. Expects rm.mtx to be locked
 func (rm *RecoveryManager) writeToBuffer(s string) error {
 	_, err := rm.fd.WriteString(s)
-	if err != nil {
+	if err != nil || !rm.sync {
 		return err
 	}
 	err = rm.fd.Sync()
@@ -62,6 +77,30 @@ func (rm *RecoveryManager) Table(tblType string, tblName string) {
 	rm.writeToBuffer(new_table_log.toString())
 }
 
+// Write a Drop log.
+func (rm *RecoveryManager) Drop(tblName string) {
+	rm.mtx.Lock()
+	defer rm.mtx.Unlock()
+	new_drop_log := dropLog{tblName: tblName}
+	rm.writeToBuffer(new_drop_log.toString())
+}
+
+// Write a Rename log.
+func (rm *RecoveryManager) Rename(oldName string, newName string) {
+	rm.mtx.Lock()
+	defer rm.mtx.Unlock()
+	new_rename_log := renameLog{oldName: oldName, newName: newName}
+	rm.writeToBuffer(new_rename_log.toString())
+}
+
+// Write a Truncate log.
+func (rm *RecoveryManager) Truncate(tblName string) {
+	rm.mtx.Lock()
+	defer rm.mtx.Unlock()
+	new_truncate_log := truncateLog{tblName: tblName}
+	rm.writeToBuffer(new_truncate_log.toString())
+}
+
 // Write an Edit log.
 func (rm *RecoveryManager) Edit(clientId uuid.UUID, table db.Index, action Action, key int64, oldval int64, newval int64) {
 	rm.mtx.Lock()
@@ -76,9 +115,83 @@ func (rm *RecoveryManager) Edit(clientId uuid.UUID, table db.Index, action Actio
 
 	rm.txStack[clientId] = append(rm.txStack[clientId], &new_edit_log)
 
+	// Edits to memory tables can still be rolled back, but aren't replayed after a crash.
+	if info, ok := rm.d.GetTableInfo(table.GetName()); ok && !info.Durable {
+		return
+	}
 	rm.writeToBuffer(new_edit_log.toString())
 }
 
+// Write a Batch log.
+func (rm *RecoveryManager) Batch(clientId uuid.UUID, table db.Index, edits []editLog) {
+	rm.mtx.Lock()
+	defer rm.mtx.Unlock()
+	new_batch_log := batchLog{
+		id:        clientId,
+		tablename: table.GetName(),
+		edits:     edits}
+
+	rm.txStack[clientId] = append(rm.txStack[clientId], &new_batch_log)
+
+	if info, ok := rm.d.GetTableInfo(table.GetName()); ok && !info.Durable {
+		return
+	}
+	rm.writeToBuffer(new_batch_log.toString())
+}
+
+// Apply a batch of writes to a table as part of the client's transaction,
+// logging it as a single record. Rolls back the transaction on failure.
+func (rm *RecoveryManager) ApplyBatch(clientId uuid.UUID, tableName string, batch *utils.WriteBatch) error {
+	err := rm.applyBatch(clientId, tableName, batch)
+	if err != nil {
+		rberr := rm.Rollback(clientId)
+		if rberr != nil {
+			return rberr
+		}
+	}
+	return err
+}
+
+// Lock every key in the batch, log the batch, then apply it.
+func (rm *RecoveryManager) applyBatch(clientId uuid.UUID, tableName string, batch *utils.WriteBatch) error {
+	table, err := rm.d.GetTable(tableName)
+	if err != nil {
+		return fmt.Errorf("batch error: %w", err)
+	}
+	if err = checkLogged(rm.d, tableName); err != nil {
+		return fmt.Errorf("batch error: %w", err)
+	}
+	// Remember each key's old value so that the batch can be undone.
+	edits := make([]editLog, 0, batch.Len())
+	for _, op := range batch.Ops() {
+		if err = rm.tm.Lock(clientId, table, op.Key, concurrency.W_LOCK); err != nil {
+			return fmt.Errorf("batch error: %w", err)
+		}
+		edit := editLog{id: clientId, tablename: tableName, key: op.Key, newval: op.Value}
+		old, err := table.Find(op.Key)
+		switch {
+		case op.Delete && err != nil:
+			// Nothing to delete.
+			continue
+		case op.Delete:
+			edit.action, edit.oldval, edit.newval = DELETE_ACTION, old.GetValue(), 0
+		case err != nil:
+			edit.action = INSERT_ACTION
+		default:
+			edit.action, edit.oldval = UPDATE_ACTION, old.GetValue()
+		}
+		edits = append(edits, edit)
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	rm.Batch(clientId, table, edits)
+	if err = rm.d.ApplyBatch(tableName, batch); err != nil {
+		return fmt.Errorf("batch error: %w", err)
+	}
+	return nil
+}
+
 // Write a transaction start log.
 func (rm *RecoveryManager) Start(clientId uuid.UUID) {
 	rm.mtx.Lock()
@@ -130,44 +243,43 @@ func (rm *RecoveryManager) Checkpoint() {
 func (rm *RecoveryManager) Redo(log Log) error {
 	switch log := log.(type) {
 	case *tableLog:
-		payload := fmt.Sprintf("create %s table %s", log.tblType, log.tblName)
-		err := db.HandleCreateTable(rm.d, payload, os.Stdout)
+		indexType, err := db.ParseIndexType(log.tblType)
 		if err != nil {
 			return err
 		}
+		if _, err = rm.d.CreateTable(log.tblName, indexType, nil, true); err != nil {
+			return err
+		}
+	case *dropLog:
+		return rm.d.DropTable(log.tblName)
+	case *renameLog:
+		return rm.d.RenameTable(log.oldName, log.newName)
+	case *truncateLog:
+		return rm.d.TruncateTable(log.tblName)
 	case *editLog:
 		switch log.action {
-		case INSERT_ACTION:
-			payload := fmt.Sprintf("insert %v %v into %s", log.key, log.newval, log.tablename)
-			err := db.HandleInsert(rm.d, payload)
-			if err != nil {
-				// There is already an entry, try updating
-				payload := fmt.Sprintf("update %s %v %v", log.tablename, log.key, log.newval)
-				err = db.HandleUpdate(rm.d, payload)
-				if err != nil {
-					return err
-				}
-			}
-		case UPDATE_ACTION:
-			payload := fmt.Sprintf("update %s %v %v", log.tablename, log.key, log.newval)
-			err := db.HandleUpdate(rm.d, payload)
-			if err != nil {
-				// Entry may have been deleted, try inserting
-				payload := fmt.Sprintf("insert %v %v into %s", log.key, log.newval, log.tablename)
-				err := db.HandleInsert(rm.d, payload)
-				if err != nil {
-					return err
-				}
-			}
+		case INSERT_ACTION, UPDATE_ACTION:
+			// The entry may or may not already be there.
+			return rm.d.Upsert(log.tablename, log.key, log.newval)
 		case DELETE_ACTION:
-			payload := fmt.Sprintf("delete %v from %s", log.key, log.tablename)
-			err := db.HandleDelete(rm.d, payload)
-			if err != nil {
+			err := rm.d.Delete(log.tablename, log.key)
+			// The entry may already be gone.
+			if err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
 				return err
 			}
 		}
+	case *batchLog:
+		batch := utils.NewWriteBatch()
+		for _, edit := range log.edits {
+			if edit.action == DELETE_ACTION {
+				batch.Delete(edit.key)
+			} else {
+				batch.Put(edit.key, edit.newval)
+			}
+		}
+		return rm.d.ApplyBatch(log.tablename, batch)
 	default:
-		return errors.New("can only redo edit logs")
+		return errors.New("can only redo table and edit logs")
 	}
 	return nil
 }
@@ -176,26 +288,26 @@ func (rm *RecoveryManager) Redo(log Log) error {
 func (rm *RecoveryManager) Undo(log Log) error {
 	switch log := log.(type) {
 	case *editLog:
+		tx := rm.Tx(log.id)
 		switch log.action {
 		case INSERT_ACTION:
-			payload := fmt.Sprintf("delete %v from %s", log.key, log.tablename)
-			err := HandleDelete(rm.d, rm.tm, rm, payload, log.id)
-			if err != nil {
-				return err
-			}
+			return tx.Delete(log.tablename, log.key)
 		case UPDATE_ACTION:
-			payload := fmt.Sprintf("update %s %v %v", log.tablename, log.key, log.oldval)
-			err := HandleUpdate(rm.d, rm.tm, rm, payload, log.id)
-			if err != nil {
-				return err
-			}
+			return tx.Update(log.tablename, log.key, log.oldval)
 		case DELETE_ACTION:
-			payload := fmt.Sprintf("insert %v %v into %s", log.key, log.oldval, log.tablename)
-			err := HandleInsert(rm.d, rm.tm, rm, payload, log.id)
-			if err != nil {
-				return err
+			return tx.Insert(log.tablename, log.key, log.oldval)
+		}
+	case *batchLog:
+		// Put back every old value, and remove every inserted key.
+		batch := utils.NewWriteBatch()
+		for _, edit := range log.edits {
+			if edit.action == INSERT_ACTION {
+				batch.Delete(edit.key)
+			} else {
+				batch.Put(edit.key, edit.oldval)
 			}
 		}
+		return rm.applyBatch(log.id, log.tablename, batch)
 	default:
 		return errors.New("can only undo edit logs")
 	}
@@ -261,7 +373,7 @@ func (rm *RecoveryManager) Recover() error {
 			if err != nil {
 				return err
 			}
-		case *editLog:
+		case *editLog, *batchLog, *dropLog, *renameLog, *truncateLog:
 			err := rm.Redo(cur_log)
 			if err != nil {
 				return err
@@ -285,6 +397,14 @@ func (rm *RecoveryManager) Recover() error {
 					return err
 				}
 			}
+		case *batchLog:
+			txn_id := cur_log.id
+			if _, ok := active_map[txn_id]; ok {
+				err := rm.Undo(cur_log)
+				if err != nil {
+					return err
+				}
+			}
 		case *startLog:
 			txn_id := cur_log.id
 			if _, ok := active_map[txn_id]; ok {
@@ -338,7 +458,7 @@ func (rm *RecoveryManager) Rollback(clientId uuid.UUID) error {
 }
 
 // Primes the database for recovery
-func Prime(folder string) (*db.Database, error) {
+func Prime(folder string, opts config.Options) (*db.Database, error) {
 	// Ensure folder is of the form */
 	base := strings.TrimSuffix(folder, "/")
 	recoveryFolder := base + "-recovery/"
@@ -349,22 +469,33 @@ func Prime(folder string) (*db.Database, error) {
 			if err != nil {
 				return nil, err
 			}
-			return db.Open(dbFolder)
+			return db.Open(dbFolder, opts)
 		}
 		return nil, err
 	}
 	if _, err := os.Stat(recoveryFolder); err != nil {
 		if os.IsNotExist(err) {
-			return db.Open(dbFolder)
+			return db.Open(dbFolder, opts)
 		}
 		return nil, err
 	}
+	// The log may live in the data folder; keep it rather than the checkpoint's copy.
+	logPath := opts.LogFile
+	if !filepath.IsAbs(logPath) {
+		logPath = filepath.Join(dbFolder, logPath)
+	}
+	logData, logErr := ioutil.ReadFile(logPath)
 	os.RemoveAll(dbFolder)
 	err := copy.Copy(recoveryFolder, dbFolder)
 	if err != nil {
 		return nil, err
 	}
-	return db.Open(dbFolder)
+	if logErr == nil {
+		if err = ioutil.WriteFile(logPath, logData, 0666); err != nil {
+			return nil, err
+		}
+	}
+	return db.Open(dbFolder, opts)
 }
 
 // Should be called at end of Checkpoint.
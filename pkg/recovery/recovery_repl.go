@@ -11,6 +11,7 @@ import (
 	db "github.com/brown-csci1270/db/pkg/db"
 	query "github.com/brown-csci1270/db/pkg/query"
 	repl "github.com/brown-csci1270/db/pkg/repl"
+	utils "github.com/brown-csci1270/db/pkg/utils"
 
 	uuid "github.com/google/uuid"
 )
@@ -20,7 +21,16 @@ func RecoveryREPL(d *db.Database, tm *concurrency.TransactionManager, rm *Recove
 	r := repl.NewRepl()
 	r.AddCommand("create", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleCreateTable(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Create a table. usage: create table <table>")
+	}, "Create a table. usage: create [memory] [btree|hash|linear] table <table>")
+	r.AddCommand("drop", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleDropTable(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Drop a table. usage: drop table <table>")
+	r.AddCommand("rename", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleRenameTable(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Rename a table. usage: rename table <table> to <table>")
+	r.AddCommand("truncate", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleTruncateTable(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Remove all entries from a table. usage: truncate table <table>")
 	r.AddCommand("find", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleFind(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
 	}, "Find an element. usage: find <key> from <table>")
@@ -70,20 +80,12 @@ func HandleTransaction(d *db.Database, tm *concurrency.TransactionManager, rm *R
 	}
 	switch fields[1] {
 	case "begin":
-		rm.Start(clientId)
-		err = tm.Begin(clientId)
+		_, err = rm.BeginTx(clientId)
 	case "commit":
-		rm.Commit(clientId)
-		err = tm.Commit(clientId)
+		err = rm.Tx(clientId).Commit()
 	default:
 		return errors.New("internal error in create table handler")
 	}
-	if err != nil {
-		rberr := rm.Rollback(clientId)
-		if rberr != nil {
-			return rberr
-		}
-	}
 	return err
 }
 
@@ -91,12 +93,81 @@ func HandleTransaction(d *db.Database, tm *concurrency.TransactionManager, rm *R
 func HandleCreateTable(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
-	// Usage: create <type> table <table>
-	if numFields != 4 || fields[2] != "table" || (fields[1] != "btree" && fields[1] != "hash") {
-		return fmt.Errorf("usage: create <btree|hash> table <table>")
+	// Usage: create index on <table>(value)
+	if numFields > 1 && fields[1] == "index" {
+		// Secondary indexes are kept in sync by redoing edits, so there is nothing to log.
+		return db.HandleCreateTable(d, payload, w)
+	}
+	// Usage: create [memory] table <table> (<column> <type> [primary key], ...)
+	if strings.Contains(payload, "(") {
+		return errors.New("create error: row tables aren't supported in recovery mode")
+	}
+	// Usage: create [memory] [type] table <table>
+	if numFields > 1 && fields[1] == "memory" {
+		// Memory tables don't survive a crash, so there is nothing to log.
+		return db.HandleCreateTable(d, payload, w)
+	}
+	// Log the type a table gets by default, in case the default changes before recovery.
+	if numFields == 3 && fields[1] == "table" {
+		fields = []string{fields[0], d.GetDefaultIndexType().String(), fields[1], fields[2]}
+		numFields = len(fields)
+	}
+	if numFields != 4 || fields[2] != "table" || (fields[1] != "btree" && fields[1] != "hash" && fields[1] != "linear") {
+		return fmt.Errorf("usage: create [memory] [btree|hash|linear] table <table>")
 	}
 	rm.Table(fields[1], fields[3])
-	return db.HandleCreateTable(d, payload, w)
+	return db.HandleCreateTable(d, strings.Join(fields, " "), w)
+}
+
+// Check that a table exists and is durable, so that we only log operations that can be redone.
+func isDurableTable(d *db.Database, tblName string) bool {
+	info, ok := d.GetTableInfo(tblName)
+	return ok && info.Durable
+}
+
+// Handle drop table.
+func HandleDropTable(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: drop table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: drop table <table>")
+	}
+	if isDurableTable(d, fields[2]) {
+		rm.Drop(fields[2])
+	}
+	return db.HandleDropTable(d, payload, w)
+}
+
+// Handle rename table.
+func HandleRenameTable(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: rename table <table> to <table>
+	if numFields != 5 || fields[1] != "table" || fields[3] != "to" {
+		return fmt.Errorf("usage: rename table <table> to <table>")
+	}
+	if _, err := d.GetTable(fields[4]); err == nil {
+		return fmt.Errorf("rename error: %w", utils.ErrTableExists)
+	}
+	if isDurableTable(d, fields[2]) {
+		rm.Rename(fields[2], fields[4])
+	}
+	return db.HandleRenameTable(d, payload, w)
+}
+
+// Handle truncate table.
+func HandleTruncateTable(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: truncate table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: truncate table <table>")
+	}
+	if isDurableTable(d, fields[2]) {
+		rm.Truncate(fields[2])
+	}
+	return db.HandleTruncateTable(d, payload, w)
 }
 
 // Handle find.
@@ -110,41 +181,19 @@ func HandleInsert(d *db.Database, tm *concurrency.TransactionManager, rm *Recove
 	numFields := len(fields)
 	// Usage: insert <key> <value> into <table>
 	var key, newval int
-	var table db.Index
 	if numFields != 5 || fields[3] != "into" {
 		return fmt.Errorf("usage: insert <key> <value> into <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("insert error: %w", err)
 	}
 	if newval, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("insert error: %w", err)
 	}
-	if table, err = d.GetTable(fields[4]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	if err = rm.Tx(clientId).Insert(fields[4], int64(key), int64(newval)); err != nil {
+		return fmt.Errorf("insert error: %w", err)
 	}
-	// First, check that the desired value doesn't exist.
-	_, err = table.Find(int64(key))
-	if err == nil {
-		return errors.New("insert error: key already exists")
-	}
-	// Log.
-	rm.Edit(clientId, table, INSERT_ACTION, int64(key), 0, int64(newval))
-	// Run transaction insert.
-	err = concurrency.HandleInsert(d, tm, payload, clientId)
-	if err != nil {
-		// Add a log to mark this insert as a no-op.
-		rm.Edit(clientId, table, DELETE_ACTION, int64(key), int64(newval), int64(0))
-		// Then pop the last two actions from the transaction stack because
-		// these last two actions were no-ops.
-		stack := rm.txStack[clientId]
-		rm.txStack[clientId] = stack[:len(stack)-2]
-		rberr := rm.Rollback(clientId)
-		if rberr != nil {
-			return rberr
-		}
-	}
-	return err
+	return nil
 }
 
 // Handle update.
@@ -153,41 +202,19 @@ func HandleUpdate(d *db.Database, tm *concurrency.TransactionManager, rm *Recove
 	numFields := len(fields)
 	// Usage: update <table> <key> <value>
 	var key, newval int
-	var table db.Index
 	if numFields != 4 {
 		return fmt.Errorf("usage: update <table> <key> <value>")
 	}
 	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("update error: %w", err)
 	}
 	if newval, err = strconv.Atoi(fields[3]); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	if table, err = d.GetTable(fields[1]); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	// First, check that the desired value exists.
-	oldval, err := table.Find(int64(key))
-	if err != nil {
-		return errors.New("update error: key doesn't exists")
+		return fmt.Errorf("update error: %w", err)
 	}
-	// Log.
-	rm.Edit(clientId, table, UPDATE_ACTION, int64(key), oldval.GetValue(), int64(newval))
-	// Run transaction insert.
-	err = concurrency.HandleUpdate(d, tm, payload, clientId)
-	if err != nil {
-		// Add a log to mark this update as a no-op.
-		rm.Edit(clientId, table, UPDATE_ACTION, int64(key), int64(newval), oldval.GetValue())
-		// Then pop the last two actions from the transaction stack because
-		// these last two actions were no-ops.
-		stack := rm.txStack[clientId]
-		rm.txStack[clientId] = stack[:len(stack)-2]
-		rberr := rm.Rollback(clientId)
-		if rberr != nil {
-			return rberr
-		}
+	if err = rm.Tx(clientId).Update(fields[1], int64(key), int64(newval)); err != nil {
+		return fmt.Errorf("update error: %w", err)
 	}
-	return err
+	return nil
 }
 
 // Handle delete.
@@ -196,38 +223,16 @@ func HandleDelete(d *db.Database, tm *concurrency.TransactionManager, rm *Recove
 	numFields := len(fields)
 	// Usage: delete <key> from <table>
 	var key int
-	var table db.Index
 	if numFields != 4 || fields[2] != "from" {
 		return fmt.Errorf("usage: delete <key> from <table>")
 	}
 	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
-	}
-	if table, err = d.GetTable(fields[3]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("delete error: %w", err)
 	}
-	// First, check that the desired value exists.
-	oldval, err := table.Find(int64(key))
-	if err != nil {
-		return errors.New("delete error: key doesn't exists")
+	if err = rm.Tx(clientId).Delete(fields[3], int64(key)); err != nil {
+		return fmt.Errorf("delete error: %w", err)
 	}
-	// Log.
-	rm.Edit(clientId, table, DELETE_ACTION, int64(key), oldval.GetValue(), 0)
-	// Run transaction insert.
-	err = concurrency.HandleDelete(d, tm, payload, clientId)
-	if err != nil {
-		// Add a log to mark this delete as a no-op.
-		rm.Edit(clientId, table, INSERT_ACTION, int64(key), 0, oldval.GetValue())
-		// Then pop the last two actions from the transaction stack because
-		// these last two actions were no-ops.
-		stack := rm.txStack[clientId]
-		rm.txStack[clientId] = stack[:len(stack)-2]
-		rberr := rm.Rollback(clientId)
-		if rberr != nil {
-			return rberr
-		}
-	}
-	return err
+	return nil
 }
 
 // Handle select.
@@ -0,0 +1,162 @@
+package recovery
+
+import (
+	"errors"
+
+	concurrency "github.com/brown-csci1270/db/pkg/concurrency"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+	uuid "github.com/google/uuid"
+)
+
+// A Tx runs operations on a database under a client's transaction, locking each
+// key it touches and logging each write so that it can be undone or redone.
+// A failed write rolls back the whole transaction.
+type Tx struct {
+	locks *concurrency.Tx
+	rm    *RecoveryManager
+}
+
+// Begin a logged transaction for the given client and get a handle on it.
+func (rm *RecoveryManager) BeginTx(clientId uuid.UUID) (*Tx, error) {
+	rm.Start(clientId)
+	if err := rm.tm.Begin(clientId); err != nil {
+		if rberr := rm.Rollback(clientId); rberr != nil {
+			return nil, rberr
+		}
+		return nil, err
+	}
+	return rm.Tx(clientId), nil
+}
+
+// Get a handle on the given client's transaction, which must be begun before use.
+func (rm *RecoveryManager) Tx(clientId uuid.UUID) *Tx {
+	return &Tx{locks: rm.tm.Tx(rm.d, clientId), rm: rm}
+}
+
+// Get the id of the client running the transaction.
+func (tx *Tx) GetClientID() uuid.UUID {
+	return tx.locks.GetClientID()
+}
+
+// Find the entry with the given key.
+func (tx *Tx) Find(name string, key int64) (utils.Entry, error) {
+	return tx.locks.Find(name, key)
+}
+
+// Call fn on each entry of a table. Scans don't lock anything, so they may see
+// other transactions' uncommitted writes.
+func (tx *Tx) Scan(name string, fn func(utils.Entry) error) error {
+	return tx.locks.Scan(name, fn)
+}
+
+// Insert an entry; errors if the key already exists.
+func (tx *Tx) Insert(name string, key int64, value int64) error {
+	if err := tx.lockForWrite(name, key); err != nil {
+		return err
+	}
+	if _, err := tx.rm.d.Find(name, key); err == nil {
+		return utils.ErrKeyExists
+	} else if !errors.Is(err, utils.ErrKeyNotFound) {
+		return err
+	}
+	return tx.edit(name, INSERT_ACTION, key, 0, value, func() error {
+		return tx.locks.Insert(name, key, value)
+	})
+}
+
+// Update an existing entry.
+func (tx *Tx) Update(name string, key int64, value int64) error {
+	if err := tx.lockForWrite(name, key); err != nil {
+		return err
+	}
+	old, err := tx.rm.d.Find(name, key)
+	if err != nil {
+		return err
+	}
+	return tx.edit(name, UPDATE_ACTION, key, old.GetValue(), value, func() error {
+		return tx.locks.Update(name, key, value)
+	})
+}
+
+// Delete an existing entry.
+func (tx *Tx) Delete(name string, key int64) error {
+	if err := tx.lockForWrite(name, key); err != nil {
+		return err
+	}
+	old, err := tx.rm.d.Find(name, key)
+	if err != nil {
+		return err
+	}
+	return tx.edit(name, DELETE_ACTION, key, old.GetValue(), 0, func() error {
+		return tx.locks.Delete(name, key)
+	})
+}
+
+// Write-lock a key before reading the value a write will replace, so no other
+// transaction can change it before the write is logged. Rolls back the
+// transaction if the lock can't be taken.
+func (tx *Tx) lockForWrite(name string, key int64) error {
+	if _, err := tx.rm.d.GetTable(name); err != nil {
+		return err
+	}
+	if err := checkLogged(tx.rm.d, name); err != nil {
+		return err
+	}
+	err := tx.locks.LockForWrite(name, key)
+	if err == nil {
+		return nil
+	}
+	if rberr := tx.rm.Rollback(tx.GetClientID()); rberr != nil {
+		return rberr
+	}
+	return err
+}
+
+// Apply a batch of writes to a table, logged as a single record.
+func (tx *Tx) ApplyBatch(name string, batch *utils.WriteBatch) error {
+	return tx.rm.ApplyBatch(tx.GetClientID(), name, batch)
+}
+
+// Commit the transaction, releasing its locks.
+func (tx *Tx) Commit() error {
+	clientId := tx.GetClientID()
+	tx.rm.Commit(clientId)
+	if err := tx.locks.Commit(); err != nil {
+		if rberr := tx.rm.Rollback(clientId); rberr != nil {
+			return rberr
+		}
+		return err
+	}
+	return nil
+}
+
+// Undo every write made by the transaction and end it.
+func (tx *Tx) Rollback() error {
+	return tx.rm.Rollback(tx.GetClientID())
+}
+
+// Log an edit, then apply it. If applying fails, the edit is cancelled out and
+// the transaction is rolled back.
+func (tx *Tx) edit(name string, action Action, key int64, oldval int64, newval int64, apply func() error) error {
+	table, err := tx.rm.d.GetTable(name)
+	if err != nil {
+		return err
+	}
+	clientId := tx.GetClientID()
+	tx.rm.Edit(clientId, table, action, key, oldval, newval)
+	if err = apply(); err == nil {
+		return nil
+	}
+	// Log the inverse edit so that recovery treats the pair as a no-op.
+	inverse := map[Action]Action{INSERT_ACTION: DELETE_ACTION, UPDATE_ACTION: UPDATE_ACTION, DELETE_ACTION: INSERT_ACTION}
+	tx.rm.Edit(clientId, table, inverse[action], key, newval, oldval)
+	// Then pop both edits from the transaction stack so that rollback skips them.
+	tx.rm.mtx.Lock()
+	stack := tx.rm.txStack[clientId]
+	tx.rm.txStack[clientId] = stack[:len(stack)-2]
+	tx.rm.mtx.Unlock()
+	if rberr := tx.rm.Rollback(clientId); rberr != nil {
+		return rberr
+	}
+	return err
+}
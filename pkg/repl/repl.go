@@ -149,10 +149,14 @@ func (r *REPL) Run(c net.Conn, clientId uuid.UUID, prompt string) {
 }
 
 // cleanInput preprocesses input to the db repl.
+// Text between single quotes is left as-is, so string values keep their case.
 func cleanInput(text string) string {
 	output := strings.TrimSpace(text)
-	output = strings.ToLower(output)
-	return output
+	parts := strings.Split(output, "'")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = strings.ToLower(parts[i])
+	}
+	return strings.Join(parts, "'")
 }
 
 
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"sort"
+)
+
+// A single write in a WriteBatch.
+type BatchOp struct {
+	Key    int64
+	Value  int64 // Unused for deletes.
+	Delete bool
+}
+
+// WriteBatch collects puts and deletes so that an index can apply them together.
+// A put inserts the key or overwrites its value; deleting a missing key does nothing.
+type WriteBatch struct {
+	ops []BatchOp
+}
+
+// Create an empty batch.
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{ops: make([]BatchOp, 0)}
+}
+
+// Add a put to the batch.
+func (batch *WriteBatch) Put(key int64, value int64) {
+	batch.ops = append(batch.ops, BatchOp{Key: key, Value: value})
+}
+
+// Add a delete to the batch.
+func (batch *WriteBatch) Delete(key int64) {
+	batch.ops = append(batch.ops, BatchOp{Key: key, Delete: true})
+}
+
+// Get the number of writes added to the batch.
+func (batch *WriteBatch) Len() int {
+	return len(batch.ops)
+}
+
+// Remove all writes from the batch.
+func (batch *WriteBatch) Reset() {
+	batch.ops = batch.ops[:0]
+}
+
+// Get the batch's writes sorted by key. If a key was written more than once,
+// only the last write to it is kept.
+func (batch *WriteBatch) Ops() []BatchOp {
+	ops := make([]BatchOp, len(batch.ops))
+	copy(ops, batch.ops)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Key < ops[j].Key })
+	deduped := ops[:0]
+	for i, op := range ops {
+		if i+1 < len(ops) && ops[i+1].Key == op.Key {
+			continue
+		}
+		deduped = append(deduped, op)
+	}
+	return deduped
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"errors"
+)
+
+// Errors shared across indexes and the database. They are often wrapped with
+// more context, so compare against them with errors.Is.
+var (
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrKeyExists     = errors.New("key already exists")
+	ErrTableNotFound = errors.New("table not found")
+	ErrTableExists   = errors.New("table already exists")
+	ErrCorrupt       = errors.New("data is corrupted")
+	ErrDeadlock      = errors.New("deadlock detected")
+)
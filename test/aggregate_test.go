@@ -0,0 +1,86 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	query "github.com/brown-csci1270/db/pkg/query"
+)
+
+func TestAggregate(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	table, err := d.CreateTable("t", db.BTreeIndexType, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 1000; i++ {
+		if err := d.Insert("t", i, i%4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(payload string) string {
+		var buf bytes.Buffer
+		if err := query.HandleAggregate(d, payload, &buf); err != nil {
+			t.Fatalf("%s: %v", payload, err)
+		}
+		return buf.String()
+	}
+	cases := map[string]string{
+		"aggregate count(*), sum(key), min(key), max(key), avg(key) from t": "(1000, 500500, 1, 1000, 500)\n",
+		"aggregate count(*), sum(key) from t group by value":                "(1, 250, 124750)\n(2, 250, 125000)\n(3, 250, 125250)\n(0, 250, 125500)\n",
+	}
+	for payload, want := range cases {
+		if got := run(payload); got != want {
+			t.Errorf("%s: expected %q, got %q", payload, want, got)
+		}
+	}
+	// Btrees grouped by key stream their groups in order.
+	if got := run("aggregate max(value) from t group by key"); !strings.HasPrefix(got, "(1, 1)\n(2, 2)\n(3, 3)\n(4, 0)\n") || strings.Count(got, "\n") != 1000 {
+		t.Errorf("unexpected groups by key, got %d lines", strings.Count(got, "\n"))
+	}
+	// Hash and sort aggregation agree once the sort's input is ordered.
+	value := query.Column("value", 1)
+	aggs := []query.Aggregate{{Func: query.Count}, {Func: query.Avg, Arg: query.Column("key", 0)}}
+	collect := func(op query.Operator) []query.Tuple {
+		var tuples []query.Tuple
+		if err := query.Drain(op, func(tuple query.Tuple) error {
+			tuples = append(tuples, tuple)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return tuples
+	}
+	hashed := collect(query.NewSort(query.NewHashAggregate(query.NewScan("t", table), value, aggs), []query.SortTerm{{Expr: query.Column("value", 0)}}))
+	sorted := collect(query.NewSortAggregate(query.NewSort(query.NewScan("t", table), []query.SortTerm{{Expr: value}}), value, aggs))
+	if want := []query.Tuple{{0, 250, 502}, {1, 250, 499}, {2, 250, 500}, {3, 250, 501}}; !reflect.DeepEqual(hashed, want) || !reflect.DeepEqual(sorted, want) {
+		t.Errorf("expected %v from both aggregations, got %v and %v", want, hashed, sorted)
+	}
+	// An empty table still has one ungrouped result.
+	if _, err := d.CreateTable("empty", db.HashIndexType, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := run("aggregate count(*), max(key) from empty"); got != "(0, 0)\n" {
+		t.Errorf("expected a single zero result for an empty table, got %q", got)
+	}
+	for _, payload := range []string{
+		"aggregate sum(*) from t",
+		"aggregate median(key) from t",
+		"aggregate count(*) from t group by nothing",
+		"aggregate count(*) t",
+	} {
+		if err := query.HandleAggregate(d, payload, &bytes.Buffer{}); err == nil {
+			t.Errorf("%s: expected an error", payload)
+		}
+	}
+}
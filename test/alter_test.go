@@ -0,0 +1,111 @@
+package test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+func TestAlterIndexType(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCreateTable(d, "create btree table t", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 5000; i++ {
+		if err := d.Insert("t", i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each writer owns a range of keys, so the expected contents are known.
+	const numWriters = 4
+	expected := make([]map[int64]int64, numWriters)
+	for w := range expected {
+		expected[w] = make(map[int64]int64)
+		for i := int64(w); i < 5000; i += numWriters {
+			expected[w][i] = i
+		}
+	}
+	for _, indexType := range []string{"hash", "linear", "btree"} {
+		var wg sync.WaitGroup
+		for w := 0; w < numWriters; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(int64(w)))
+				for n := 0; n < 500; n++ {
+					key := int64(w) + numWriters*r.Int63n(2000)
+					if r.Intn(3) == 0 {
+						if err := d.Delete("t", key); err == nil {
+							delete(expected[w], key)
+						}
+					} else {
+						value := r.Int63n(1000)
+						if err := d.Upsert("t", key, value); err != nil {
+							t.Error(err)
+							return
+						}
+						expected[w][key] = value
+					}
+				}
+			}(w)
+		}
+		err := db.HandleAlterTable(d, "alter table t set index "+indexType, ioutil.Discard)
+		wg.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := d.GetTableInfo("t"); info.Type.String() != indexType {
+			t.Fatalf("expected a %s index, got %v", indexType, info.Type)
+		}
+		checkContents(t, d, "t", expected)
+	}
+	if err := db.HandleAlterTable(d, "alter table t set index btree", ioutil.Discard); err == nil {
+		t.Error("rebuilt a table as the type it already has")
+	}
+	// The new index type should survive a restart.
+	d.Close()
+	d, err = db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if info, _ := d.GetTableInfo("t"); info.Type != db.BTreeIndexType {
+		t.Fatalf("expected a btree index after reopening, got %v", info.Type)
+	}
+	checkContents(t, d, "t", expected)
+}
+
+// Check that a table holds exactly the union of the expected entries.
+func checkContents(t *testing.T, d *db.Database, name string, expected []map[int64]int64) {
+	table, err := d.GetTable(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := table.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int64]int64)
+	for _, m := range expected {
+		for key, value := range m {
+			want[key] = value
+		}
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, found %d", len(want), len(entries))
+	}
+	for _, entry := range entries {
+		if value, ok := want[entry.GetKey()]; !ok || value != entry.GetValue() {
+			t.Fatalf("unexpected entry (%d, %d)", entry.GetKey(), entry.GetValue())
+		}
+	}
+}
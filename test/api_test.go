@@ -0,0 +1,168 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	concurrency "github.com/brown-csci1270/db/pkg/concurrency"
+	db "github.com/brown-csci1270/db/pkg/db"
+	recovery "github.com/brown-csci1270/db/pkg/recovery"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+
+	uuid "github.com/google/uuid"
+)
+
+func TestEmbeddedAPI(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.CreateTable("t", db.BTreeIndexType, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 1000; i++ {
+		if err := d.Insert("t", i, i*2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entry, err := d.Find("t", 10); err != nil || entry.GetValue() != 20 {
+		t.Errorf("expected (10, 20), got %v, %v", entry, err)
+	}
+	// Btree scans are in key order and stop at the first error.
+	next := int64(0)
+	stop := errors.New("stop")
+	err = d.Scan("t", func(entry utils.Entry) error {
+		if entry.GetKey() != next {
+			t.Fatalf("expected key %d, got %d", next, entry.GetKey())
+		}
+		next++
+		if next == 500 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || next != 500 {
+		t.Errorf("scan should have stopped at key 500, got %d, %v", next, err)
+	}
+	// A transaction locks what it touches until it commits.
+	tm := concurrency.NewTransactionManager(concurrency.NewLockManager())
+	tx, err := tm.BeginTx(d, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Update("t", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+	other, err := tm.BeginTx(d, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := other.Find("t", 10)
+		done <- err
+	}()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// A logged transaction's writes are undone on rollback.
+	logPath := d.GetLogPath()
+	if err := d.CreateLogFile(logPath); err != nil {
+		t.Fatal(err)
+	}
+	rm, err := recovery.NewRecoveryManager(d, tm, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtx, err := rm.BeginTx(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rtx.Insert("t", 5000, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rtx.Update("t", 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := rtx.Delete("t", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := rtx.Insert("t", 3, 3); !errors.Is(err, utils.ErrKeyExists) {
+		t.Errorf("expected ErrKeyExists, got %v", err)
+	}
+	if err := rtx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Find("t", 5000); !errors.Is(err, utils.ErrKeyNotFound) {
+		t.Errorf("insert wasn't rolled back: %v", err)
+	}
+	for _, key := range []int64{1, 2} {
+		if entry, err := d.Find("t", key); err != nil || entry.GetValue() != key*2 {
+			t.Errorf("write to key %d wasn't rolled back: %v, %v", key, entry, err)
+		}
+	}
+	// A write logs the value it replaces only once it holds the key's lock, so
+	// undoing it can't restore another transaction's uncommitted write.
+	first, err := rm.BeginTx(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Update("t", 7, 70); err != nil {
+		t.Fatal(err)
+	}
+	second, err := rm.BeginTx(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		done <- second.Update("t", 7, 700)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := first.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := d.Find("t", 7); err != nil || entry.GetValue() != 14 {
+		t.Errorf("expected (7, 14) after both rollbacks, got %v, %v", entry, err)
+	}
+	// Row tables aren't logged, so recovery mode refuses them.
+	if err := db.HandleCreateTable(d, "create table rows (id int primary key, v int)", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	rtx, err = rm.BeginTx(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rtx.Insert("rows", 1, 1); err == nil {
+		t.Error("expected a logged insert into a row table to fail")
+	}
+	rtx, err = rm.BeginTx(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := utils.NewWriteBatch()
+	batch.Put(1, 1)
+	if err := rtx.ApplyBatch("rows", batch); err == nil {
+		t.Error("expected a logged batch on a row table to fail")
+	}
+	if err := recovery.HandleCreateTable(d, tm, rm, "create table more (id int primary key)", ioutil.Discard, uuid.New()); err == nil {
+		t.Error("expected creating a row table in recovery mode to fail")
+	}
+}
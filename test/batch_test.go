@@ -0,0 +1,81 @@
+package test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+func TestWriteBatch(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, tblType := range []string{"btree", "hash", "linear"} {
+		name := tblType + "_t"
+		if err := db.HandleCreateTable(d, "create "+tblType+" table "+name, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.HandleCreateTable(d, "create index on "+name+"(value)", ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		// Several batches of random puts and deletes, large enough to split pages.
+		expected := make(map[int64]int64)
+		r := rand.New(rand.NewSource(1))
+		batch := utils.NewWriteBatch()
+		for round := 0; round < 3; round++ {
+			batch.Reset()
+			for i := 0; i < 2000; i++ {
+				key := r.Int63n(5000)
+				if r.Intn(4) == 0 {
+					batch.Delete(key)
+					delete(expected, key)
+				} else {
+					value := r.Int63n(500)
+					batch.Put(key, value)
+					expected[key] = value
+				}
+			}
+			if err := d.ApplyBatch(name, batch); err != nil {
+				t.Fatal(err)
+			}
+		}
+		table, err := d.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := table.Select()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(expected) {
+			t.Fatalf("%s: expected %d entries, found %d", tblType, len(expected), len(entries))
+		}
+		for _, entry := range entries {
+			if value, ok := expected[entry.GetKey()]; !ok || value != entry.GetValue() {
+				t.Fatalf("%s: unexpected entry (%d, %d)", tblType, entry.GetKey(), entry.GetValue())
+			}
+		}
+		// The secondary index should agree with the table.
+		found, err := d.FindByValue(name, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		for _, value := range expected {
+			if value == 3 {
+				want++
+			}
+		}
+		if len(found) != want {
+			t.Errorf("%s: expected %d entries with value 3, found %d", tblType, want, len(found))
+		}
+	}
+}
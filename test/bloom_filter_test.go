@@ -0,0 +1,84 @@
+package test
+
+import (
+	"math"
+	"testing"
+
+	query "github.com/brown-csci1270/db/pkg/query"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter, err := query.CreateFilterFor(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// About 9.6 bits and 7 hashes per key give a 1% false positive rate.
+	if filter.GetSize() < 95000 || filter.GetSize() > 96000 || filter.GetNumHashes() != 7 {
+		t.Errorf("unexpected filter shape: %d bits, %d hashes", filter.GetSize(), filter.GetNumHashes())
+	}
+	for i := int64(0); i < 10000; i++ {
+		filter.Insert(i * 3)
+	}
+	for i := int64(0); i < 10000; i++ {
+		if !filter.Contains(i * 3) {
+			t.Fatalf("inserted key %d is missing", i*3)
+		}
+	}
+	falsePositives := 0
+	for i := int64(0); i < 30000; i++ {
+		if filter.Contains(i*3 + 1) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 30000; rate > 0.02 {
+		t.Errorf("false positive rate %.4f is well above the 0.01 target", rate)
+	}
+	if rate := filter.EstimatedFalsePositiveRate(); rate < 0.005 || rate > 0.02 {
+		t.Errorf("estimated false positive rate %.4f is far from the 0.01 target", rate)
+	}
+	// Filters round-trip through their binary form.
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := &query.BloomFilter{}
+	if err := copied.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if copied.GetSize() != filter.GetSize() || copied.GetNumHashes() != filter.GetNumHashes() || !copied.Contains(2997) {
+		t.Errorf("filter changed after a round trip")
+	}
+	// A union contains the keys of both filters.
+	other, err := query.CreateFilterFor(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Insert(-5)
+	if copied.Contains(-5) {
+		t.Fatal("expected -5 to be missing before the union")
+	}
+	if err := copied.Union(other); err != nil {
+		t.Fatal(err)
+	}
+	if !copied.Contains(-5) || !copied.Contains(0) {
+		t.Errorf("union is missing keys")
+	}
+	if err := copied.Union(query.CreateFilter(64, 2)); err == nil {
+		t.Errorf("expected filters of different shapes not to union")
+	}
+	// A key's bits never all land in the same place, even when its second hash
+	// is a multiple of the size.
+	for key := int64(0); key < 1000; key++ {
+		small := query.CreateFilter(64, 2)
+		small.Insert(key)
+		if rate := small.EstimatedFalsePositiveRate(); rate != math.Pow(2.0/64, 2) {
+			t.Fatalf("expected key %d to set 2 of 64 bits, got a false positive rate of %v", key, rate)
+		}
+	}
+	// Rates outside (0, 1) can't size a filter.
+	for _, rate := range []float64{0, 1, -0.5, 2, math.NaN()} {
+		if _, err := query.CreateFilterFor(10000, rate); err == nil {
+			t.Errorf("expected a false positive rate of %v to be rejected", rate)
+		}
+	}
+}
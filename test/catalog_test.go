@@ -0,0 +1,159 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+func TestCatalog(t *testing.T) {
+	t.Run("TestCatalogReopen", testCatalogReopen)
+	t.Run("TestCatalogBootstrap", testCatalogBootstrap)
+	t.Run("TestCatalogDropRenameTruncate", testCatalogDropRenameTruncate)
+}
+
+func getTempDataFolder(t *testing.T) string {
+	folder, err := ioutil.TempDir(".", "data-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return folder
+}
+
+func testCatalogReopen(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{
+		"create btree table a",
+		"create hash table b",
+		"create linear table c",
+		"create memory btree table m",
+	} {
+		if err := db.HandleCreateTable(d, payload, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Every durable table should be open as soon as the database is.
+	d, err = db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	expected := map[string]db.IndexType{"a": db.BTreeIndexType, "b": db.HashIndexType, "c": db.LinearHashIndexType}
+	if len(d.GetTables()) != len(expected) {
+		t.Errorf("expected %d tables, have %d", len(expected), len(d.GetTables()))
+	}
+	for name, indexType := range expected {
+		info, ok := d.GetTableInfo(name)
+		if !ok {
+			t.Fatalf("table %s is missing from the catalog", name)
+		}
+		if info.Type != indexType || !info.Durable || len(info.Schema) != 2 {
+			t.Errorf("table %s has the wrong catalog entry: %+v", name, info)
+		}
+	}
+	if _, err := d.GetTable("m"); err == nil {
+		t.Error("memory table survived a restart")
+	}
+}
+
+func testCatalogBootstrap(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCreateTable(d, "create btree table a", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := d.GetTable("a")
+	table.Insert(1, 2)
+	d.Close()
+	// Without a catalog, tables are discovered from the data folder.
+	os.Remove(filepath.Join(folder, db.CatalogFileName))
+	d, err = db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	table, err = d.GetTable("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := table.Find(1); err != nil || entry.GetValue() != 2 {
+		t.Error("table was not reopened from disk")
+	}
+	if _, err := os.Stat(filepath.Join(folder, db.CatalogFileName)); err != nil {
+		t.Error("catalog was not rebuilt")
+	}
+}
+
+func testCatalogDropRenameTruncate(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := db.HandleCreateTable(d, "create hash table "+name, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		table, _ := d.GetTable(name)
+		for i := int64(0); i < 100; i++ {
+			table.Insert(i, i)
+		}
+	}
+	if err := d.DropTable("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RenameTable("b", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.TruncateTable("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RenameTable("c", "d"); err == nil {
+		t.Error("renamed a table over an existing one")
+	}
+	d.Close()
+	// The changes should be reflected on disk and in the catalog.
+	for _, file := range []string{"a", "a.meta", "b", "b.meta"} {
+		if _, err := os.Stat(filepath.Join(folder, file)); err == nil {
+			t.Errorf("file %s should have been removed", file)
+		}
+	}
+	d, err = db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.GetTable("a"); err == nil {
+		t.Error("dropped table was reopened")
+	}
+	renamed, err := d.GetTable("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := renamed.Find(99); err != nil || entry.GetValue() != 99 {
+		t.Error("renamed table lost its entries")
+	}
+	truncated, err := d.GetTable("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := truncated.Select(); len(entries) != 0 {
+		t.Errorf("truncated table still has %d entries", len(entries))
+	}
+}
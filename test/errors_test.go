@@ -0,0 +1,71 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+func TestTypedErrors(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.GetTable("missing"); !errors.Is(err, utils.ErrTableNotFound) {
+		t.Errorf("expected ErrTableNotFound, got %v", err)
+	}
+	for _, tblType := range []string{"btree", "hash", "linear"} {
+		name := tblType + "_t"
+		if err := db.HandleCreateTable(d, "create "+tblType+" table "+name, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.HandleCreateTable(d, "create "+tblType+" table "+name, ioutil.Discard); !errors.Is(err, utils.ErrTableExists) {
+			t.Errorf("%s: expected ErrTableExists, got %v", tblType, err)
+		}
+		table, err := d.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Insert(name, 1, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Insert(name, 1, 2); !errors.Is(err, utils.ErrKeyExists) {
+			t.Errorf("%s: expected ErrKeyExists, got %v", tblType, err)
+		}
+		if _, err := table.Find(2); !errors.Is(err, utils.ErrKeyNotFound) {
+			t.Errorf("%s: expected ErrKeyNotFound from find, got %v", tblType, err)
+		}
+		if err := db.HandleUpdate(d, "update "+name+" 2 2"); !errors.Is(err, utils.ErrKeyNotFound) {
+			t.Errorf("%s: expected ErrKeyNotFound from update, got %v", tblType, err)
+		}
+		// Racing inserts of the same key must leave exactly one winner.
+		var wg sync.WaitGroup
+		var inserted int64
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for key := int64(100); key < 2100; key++ {
+					if err := d.Insert(name, key, key); err == nil {
+						atomic.AddInt64(&inserted, 1)
+					} else if !errors.Is(err, utils.ErrKeyExists) {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if inserted != 2000 {
+			t.Errorf("%s: expected 2000 concurrent inserts to succeed, got %d", tblType, inserted)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	query "github.com/brown-csci1270/db/pkg/query"
+)
+
+func TestExternalSort(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	table, err := d.CreateTable("t", db.HashIndexType, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 5000; i++ {
+		if err := d.Insert("t", i, i*7919%1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collect := func(op query.Operator) []query.Tuple {
+		var tuples []query.Tuple
+		if err := query.Drain(op, func(tuple query.Tuple) error {
+			tuples = append(tuples, tuple)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return tuples
+	}
+	tempFiles := func() int {
+		files, err := filepath.Glob("db-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(files)
+	}
+	before := tempFiles()
+	// A budget this small spills many runs and takes several passes to merge.
+	terms := []query.SortTerm{{Expr: query.Column("value", 1), Desc: true}}
+	want := collect(query.NewSort(query.NewScan("t", table), terms))
+	got := collect(query.NewExternalSort(query.NewScan("t", table), terms, 10000))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("external sort disagrees with an in-memory sort")
+	}
+	if n := tempFiles(); n != before {
+		t.Errorf("expected sorted runs to be removed, found %d more temporary files", n-before)
+	}
+	// Sort-merge joins on values sort both sides.
+	merged := collect(query.SortMergeJoin(table, table, false, false, 10000))
+	if len(merged) != 5000*5 {
+		t.Errorf("expected %d joined tuples, got %d", 5000*5, len(merged))
+	}
+	// A join that fails to start still removes the runs its inputs spilled.
+	badKey := query.Binary("/", query.Column("key", 0), query.Constant(0))
+	join := query.NewMergeJoin(query.NewExternalSort(query.NewScan("t", table), terms, 10000), query.NewScan("t", table), badKey, query.Column("key", 0))
+	if err := join.Open(); err == nil {
+		t.Error("expected the join key to fail to evaluate")
+	}
+	if n := tempFiles(); n != before {
+		t.Errorf("expected a failed merge join to remove its inputs' runs, found %d more temporary files", n-before)
+	}
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"sync"
+	"testing"
+
+	hash "github.com/brown-csci1270/db/pkg/hash"
+)
+
+func TestHash(t *testing.T) {
+	t.Run("TestHashFindDuringSplits", testHashFindDuringSplits)
+	t.Run("TestHashCursorDuringSplits", testHashCursorDuringSplits)
+	t.Run("TestHashResumeInvalid", testHashResumeInvalid)
+}
+
+func getTempHashIndex(t *testing.T) (*hash.HashIndex, func()) {
+	dbName := getTempHashDB(t)
+	index, err := hash.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index, func() {
+		index.Close()
+		os.Remove(dbName)
+		os.Remove(dbName + ".meta")
+	}
+}
+
+func testHashFindDuringSplits(t *testing.T) {
+	index, cleanup := getTempHashIndex(t)
+	defer cleanup()
+	// Preload some entries that readers will look for.
+	n := int64(2000)
+	for i := int64(0); i < n; i++ {
+		if err := index.Insert(i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Insert many more entries, forcing splits and directory doublings,
+	// while readers keep finding the preloaded entries.
+	var wg sync.WaitGroup
+	numThreads := int64(4)
+	for w := int64(0); w < numThreads; w++ {
+		wg.Add(2)
+		go func(w int64) {
+			defer wg.Done()
+			for i := n + w; i < 10*n; i += numThreads {
+				if err := index.Insert(i, i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := int64(0); i < n; i++ {
+				entry, err := index.Find(i)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if entry.GetValue() != i {
+					t.Error("entry found has the wrong value")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	entries, err := index.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(entries)) != 10*n {
+		t.Errorf("expected %d entries, selected %d", 10*n, len(entries))
+	}
+	if ok, err := hash.IsHash(index); err != nil || !ok {
+		t.Error("entries are in the wrong buckets")
+	}
+}
+
+func testHashCursorDuringSplits(t *testing.T) {
+	index, cleanup := getTempHashIndex(t)
+	defer cleanup()
+	n := int64(2000)
+	for i := int64(0); i < n; i++ {
+		if err := index.Insert(i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Keep splitting buckets while the scan runs.
+	done := make(chan bool)
+	go func() {
+		for i := n; i < 10*n; i++ {
+			index.Insert(i, i)
+		}
+		done <- true
+	}()
+	// Scan half of the table, then resume from a position token.
+	seen := make(map[int64]int)
+	cursor, err := index.TableStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for steps := 0; !cursor.IsEnd(); steps++ {
+		if steps == int(n)/2 {
+			token := cursor.(*hash.HashCursor).Position()
+			if cursor, err = index.TableResume(token); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entry, err := cursor.GetEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[entry.GetKey()]++
+		cursor.StepForward()
+	}
+	<-done
+	// Every preloaded key must be returned exactly once.
+	for i := int64(0); i < n; i++ {
+		if seen[i] != 1 {
+			t.Errorf("key %d was returned %d times", i, seen[i])
+		}
+	}
+	for k, c := range seen {
+		if c != 1 {
+			t.Errorf("key %d was returned %d times", k, c)
+		}
+	}
+}
+
+func testHashResumeInvalid(t *testing.T) {
+	index, cleanup := getTempHashIndex(t)
+	defer cleanup()
+	for i := int64(0); i < 1000; i++ {
+		if err := index.Insert(i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	depth := index.GetTable().GetDepth()
+	token := func(depth, slot, key int64) string {
+		data := make([]byte, 0, 3*binary.MaxVarintLen64)
+		buf := make([]byte, binary.MaxVarintLen64)
+		for _, v := range []int64{depth, slot, key} {
+			n := binary.PutVarint(buf, v)
+			data = append(data, buf[:n]...)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	if _, err := index.TableResume(token(depth, 0, 0)); err != nil {
+		t.Errorf("expected a token at the directory's depth to resume, got %v", err)
+	}
+	// Tokens deeper than the directory, or past its last slot, are rejected
+	// rather than scanned.
+	for _, tok := range []string{token(depth+1, 0, 0), token(62, 0, 0), token(depth, int64(1)<<depth, 0), token(depth, -1, 0)} {
+		if _, err := index.TableResume(tok); err == nil {
+			t.Errorf("expected token %s to be rejected", tok)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	config "github.com/brown-csci1270/db/pkg/config"
+	db "github.com/brown-csci1270/db/pkg/db"
+	query "github.com/brown-csci1270/db/pkg/query"
+)
+
+func TestJoinTypes(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, name := range []string{"l", "r"} {
+		if _, err := d.CreateTable(name, db.HashIndexType, nil, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Keys 0-4999 on the left and 2500-5499 on the right; values are negated
+	// keys. The tables span many buckets of different depths.
+	for i := int64(0); i < 5500; i++ {
+		if i < 5000 {
+			if err := d.Insert("l", i, -i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i >= 2500 {
+			if err := d.Insert("r", i, -i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cases := []struct {
+		joinType  string
+		matched   int
+		leftOnly  int
+		rightOnly int
+	}{
+		{"inner", 2500, 0, 0},
+		{"left", 2500, 2500, 0},
+		{"right", 2500, 0, 500},
+		{"full", 2500, 2500, 500},
+		{"semi", 2500, 0, 0},
+		{"anti", 0, 2500, 0},
+	}
+	for _, c := range cases {
+		for _, on := range []string{"key", "val"} {
+			var buf bytes.Buffer
+			if err := query.HandleJoin(d, "join "+c.joinType+" l "+on+" on r "+on, &buf); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			seen := make(map[string]bool)
+			matched, leftOnly, rightOnly := 0, 0, 0
+			for _, line := range lines {
+				if line == "" {
+					continue
+				}
+				if seen[line] {
+					t.Fatalf("%s join on %s: duplicate result %s", c.joinType, on, line)
+				}
+				seen[line] = true
+				switch {
+				case c.joinType == "semi":
+					matched++
+				case strings.HasSuffix(line, "NULL}") || c.joinType == "anti":
+					leftOnly++
+				case strings.HasPrefix(line, "{NULL"):
+					rightOnly++
+				default:
+					matched++
+				}
+			}
+			if matched != c.matched || leftOnly != c.leftOnly || rightOnly != c.rightOnly {
+				t.Errorf("%s join on %s: expected %d/%d/%d matched/left-only/right-only results, got %d/%d/%d",
+					c.joinType, on, c.matched, c.leftOnly, c.rightOnly, matched, leftOnly, rightOnly)
+			}
+		}
+	}
+	// The join reports how well its Bloom filters did.
+	var buf bytes.Buffer
+	if err := query.HandleJoin(d, "join anti l key on r key stats", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "bloom filters: ") || !strings.Contains(out, "target 0.0100") {
+		t.Errorf("expected Bloom filter stats after the results, got %q", out[strings.LastIndex(out[:len(out)-1], "\n")+1:])
+	}
+	if err := query.HandleJoin(d, "join sideways l key on r key", &bytes.Buffer{}); err == nil {
+		t.Error("expected an invalid join type to be rejected")
+	}
+}
+
+func TestGraceJoinPartitioning(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	// A budget this small forces partitions to be split again.
+	opts := config.DefaultOptions()
+	opts.JoinMemory, opts.JoinWorkers = 16384, 3
+	d, err := db.Open(folder, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, name := range []string{"l", "r"} {
+		if _, err := d.CreateTable(name, db.HashIndexType, nil, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Values are skewed: a few values shared by many keys.
+	for i := int64(0); i < 2000; i++ {
+		if err := d.Insert("l", i, i%10); err != nil {
+			t.Fatal(err)
+		}
+		if i < 1500 {
+			if err := d.Insert("r", i, i%5); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tempFiles, err := filepath.Glob("db-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{
+		"join l key on r key stats":      1500,
+		"join l val on r val stats":      5 * 200 * 300,
+		"join anti l val on r val stats": 1000,
+		"join full l key on r val stats": 5*300 + 1995,
+	}
+	for payload, want := range cases {
+		var buf bytes.Buffer
+		if err := query.HandleJoin(d, payload, &buf); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		var repartitions int
+		if _, err := fmt.Sscanf(lines[len(lines)-1], "partitions split again: %d", &repartitions); err != nil {
+			t.Fatalf("%s: expected join stats, got %q", payload, lines[len(lines)-1])
+		}
+		if got := len(lines) - 2; got != want {
+			t.Errorf("%s: expected %d results, got %d", payload, want, got)
+		}
+		if repartitions == 0 {
+			t.Errorf("%s: expected partitions to overflow the memory budget", payload)
+		}
+	}
+	if after, _ := filepath.Glob("db-*"); len(after) != len(tempFiles) {
+		t.Errorf("expected partition files to be removed, found %d more", len(after)-len(tempFiles))
+	}
+}
+
+func TestJoinPlanning(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, name := range []string{"small", "big"} {
+		if _, err := d.CreateTable(name, db.HashIndexType, nil, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(0); i < 20000; i++ {
+		if i < 50 {
+			if err := d.Insert("small", i*3, i*7); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Insert("big", i, i%100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(payload string) ([]string, string) {
+		var buf bytes.Buffer
+		if err := query.HandleJoin(d, payload+" stats", &buf); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		var results []string
+		for _, line := range lines {
+			if strings.HasPrefix(line, "{") {
+				results = append(results, line)
+			}
+		}
+		sort.Strings(results)
+		return results, buf.String()
+	}
+	cases := []struct {
+		payload   string
+		indexJoin bool
+		results   int
+	}{
+		// A small left table probes the big right table's index.
+		{"join small key on big key", true, 50},
+		{"join small val on big key", true, 50},
+		// The right table's values aren't indexed.
+		{"join small key on big val", false, 34 * 200},
+		// The left table is too big to probe with.
+		{"join big key on small key", false, 50},
+		{"join big key on big key", false, 20000},
+	}
+	for _, c := range cases {
+		results, out := run(c.payload)
+		if usedIndex := strings.Contains(out, "not used by IndexJoin"); usedIndex != c.indexJoin {
+			t.Errorf("%s: expected an index join to be used: %v, got output ending %q", c.payload, c.indexJoin, out[strings.LastIndex(out[:len(out)-1], "\n")+1:])
+		}
+		if len(results) != c.results {
+			t.Errorf("%s: expected %d results, got %d", c.payload, c.results, len(results))
+		}
+		if !c.indexJoin {
+			continue
+		}
+		// Without the index join, the hash join finds the same results.
+		ratio := query.INDEX_JOIN_SIZE_RATIO
+		query.INDEX_JOIN_SIZE_RATIO = 1 << 40
+		hashed, out := run(c.payload)
+		query.INDEX_JOIN_SIZE_RATIO = ratio
+		if !strings.Contains(out, "probes") {
+			t.Errorf("%s: expected a hash join once the index join is ruled out", c.payload)
+		}
+		if !reflect.DeepEqual(results, hashed) {
+			t.Errorf("%s: index and hash joins disagree", c.payload)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	hash "github.com/brown-csci1270/db/pkg/hash"
+)
+
+func TestLinearHash(t *testing.T) {
+	t.Run("TestLinearHashInsertFind", testLinearHashInsertFind)
+	t.Run("TestLinearHashReopen", testLinearHashReopen)
+	t.Run("TestLinearHashConcurrentInserts", testLinearHashConcurrentInserts)
+}
+
+func testLinearHashInsertFind(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + hash.LINEAR_META_SUFFIX)
+	index, err := hash.OpenLinearTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	n := int64(5000)
+	for i := int64(0); i < n; i++ {
+		if err := index.Insert(i, i*2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Buckets should have been split one at a time.
+	if numBuckets := int64(len(index.GetTable().GetBuckets())); numBuckets <= 4 {
+		t.Errorf("expected table to grow, have %d buckets", numBuckets)
+	}
+	if ok, err := hash.IsLinearHash(index); err != nil || !ok {
+		t.Error("entries are in the wrong buckets")
+	}
+	for i := int64(0); i < n; i++ {
+		entry, err := index.Find(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.GetValue() != i*2 {
+			t.Error("entry found has the wrong value")
+		}
+	}
+	// Delete half the entries, then check that the cursor sees the rest.
+	for i := int64(0); i < n; i += 2 {
+		if err := index.Delete(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := 0
+	cursor, err := index.TableStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !cursor.IsEnd() {
+		entry, err := cursor.GetEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.GetKey()%2 == 0 {
+			t.Error("deleted entry was returned")
+		}
+		seen++
+		cursor.StepForward()
+	}
+	if int64(seen) != n/2 {
+		t.Errorf("expected %d entries, saw %d", n/2, seen)
+	}
+}
+
+func testLinearHashReopen(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + hash.LINEAR_META_SUFFIX)
+	index, err := hash.OpenLinearTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 1000; i++ {
+		index.Insert(i, i)
+	}
+	if err := index.Close(); err != nil {
+		t.Fatal(err)
+	}
+	index, err = hash.OpenLinearTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if index.GetTable().GetNumKeys() != 1000 {
+		t.Errorf("expected 1000 keys, have %d", index.GetTable().GetNumKeys())
+	}
+	for i := int64(0); i < 1000; i++ {
+		if _, err := index.Find(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testLinearHashConcurrentInserts(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + hash.LINEAR_META_SUFFIX)
+	index, err := hash.OpenLinearTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	// Inserts check whether to split while others are splitting.
+	var wg sync.WaitGroup
+	numThreads := int64(4)
+	n := int64(5000)
+	for w := int64(0); w < numThreads; w++ {
+		wg.Add(1)
+		go func(w int64) {
+			defer wg.Done()
+			for i := w; i < n; i += numThreads {
+				if err := index.Insert(i, i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if ok, err := hash.IsLinearHash(index); err != nil || !ok {
+		t.Error("entries are in the wrong buckets")
+	}
+	for i := int64(0); i < n; i++ {
+		if _, err := index.Find(i); err != nil {
+			t.Fatalf("key %d is missing: %v", i, err)
+		}
+	}
+}
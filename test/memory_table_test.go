@@ -0,0 +1,53 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+func TestMemoryTable(t *testing.T) {
+	folder, err := ioutil.TempDir(".", "data-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, indexType := range []string{"btree", "hash", "linear"} {
+		name := "mem" + indexType
+		var out bytes.Buffer
+		if err := db.HandleCreateTable(d, "create memory "+indexType+" table "+name, &out); err != nil {
+			t.Fatal(err)
+		}
+		if info, ok := d.GetTableInfo(name); !ok || info.Durable {
+			t.Errorf("%s table should be flagged as non-durable", indexType)
+		}
+		table, err := d.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Insert enough entries to need more pages than the pager has frames.
+		n := int64(20000)
+		for i := int64(0); i < n; i++ {
+			if err := table.Insert(i, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := int64(0); i < n; i++ {
+			if entry, err := table.Find(i); err != nil || entry.GetValue() != i {
+				t.Fatalf("%s table lost key %d", indexType, i)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(folder, name)); err == nil {
+			t.Errorf("%s memory table was written to disk", indexType)
+		}
+	}
+}
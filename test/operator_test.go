@@ -0,0 +1,99 @@
+package test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	config "github.com/brown-csci1270/db/pkg/config"
+	db "github.com/brown-csci1270/db/pkg/db"
+	query "github.com/brown-csci1270/db/pkg/query"
+)
+
+func TestOperators(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	left, err := d.CreateTable("l", db.BTreeIndexType, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	right, err := d.CreateTable("r", db.LinearHashIndexType, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 2000; i++ {
+		if err := d.Insert("l", i, i%50); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			if err := d.Insert("r", i, i%7); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	collect := func(op query.Operator) []query.Tuple {
+		var tuples []query.Tuple
+		if err := query.Drain(op, func(t query.Tuple) error {
+			tuples = append(tuples, t)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return tuples
+	}
+	// A btree range scan, filtered, sorted by value then key descending, and limited.
+	key, value := query.Column("key", 0), query.Column("value", 1)
+	op := query.NewProject(
+		query.NewLimit(
+			query.NewSort(
+				query.NewFilter(query.NewIndexScan("l", left, 100, 1999), query.Binary("<", value, query.Constant(2))),
+				[]query.SortTerm{{Expr: value}, {Expr: key, Desc: true}}),
+			3),
+		[]query.Scalar{key})
+	want := []query.Tuple{{1950}, {1900}, {1850}}
+	if got := collect(op); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	// Operators can be run again.
+	if got := collect(op); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v on the second run, got %v", want, got)
+	}
+	// All the joins agree on an equijoin of l.value with r.key.
+	joins := []query.Operator{
+		query.NewHashJoin(query.NewScan("l", left), query.NewScan("r", right), value, key),
+		query.NewNestedLoopJoin(query.NewScan("l", left), query.NewScan("r", right), query.Binary("=", value, query.Column("r.key", 2))),
+		query.NewIndexJoin(query.NewScan("l", left), "r", right, value),
+		query.SortMergeJoin(left, right, false, true, config.SortMemory),
+		query.IndexNestedLoopJoin(left, right, false),
+	}
+	counts := make(map[[4]int64]int)
+	for _, join := range joins {
+		for _, t := range collect(join) {
+			counts[[4]int64{t[0], t[1], t[2], t[3]}]++
+		}
+	}
+	// Every l entry with a value divisible by 3 has one match.
+	if len(counts) != 2000*17/50 {
+		t.Errorf("expected %d joined tuples, got %d", 2000*17/50, len(counts))
+	}
+	for pair, n := range counts {
+		if n != len(joins) || pair[1] != pair[2] || pair[2]%3 != 0 {
+			t.Fatalf("unexpected join result %v from %d joins", pair, n)
+		}
+	}
+	// Btrees joined on their keys are merged straight from their cursors.
+	merged := collect(query.SortMergeJoin(left, left, true, true, config.SortMemory))
+	if len(merged) != 2000 {
+		t.Fatalf("expected 2000 merged tuples, got %d", len(merged))
+	}
+	for i, tuple := range merged {
+		if tuple[0] != int64(i) || tuple[2] != int64(i) || tuple[1] != tuple[3] {
+			t.Fatalf("unexpected merge join result %v at %d", tuple, i)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/brown-csci1270/db/pkg/config"
+	db "github.com/brown-csci1270/db/pkg/db"
+	hash "github.com/brown-csci1270/db/pkg/hash"
+	heap "github.com/brown-csci1270/db/pkg/heap"
+)
+
+func TestOptions(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	// Fields missing from the file keep their defaults.
+	path := filepath.Join(folder, "options.json")
+	data := `{"num_pages": 8, "log_file": "wal.log", "sync": "none", "default_index_type": "hash"}`
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := config.LoadOptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.NumPages != 8 || opts.Sync != config.SyncNone || opts.SortMemory != config.DefaultOptions().SortMemory {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+	d, err := db.Open(filepath.Join(folder, "data"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.GetLogPath() != filepath.Join(folder, "data", "wal.log") {
+		t.Errorf("log file should be in the data folder, got %s", d.GetLogPath())
+	}
+	// Tables created without a type get the default, even with a small buffer.
+	if err := db.HandleCreateTable(d, "create table t", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := d.GetTableInfo("t"); info.Type != db.HashIndexType {
+		t.Errorf("expected a hash table, got %v", info.Type)
+	}
+	for i := int64(0); i < 5000; i++ {
+		if err := d.Insert("t", i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	table, _ := d.GetTable("t")
+	if entries, _ := table.Select(); len(entries) != 5000 {
+		t.Errorf("expected 5000 entries, found %d", len(entries))
+	}
+	// Invalid options are rejected.
+	for _, data := range []string{`{"page_size": 1024}`, `{"sync": "sometimes"}`, `{"num_pagse": 8}`, `{"bloom_fp_rate": 1}`} {
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := config.LoadOptions(path); err == nil {
+			t.Errorf("loaded invalid options %s", data)
+		}
+	}
+	// Tables keep the page size they were created with, even when the database is
+	// reopened with another one.
+	opts.PageSize = 4 * config.DefaultOptions().PageSize
+	sized := filepath.Join(folder, "sized")
+	d2, err := db.Open(sized, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, create := range []string{"create btree table b", "create hash table h", "create linear table l", "create table r (id int primary key, name text)"} {
+		if err := db.HandleCreateTable(d2, create, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := int64(5000)
+	for i := int64(0); i < n; i++ {
+		for _, name := range []string{"b", "h", "l"} {
+			if err := d2.Insert(name, i, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d2.InsertRow("r", db.Row{i, "row"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"b", "h", "h.meta", "l", "l" + hash.LINEAR_META_SUFFIX, "r", "r" + heap.HEAP_SUFFIX} {
+		stat, err := os.Stat(filepath.Join(sized, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Size() == 0 || stat.Size()%opts.PageSize != 0 {
+			t.Errorf("expected %s to be made of %d-byte pages, has %d bytes", file, opts.PageSize, stat.Size())
+		}
+	}
+	d2, err = db.Open(sized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+	for _, name := range []string{"b", "h", "l"} {
+		if info, _ := d2.GetTableInfo(name); info.PageSize != opts.PageSize {
+			t.Errorf("expected %s's page size of %d in the catalog, got %d", name, opts.PageSize, info.PageSize)
+		}
+		for i := int64(0); i < n; i += 97 {
+			if entry, err := d2.Find(name, i); err != nil || entry.GetValue() != i {
+				t.Fatalf("expected (%d, %d) in %s, got %v, %v", i, i, name, entry, err)
+			}
+		}
+	}
+	if rows, err := d2.SelectRows("r"); err != nil || int64(len(rows)) != n {
+		t.Errorf("expected %d rows, got %d (%v)", n, len(rows), err)
+	}
+	if err := db.HandleCreateTable(d2, "create hash table small", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := d2.GetTableInfo("small"); info.PageSize != config.DefaultOptions().PageSize {
+		t.Errorf("expected a new table to get the default page size, got %d", info.PageSize)
+	}
+	// Bigger pages hold more entries.
+	big, _ := d2.GetTable("h")
+	small, _ := d2.GetTable("small")
+	bigBuckets, smallBuckets := big.(*hash.HashIndex).GetTable().GetBucketSize(), small.(*hash.HashIndex).GetTable().GetBucketSize()
+	if bigBuckets < 4*smallBuckets {
+		t.Errorf("expected buckets on %d-byte pages to hold at least %d entries, hold %d", opts.PageSize, 4*smallBuckets, bigBuckets)
+	}
+	opts.DefaultIndexType = "heap"
+	if _, err := db.Open(filepath.Join(folder, "other"), opts); err == nil {
+		t.Error("opened a database with an invalid default index type")
+	}
+}
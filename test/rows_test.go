@@ -0,0 +1,160 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	heap "github.com/brown-csci1270/db/pkg/heap"
+)
+
+func TestRows(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCreateTable(d, "create table users (id int primary key, name text, age int)", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// Insert enough rows to fill several heap pages.
+	n := int64(2000)
+	for i := int64(0); i < n; i++ {
+		if err := d.InsertRow("users", db.Row{i, fmt.Sprintf("user %d", i), i % 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.InsertRow("users", db.Row{int64(0), "dup", int64(0)}); err == nil {
+		t.Error("inserted a duplicate primary key")
+	}
+	if err := d.InsertRow("users", db.Row{n, int64(1), int64(0)}); err == nil {
+		t.Error("inserted a row with the wrong column types")
+	}
+	if err := d.UpdateRow("users", 7, map[string]interface{}{"name": "Seven"}); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	// Rows and the schema should survive a restart.
+	d, err = db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	info, ok := d.GetTableInfo("users")
+	if !ok || !info.IsRowTable() || len(info.Schema) != 3 {
+		t.Fatalf("schema was not kept in the catalog: %+v", info)
+	}
+	row, err := d.FindRow("users", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row[1] != "Seven" || row[2] != int64(7) {
+		t.Errorf("row 7 is wrong: %v", row)
+	}
+	rows, err := d.SelectRows("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(rows)) != n {
+		t.Fatalf("expected %d rows, selected %d", n, len(rows))
+	}
+	for i, row := range rows {
+		if row[0] != int64(i) {
+			t.Fatalf("rows are out of order at %d: %v", i, row)
+		}
+	}
+	// Concurrent updates to different columns of a row must both land.
+	var wg sync.WaitGroup
+	for _, col := range []string{"name", "age"} {
+		wg.Add(1)
+		go func(col string) {
+			defer wg.Done()
+			for i := int64(0); i < 1000; i++ {
+				var v interface{} = i
+				if col == "name" {
+					v = fmt.Sprintf("name %d", i)
+				}
+				if err := d.UpdateRow("users", 8, map[string]interface{}{col: v}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(col)
+	}
+	wg.Wait()
+	if row, err := d.FindRow("users", 8); err != nil || row[1] != "name 999" || row[2] != int64(999) {
+		t.Errorf("expected both columns' last updates on row 8, got %v (%v)", row, err)
+	}
+}
+
+func TestRowsCompact(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCreateTable(d, "create table users (id int primary key, name text)", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	n := int64(100)
+	for i := int64(0); i < n; i++ {
+		if err := d.InsertRow("users", db.Row{i, fmt.Sprintf("user %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	heapSize := func() int64 {
+		d.Close()
+		stat, err := os.Stat(filepath.Join(folder, "users"+heap.HEAP_SUFFIX))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, err = db.Open(folder); err != nil {
+			t.Fatal(err)
+		}
+		return stat.Size()
+	}
+	initial := heapSize()
+	// Every update leaves the old version of the row behind.
+	for round := 0; round < 50; round++ {
+		for i := int64(0); i < n; i++ {
+			if err := d.UpdateRow("users", i, map[string]interface{}{"name": fmt.Sprintf("user %d v%d", i, round)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	grown := heapSize()
+	if grown <= 10*initial {
+		t.Errorf("expected updates to grow the heap from %d bytes, have %d", initial, grown)
+	}
+	if err := db.HandleCompactTable(d, "compact table users", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	compacted := heapSize()
+	defer d.Close()
+	if compacted > 2*initial {
+		t.Errorf("expected compaction to shrink the heap from %d bytes to about %d, have %d", grown, initial, compacted)
+	}
+	rows, err := d.SelectRows("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(rows)) != n {
+		t.Fatalf("expected %d rows after compacting, selected %d", n, len(rows))
+	}
+	for i, row := range rows {
+		if row[0] != int64(i) || row[1] != fmt.Sprintf("user %d v49", i) {
+			t.Fatalf("row %d is wrong after compacting: %v", i, row)
+		}
+	}
+	if err := d.InsertRow("users", db.Row{n, "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCompactTable(d, "compact table nope", ioutil.Discard); err == nil {
+		t.Error("expected compacting a missing table to fail")
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+)
+
+func TestSecondaryIndex(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCreateTable(d, "create btree table t", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// Some entries exist before the index does.
+	expected := make(map[int64]int64)
+	for i := int64(0); i < 500; i++ {
+		expected[i] = i % 7
+		if err := d.Insert("t", i, i%7); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.HandleCreateTable(d, "create index on t(value)", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// Mix inserts, updates and deletes once the index exists.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		key := r.Int63n(1000)
+		value := r.Int63n(7)
+		_, exists := expected[key]
+		switch {
+		case !exists:
+			err = d.Insert("t", key, value)
+			expected[key] = value
+		case r.Intn(2) == 0:
+			err = d.Update("t", key, value)
+			expected[key] = value
+		default:
+			err = d.Delete("t", key)
+			delete(expected, key)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func() {
+		for value := int64(0); value < 7; value++ {
+			want := make([]int64, 0)
+			for k, v := range expected {
+				if v == value {
+					want = append(want, k)
+				}
+			}
+			entries, err := d.FindByValue("t", value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int64, 0)
+			for _, entry := range entries {
+				got = append(got, entry.GetKey())
+			}
+			sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if len(got) != len(want) {
+				t.Fatalf("value %d: expected %d keys, found %d", value, len(want), len(got))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("value %d: expected key %d, found %d", value, want[i], got[i])
+				}
+			}
+		}
+	}
+	check()
+	if err := db.HandleCreateTable(d, "create btree table u", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 500; i++ {
+		if err := d.Insert("u", i, i%7); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The index should be reopened with the table.
+	d.Close()
+	// Leave index files behind for u, as if building its index had failed.
+	for _, suffix := range []string{db.SECONDARY_HEADS_SUFFIX, db.SECONDARY_NEXT_SUFFIX, db.SECONDARY_PREV_SUFFIX} {
+		data, err := ioutil.ReadFile(filepath.Join(folder, "t"+suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(folder, "u"+suffix), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d, err = db.Open(folder); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if info, _ := d.GetTableInfo("t"); len(info.Indexes) != 1 {
+		t.Errorf("index was not recorded in the catalog")
+	}
+	check()
+	for key, value := range expected {
+		if value == 3 || key%2 == 0 {
+			if err := d.Delete("t", key); err != nil {
+				t.Fatal(err)
+			}
+			delete(expected, key)
+		}
+	}
+	check()
+	// Stale index files are cleared before an index is built.
+	if err := db.HandleCreateTable(d, "create index on u(value)", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := d.FindByValue("u", 3); err != nil || len(entries) != 71 {
+		t.Errorf("expected 71 keys with value 3 in u, found %d (%v)", len(entries), err)
+	}
+}
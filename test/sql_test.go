@@ -0,0 +1,93 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	query "github.com/brown-csci1270/db/pkg/query"
+)
+
+func TestSQL(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.CreateTable("a", db.BTreeIndexType, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.CreateTable("b", db.HashIndexType, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	run := func(sql string) string {
+		var buf bytes.Buffer
+		if err := query.ExecuteSQL(d, sql, &buf); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return buf.String()
+	}
+	run("insert into a values (1, 10), (2, 20), (3, 30), (4, 10)")
+	run("INSERT INTO b (value, key) VALUES (100, 10), (300, 30);")
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{"select * from a where key >= 2 and key < 4", "(2, 20)\n(3, 30)\n"},
+		{"select key from a where value = 10 or key = 3 order by value desc, key limit 2", "(3)\n(1)\n"},
+		{"select a.key, b.value from a join b on a.value = b.key order by b.value desc", "(3, 300)\n(1, 100)\n(4, 100)\n"},
+		{"select x.key, y.key from a x join a y on x.value = y.value and x.key < y.key", "(1, 4)\n"},
+		{"select key, -value / 10 from a where not (key != 2)", "(2, -2)\n"},
+		{"select * from a x join a y on x.key < y.key where y.value = 10", "(1, 10, 4, 10)\n(2, 20, 4, 10)\n(3, 30, 4, 10)\n"},
+		{"select a.key, b.key from a join b on a.key * 100 = b.value", "(1, 10)\n(3, 30)\n"},
+		{"select b.key, a.key from b join a on b.key = a.value where a.key > 1 order by b.key", "(10, 4)\n(30, 3)\n"},
+		{"select x.key, y.value from a x join a y on y.key = x.key where x.key > 1 and y.value < 30", "(2, 20)\n(4, 10)\n"},
+	}
+	for _, c := range cases {
+		if got := run(c.sql); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.sql, c.want, got)
+		}
+	}
+	// The planner should use the table's index where it can.
+	plans := map[string]string{
+		"explain select * from a where key = 2 and value > 0": "IndexScan a key = 2",
+		"explain select * from a where key > 1 order by key":  "IndexScan a 1 <= key",
+		"explain select * from a join b on b.key = a.value":   "IndexJoin b key = a.value",
+		"explain select * from a join b on a.key = b.value":   "HashJoin a.key = b.value",
+		"explain select * from a x join a y on x.key < y.key": "NestedLoopJoin (x.key < y.key)",
+		"explain select * from a x join a y on x.key = y.key": "MergeJoin x.key = y.key",
+	}
+	for sql, want := range plans {
+		if got := run(sql); !strings.Contains(got, want) {
+			t.Errorf("%s: expected %q in plan, got\n%s", sql, want, got)
+		}
+	}
+	if got := run("explain select * from a where key > 1 order by key"); strings.Contains(got, "Sort") {
+		t.Errorf("btree range scans shouldn't be sorted again, got\n%s", got)
+	}
+	// Writes.
+	run("update a set value = value + 1 where key > 2")
+	run("delete from a where value = 20")
+	if got := run("select * from a"); got != "(1, 10)\n(3, 31)\n(4, 11)\n" {
+		t.Errorf("unexpected contents after writes: %q", got)
+	}
+	// Bad statements are rejected.
+	for _, sql := range []string{
+		"select from a",
+		"select * from a where",
+		"select foo from a",
+		"select key from a join b on key = key",
+		"select * from missing",
+		"update a set key = 1",
+		"insert into a values (1, 2)",
+		"select * from a limit 1 extra",
+	} {
+		if err := query.ExecuteSQL(d, sql, &bytes.Buffer{}); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
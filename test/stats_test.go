@@ -0,0 +1,113 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	hash "github.com/brown-csci1270/db/pkg/hash"
+)
+
+func TestHashStats(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := db.HandleCreateTable(d, "create hash table h", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	index, err := d.GetTable("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := index.(*hash.HashIndex).GetTable()
+	bucketSize := table.GetBucketSize()
+	// A few keys in each of the initial buckets, then enough keys that all hash
+	// to the first one that it splits again and again while the others don't.
+	n := int64(0)
+	for key, skewed := int64(0), int64(0); skewed < 3*bucketSize; key++ {
+		if hash.Hasher(key, 2) == 0 {
+			skewed++
+		} else if key > 40 {
+			continue
+		}
+		if err := d.Insert("h", key, key); err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	stats, err := index.(*hash.HashIndex).Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tally the buckets independently.
+	depths := make(map[int64]int64)
+	fill := make([]int64, hash.FILL_HISTOGRAM_BINS)
+	seen := make(map[int64]bool)
+	for _, pn := range table.GetBuckets() {
+		if seen[pn] {
+			continue
+		}
+		seen[pn] = true
+		bucket, err := table.GetBucketByPN(pn, hash.NO_LOCK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, _ := bucket.Select()
+		depths[bucket.GetDepth()]++
+		bin := int64(len(entries)) * hash.FILL_HISTOGRAM_BINS / bucketSize
+		if bin >= hash.FILL_HISTOGRAM_BINS {
+			bin = hash.FILL_HISTOGRAM_BINS - 1
+		}
+		fill[bin]++
+		bucket.GetPage().Put()
+	}
+	if stats.GlobalDepth <= 2 || stats.GlobalDepth != table.GetDepth() || stats.DirectorySize != int64(1)<<stats.GlobalDepth {
+		t.Errorf("expected a directory of depth %d with %d entries, got depth %d with %d",
+			table.GetDepth(), int64(1)<<table.GetDepth(), stats.GlobalDepth, stats.DirectorySize)
+	}
+	if stats.NumBuckets != int64(len(seen)) || stats.NumEntries != n {
+		t.Errorf("expected %d buckets and %d entries, got %d and %d", len(seen), n, stats.NumBuckets, stats.NumEntries)
+	}
+	// The three buckets that never split keep their depth; the rest are deeper.
+	if depths[2] != 3 || len(depths) < 2 || !reflect.DeepEqual(stats.DepthHistogram, depths) {
+		t.Errorf("expected local depths %v, with 3 buckets at depth 2, got %v", depths, stats.DepthHistogram)
+	}
+	if !reflect.DeepEqual(stats.FillHistogram, fill) {
+		t.Errorf("expected fill histogram %v, got %v", fill, stats.FillHistogram)
+	}
+	// The REPL prints the same stats.
+	var buf bytes.Buffer
+	if err := db.HandleStats(d, "stats h", &buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		fmt.Sprintf("global depth: %d\n", stats.GlobalDepth),
+		fmt.Sprintf("distinct buckets: %d\n", stats.NumBuckets),
+		fmt.Sprintf("entries: %d\n", n),
+		fmt.Sprintf("    2: %d\n", 3),
+		fmt.Sprintf("    0- 10%%: %6d", fill[0]),
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected stats output to contain %q, got:\n%s", line, out)
+		}
+	}
+	if err := db.HandleCreateTable(d, "create btree table b", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleStats(d, "stats b", &buf); err == nil || !strings.Contains(err.Error(), "not a hash table") {
+		t.Errorf("expected stats on a btree to be rejected, got %v", err)
+	}
+	if err := db.HandleStats(d, "stats", &buf); err == nil {
+		t.Error("expected a usage error")
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+func TestImportExport(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := db.HandleCreateTable(d, "create hash table kv", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HandleCreateTable(d, "create table users (id int primary key, name text, age int)", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 3000; i++ {
+		if err := d.Insert("kv", i, -i); err != nil {
+			t.Fatal(err)
+		}
+		// Text that needs quoting or escaping in CSV and JSON.
+		name := fmt.Sprintf("user, \"%d\"\n", i)
+		if err := d.InsertRow("users", db.Row{i, name, i % 90}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, format := range []db.Format{db.CSVFormat, db.JSONLFormat, db.BinaryFormat} {
+		for _, src := range []string{"kv", "users"} {
+			info, _ := d.GetTableInfo(src)
+			dst := fmt.Sprintf("%s_%v", src, format)
+			create := "create btree table " + dst
+			if info.IsRowTable() {
+				create = "create table " + dst + " (id int primary key, name text, age int)"
+			}
+			if err := db.HandleCreateTable(d, create, ioutil.Discard); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := d.Export(src, format, &buf); err != nil {
+				t.Fatalf("%v: %v", format, err)
+			}
+			// Importing twice should overwrite rather than duplicate.
+			for i := 0; i < 2; i++ {
+				if err := d.Import(dst, format, bytes.NewReader(buf.Bytes())); err != nil {
+					t.Fatalf("%v: %v", format, err)
+				}
+			}
+			var want, got bytes.Buffer
+			d.Export(src, db.CSVFormat, &want)
+			d.Export(dst, db.CSVFormat, &got)
+			if info.IsRowTable() && want.String() != got.String() {
+				t.Errorf("%v: %s differs from %s after a round trip", format, dst, src)
+			}
+			if !info.IsRowTable() {
+				// Hash tables don't export in key order, so compare contents.
+				srcTable, _ := d.GetTable(src)
+				dstTable, _ := d.GetTable(dst)
+				srcEntries, _ := srcTable.Select()
+				dstEntries, _ := dstTable.Select()
+				wantMap := make(map[int64]int64)
+				gotMap := make(map[int64]int64)
+				for _, entry := range srcEntries {
+					wantMap[entry.GetKey()] = entry.GetValue()
+				}
+				for _, entry := range dstEntries {
+					gotMap[entry.GetKey()] = entry.GetValue()
+				}
+				if !reflect.DeepEqual(wantMap, gotMap) || len(dstEntries) != len(srcEntries) {
+					t.Errorf("%v: %s differs from %s after a round trip", format, dst, src)
+				}
+			}
+		}
+	}
+	// Corrupt binary dumps are rejected rather than trusted.
+	var dump bytes.Buffer
+	if err := d.Export("users", db.BinaryFormat, &dump); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, length := range []uint64{1 << 62, 100} {
+		n := binary.PutUvarint(buf, length)
+		corrupt := append(append(append([]byte{}, dump.Bytes()...), buf[:n]...), "abc"...)
+		if err := d.Import("users", db.BinaryFormat, bytes.NewReader(corrupt)); !errors.Is(err, utils.ErrCorrupt) {
+			t.Errorf("expected ErrCorrupt from a %d-byte record, got %v", length, err)
+		}
+	}
+	// Imports must match the table's columns.
+	if err := d.Import("kv", db.CSVFormat, bytes.NewBufferString("key,other\n1,2\n")); err == nil {
+		t.Error("imported a file with the wrong columns")
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	db "github.com/brown-csci1270/db/pkg/db"
+	utils "github.com/brown-csci1270/db/pkg/utils"
+)
+
+func TestUpsertAndCompareAndSwap(t *testing.T) {
+	folder := getTempDataFolder(t)
+	defer os.RemoveAll(folder)
+	d, err := db.Open(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, tblType := range []string{"btree", "hash", "linear"} {
+		name := tblType + "_t"
+		if err := db.HandleCreateTable(d, "create "+tblType+" table "+name, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		table, err := d.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Upsert enough keys to split, then upsert them all again.
+		for round := int64(0); round < 2; round++ {
+			for i := int64(0); i < 1000; i++ {
+				if err := table.Upsert(i, i+round); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		entries, err := table.Select()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1000 {
+			t.Fatalf("%s: expected 1000 entries after upserts, found %d", tblType, len(entries))
+		}
+		if swapped, err := table.CompareAndSwap(5, 5, 0); err != nil || swapped {
+			t.Errorf("%s: swapped an entry holding an unexpected value", tblType)
+		}
+		if _, err := table.CompareAndSwap(5000, 0, 0); !errors.Is(err, utils.ErrKeyNotFound) {
+			t.Errorf("%s: expected ErrKeyNotFound, got %v", tblType, err)
+		}
+		// Concurrent increments only stick if compare and swap is atomic.
+		if err := table.Upsert(-1, 0); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 100; {
+					entry, err := table.Find(-1)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					swapped, err := table.CompareAndSwap(-1, entry.GetValue(), entry.GetValue()+1)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if swapped {
+						n++
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if entry, err := table.Find(-1); err != nil || entry.GetValue() != 800 {
+			t.Errorf("%s: expected counter to reach 800, got %v", tblType, entry)
+		}
+	}
+}